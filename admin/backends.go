@@ -0,0 +1,167 @@
+// Package admin provides the authenticated HTTP API for managing the frontend at runtime.
+package admin
+
+import (
+	"Go_Frontend/config"
+	"Go_Frontend/route"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// RegisterRoutes mounts the admin endpoints on the given group.
+func RegisterRoutes(g *gin.RouterGroup) {
+	g.GET("/backends", listBackends)
+	g.POST("/backends", addBackend)
+	g.GET("/backends/:name", getBackend)
+	g.PUT("/backends/:name", updateBackend)
+	g.DELETE("/backends/:name", removeBackend)
+	g.POST("/backends/:name/disable", disableBackend)
+	g.POST("/backends/:name/enable", enableBackend)
+	g.GET("/route", testRoute)
+	g.GET("/servers", listServers)
+	g.GET("/cache/stats", cacheStats)
+	g.GET("/cache/items/:itemID/:mediaSourceID", getCachedPath)
+	g.DELETE("/cache/items/:itemID", deleteCachedItem)
+	g.DELETE("/cache/paths", deleteCachedPaths)
+	g.DELETE("/cache", flushCache)
+}
+
+// serverParam returns the server named by the "server" query parameter, or the default
+// server when it is absent. It responds 404 itself for an unknown server.
+func serverParam(c *gin.Context) (*config.ServerConfig, bool) {
+	server := config.DefaultServer()
+	if name := c.Query("server"); name != "" {
+		server = config.GetServer(name)
+	}
+	if server == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+		return nil, false
+	}
+	return server, true
+}
+
+// registryParam returns the backend registry of the server selected by serverParam.
+func registryParam(c *gin.Context) (*route.Registry, bool) {
+	server, ok := serverParam(c)
+	if !ok {
+		return nil, false
+	}
+	return route.GetRegistry(server.Name), true
+}
+
+// listServers lists the configured media servers without their API keys.
+func listServers(c *gin.Context) {
+	servers := make([]gin.H, 0, len(config.GetConfig().Servers))
+	for _, server := range config.GetConfig().Servers {
+		servers = append(servers, gin.H{
+			"name":  server.Name,
+			"hosts": server.Hosts,
+			"type":  server.Type,
+			"url":   server.FullURL(),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"servers": servers})
+}
+
+func listBackends(c *gin.Context) {
+	registry, ok := registryParam(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"backends": registry.List()})
+}
+
+func getBackend(c *gin.Context) {
+	registry, ok := registryParam(c)
+	if !ok {
+		return
+	}
+	backend, err := registry.Get(c.Param("name"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, backend)
+}
+
+func addBackend(c *gin.Context) {
+	registry, ok := registryParam(c)
+	if !ok {
+		return
+	}
+	var backend config.BackendConfig
+	if err := c.ShouldBindJSON(&backend); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := registry.Add(backend); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, backend)
+}
+
+func updateBackend(c *gin.Context) {
+	registry, ok := registryParam(c)
+	if !ok {
+		return
+	}
+	var backend config.BackendConfig
+	if err := c.ShouldBindJSON(&backend); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := c.Param("name")
+	if err := registry.Update(name, backend); err != nil {
+		respondError(c, err)
+		return
+	}
+	getBackend(c)
+}
+
+func removeBackend(c *gin.Context) {
+	registry, ok := registryParam(c)
+	if !ok {
+		return
+	}
+	if err := registry.Remove(c.Param("name")); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func disableBackend(c *gin.Context) {
+	setDisabled(c, true)
+}
+
+func enableBackend(c *gin.Context) {
+	setDisabled(c, false)
+}
+
+func setDisabled(c *gin.Context, disabled bool) {
+	registry, ok := registryParam(c)
+	if !ok {
+		return
+	}
+	if err := registry.SetDisabled(c.Param("name"), disabled); err != nil {
+		respondError(c, err)
+		return
+	}
+	getBackend(c)
+}
+
+// respondError maps registry errors onto HTTP status codes.
+func respondError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, route.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, route.ErrConflict):
+		status = http.StatusConflict
+	case errors.Is(err, route.ErrInvalid):
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"Go_Frontend/stream"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// cacheStats reports the size of the path cache and how lookups were answered.
+func cacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, stream.GetCacheInfo())
+}
+
+// getCachedPath shows the cached entry of one media source.
+func getCachedPath(c *gin.Context) {
+	server, ok := serverParam(c)
+	if !ok {
+		return
+	}
+	cached, found := stream.LookupCachedPath(server, c.Param("itemID"), c.Param("mediaSourceID"))
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not cached"})
+		return
+	}
+	c.JSON(http.StatusOK, cached)
+}
+
+// deleteCachedItem evicts every cached media source of an item.
+func deleteCachedItem(c *gin.Context) {
+	server, ok := serverParam(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"removed": stream.DeleteCachedItem(server, c.Param("itemID"))})
+}
+
+// deleteCachedPaths evicts the cached media sources under the path given by the prefix parameter.
+func deleteCachedPaths(c *gin.Context) {
+	server, ok := serverParam(c)
+	if !ok {
+		return
+	}
+	prefix := c.Query("prefix")
+	if prefix == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "prefix is required"})
+		return
+	}
+	removed, err := stream.DeleteCachedUnder(server, prefix)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "removed": removed})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"removed": removed})
+}
+
+// flushCache empties the path cache of every server.
+func flushCache(c *gin.Context) {
+	if err := stream.FlushCache(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,33 @@
+package admin
+
+import (
+	"Go_Frontend/geoip"
+	"Go_Frontend/stream"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// testRoute reports how a path, or an itemId/mediaSourceId pair, would be routed.
+// The optional ip parameter simulates a client for GeoIP mirror selection and
+// server selects the media server (the default server otherwise).
+func testRoute(c *gin.Context) {
+	server, ok := serverParam(c)
+	if !ok {
+		return
+	}
+
+	mediaPath := c.Query("path")
+	itemID := c.Query("itemId")
+	mediaSourceID := c.Query("mediaSourceId")
+	if mediaPath == "" && (itemID == "" || mediaSourceID == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "path or itemId and mediaSourceId are required"})
+		return
+	}
+
+	var location geoip.Location
+	if ip := c.Query("ip"); ip != "" {
+		location = geoip.Lookup(ip)
+	}
+
+	c.JSON(http.StatusOK, stream.DryRun(c.Request.Context(), server, itemID, mediaSourceID, mediaPath, location))
+}
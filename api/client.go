@@ -0,0 +1,265 @@
+package api
+
+import (
+	"Go_Frontend/config"
+	"Go_Frontend/logger"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CallType classifies media server calls so each class gets its own timeout and latency history.
+type CallType string
+
+const (
+	CallPlaybackInfo CallType = "playbackInfo" // PlaybackInfo lookups on the playback start path
+	CallAuth         CallType = "auth"         // client token validation
+	CallItems        CallType = "items"        // item, ancestor and other library queries
+)
+
+// Defaults used when the config leaves a value unset.
+const (
+	defaultPlaybackInfoTimeout = 5 * time.Second
+	defaultAuthTimeout         = 3 * time.Second
+	defaultItemsTimeout        = 10 * time.Second
+	defaultRetryBackoff        = 100 * time.Millisecond
+	defaultHedgePercentile     = 95
+	minHedgeDelay              = 20 * time.Millisecond
+	latencySamples             = 128
+)
+
+// statusError is a non-200 response that was not mapped to a sentinel error.
+type statusError struct {
+	status int
+	path   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status %d from %s", e.status, e.path)
+}
+
+// retryable reports whether an attempt may succeed if repeated: transport errors,
+// 5xx and 429 are retried, while auth failures, 404s and errors from decoding a 200 are not.
+func retryable(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.status >= 500 || se.status == http.StatusTooManyRequests
+	}
+	var pe *permanentError
+	if errors.As(err, &pe) {
+		return false
+	}
+	return !errors.Is(err, ErrUnauthorized) && !errors.Is(err, ErrNotFound) && !errors.Is(err, context.Canceled)
+}
+
+// permanentError marks an error from decoding a 200 response, which a retry cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// latencyTracker keeps a ring of recent successful call durations for hedging.
+type latencyTracker struct {
+	mu      sync.Mutex
+	samples [latencySamples]time.Duration
+	n       int
+	next    int
+}
+
+func (t *latencyTracker) record(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples[t.next] = d
+	t.next = (t.next + 1) % latencySamples
+	if t.n < latencySamples {
+		t.n++
+	}
+}
+
+// percentile returns the p-th percentile of recorded latencies, or false with too little history.
+func (t *latencyTracker) percentile(p float64) (time.Duration, bool) {
+	t.mu.Lock()
+	if t.n < 10 {
+		t.mu.Unlock()
+		return 0, false
+	}
+	sorted := make([]time.Duration, t.n)
+	copy(sorted, t.samples[:t.n])
+	t.mu.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(float64(len(sorted)-1) * p / 100)
+	return sorted[i], true
+}
+
+var (
+	trackersMu sync.Mutex
+	trackers   = map[CallType]*latencyTracker{}
+)
+
+func trackerFor(call CallType) *latencyTracker {
+	trackersMu.Lock()
+	defer trackersMu.Unlock()
+	t, ok := trackers[call]
+	if !ok {
+		t = &latencyTracker{}
+		trackers[call] = t
+	}
+	return t
+}
+
+func timeoutFor(call CallType) time.Duration {
+	timeouts := config.GetConfig().EmbyClient.Timeouts
+	switch call {
+	case CallPlaybackInfo:
+		if timeouts.PlaybackInfo > 0 {
+			return timeouts.PlaybackInfo
+		}
+		return defaultPlaybackInfoTimeout
+	case CallAuth:
+		if timeouts.Auth > 0 {
+			return timeouts.Auth
+		}
+		return defaultAuthTimeout
+	default:
+		if timeouts.Items > 0 {
+			return timeouts.Items
+		}
+		return defaultItemsTimeout
+	}
+}
+
+// call runs an idempotent request with the per-call-type timeout, retrying with jittered
+// exponential backoff and, when enabled, hedging a second attempt once the first has been
+// running longer than the configured latency percentile. build is invoked once per attempt
+// with that attempt's context; decode runs on a 200 response before its body is closed.
+func call[T any](ctx context.Context, client *http.Client, callType CallType,
+	build func(ctx context.Context) (*http.Request, error),
+	decode func(resp *http.Response) (T, error)) (T, error) {
+
+	cfg := config.GetConfig().EmbyClient
+	backoff := cfg.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+
+	var result T
+	var err error
+	for attempt := 0; attempt <= cfg.Retries; attempt++ {
+		if attempt > 0 {
+			// Full jitter: sleep a random duration up to the exponential backoff
+			wait := time.Duration(rand.Int64N(int64(backoff<<(attempt-1)) + 1))
+			logger.Warn("Retrying %s call in %v (attempt %d): %v", callType, wait, attempt+1, err)
+			select {
+			case <-ctx.Done():
+				return result, ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+
+		result, err = hedged(ctx, client, callType, cfg, build, decode)
+		if err == nil || !retryable(err) || ctx.Err() != nil {
+			return result, err
+		}
+	}
+	return result, err
+}
+
+type attemptResult[T any] struct {
+	value T
+	err   error
+}
+
+// hedged runs one attempt, plus a second one if hedging is enabled and the first is slow.
+func hedged[T any](ctx context.Context, client *http.Client, callType CallType, cfg config.EmbyClientConfig,
+	build func(ctx context.Context) (*http.Request, error),
+	decode func(resp *http.Response) (T, error)) (T, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, timeoutFor(callType))
+	defer cancel() // also stops the losing attempt
+
+	tracker := trackerFor(callType)
+	results := make(chan attemptResult[T], 2)
+	launch := func() {
+		go func() {
+			start := time.Now()
+			value, err := attempt(ctx, client, build, decode)
+			if err == nil {
+				tracker.record(time.Since(start))
+			}
+			results <- attemptResult[T]{value, err}
+		}()
+	}
+	launch()
+	inFlight := 1
+
+	var hedgeTimer <-chan time.Time
+	if cfg.Hedge {
+		percentile := cfg.HedgePercentile
+		if percentile <= 0 || percentile >= 100 {
+			percentile = defaultHedgePercentile
+		}
+		if delay, ok := tracker.percentile(percentile); ok {
+			hedgeTimer = time.After(max(delay, minHedgeDelay))
+		}
+	}
+
+	var last attemptResult[T]
+	for inFlight > 0 {
+		select {
+		case <-hedgeTimer:
+			hedgeTimer = nil
+			logger.Debug("Hedging slow %s call", callType)
+			launch()
+			inFlight++
+		case r := <-results:
+			inFlight--
+			if r.err == nil {
+				return r.value, nil
+			}
+			last = r
+			// A failed first attempt does not wait for the hedge timer
+			hedgeTimer = nil
+		}
+	}
+	return last.value, last.err
+}
+
+// attempt performs a single request and maps the response status onto package errors.
+func attempt[T any](ctx context.Context, client *http.Client,
+	build func(ctx context.Context) (*http.Request, error),
+	decode func(resp *http.Response) (T, error)) (T, error) {
+
+	var zero T
+	req, err := build(ctx)
+	if err != nil {
+		return zero, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return zero, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return zero, ErrUnauthorized
+	case resp.StatusCode == http.StatusNotFound:
+		return zero, ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return zero, &statusError{status: resp.StatusCode, path: req.URL.Path}
+	}
+
+	value, err := decode(resp)
+	if err != nil {
+		return zero, &permanentError{err: err}
+	}
+	return value, nil
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"Go_Frontend/config"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func setClientConfig(t *testing.T, cfg config.EmbyClientConfig) {
+	t.Helper()
+	previous := config.GetConfig().EmbyClient
+	config.GetConfig().EmbyClient = cfg
+	t.Cleanup(func() { config.GetConfig().EmbyClient = previous })
+}
+
+func TestCallRetriesServerErrors(t *testing.T) {
+	setClientConfig(t, config.EmbyClientConfig{Retries: 2, RetryBackoff: time.Millisecond})
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"Id":"1","Name":"alice"}`))
+	}))
+	defer server.Close()
+
+	api := &EmbyAPI{EmbyURL: server.URL, APIKey: "k", Client: server.Client()}
+	item, err := api.GetUserItem(context.Background(), "u", "1")
+	if err != nil || item.Name != "alice" {
+		t.Fatalf("GetUserItem = %+v, %v", item, err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Fatalf("server saw %d requests, want 3", n)
+	}
+}
+
+func TestCallDoesNotRetryNotFound(t *testing.T) {
+	setClientConfig(t, config.EmbyClientConfig{Retries: 2, RetryBackoff: time.Millisecond})
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	api := &EmbyAPI{EmbyURL: server.URL, APIKey: "k", Client: server.Client()}
+	if _, err := api.GetUserItem(context.Background(), "u", "1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("server saw %d requests, want 1", n)
+	}
+}
+
+func TestCallHedgesSlowRequests(t *testing.T) {
+	setClientConfig(t, config.EmbyClientConfig{Hedge: true, HedgePercentile: 95})
+
+	tracker := trackerFor(CallItems)
+	for i := 0; i < latencySamples; i++ {
+		tracker.record(time.Millisecond)
+	}
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+			return
+		}
+		w.Write([]byte(`{"Id":"1","Name":"alice"}`))
+	}))
+	defer server.Close()
+
+	api := &EmbyAPI{EmbyURL: server.URL, APIKey: "k", Client: server.Client()}
+	start := time.Now()
+	if _, err := api.GetUserItem(context.Background(), "u", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("hedged call took %v, the slow attempt was not hedged", elapsed)
+	}
+}
+
+func TestCallHonoursCancellation(t *testing.T) {
+	setClientConfig(t, config.EmbyClientConfig{Retries: 2})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	api := &EmbyAPI{EmbyURL: server.URL, APIKey: "k", Client: server.Client()}
+	start := time.Now()
+	if _, err := api.GetUserItem(ctx, "u", "1"); err == nil {
+		t.Fatal("expected an error after cancellation")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("cancelled call took %v", elapsed)
+	}
+}
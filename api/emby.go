@@ -3,19 +3,16 @@ package api
 import (
 	"Go_Frontend/config"
 	"Go_Frontend/logger"
-	"errors"
+	"context"
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
-
-	// ✅ 优化: 引入高性能 JSON 库替代标准库
-	// 需先运行: go get github.com/goccy/go-json
-	"github.com/goccy/go-json"
 )
 
 // 全局复用 Client
+// 超时由每次调用的 context 控制 (见 client.go)，这里不再设置固定的 Timeout
 var globalClient = &http.Client{
-	Timeout: 10 * time.Second,
 	Transport: &http.Transport{
 		MaxIdleConns:        1000,
 		MaxIdleConnsPerHost: 100,
@@ -29,54 +26,83 @@ type EmbyAPI struct {
 	Client  *http.Client
 }
 
-func NewEmbyAPI() *EmbyAPI {
-	cfg := config.GetConfig()
+func NewEmbyAPI(server *config.ServerConfig) *EmbyAPI {
 	return &EmbyAPI{
-		EmbyURL: config.GetFullEmbyURL(),
-		APIKey:  cfg.EmbyAPIKey,
+		EmbyURL: server.FullURL(),
+		APIKey:  server.APIKey,
 		Client:  globalClient,
 	}
 }
 
-// GetMediaPath 获取媒体路径
-func (api *EmbyAPI) GetMediaPath(itemID, mediaSourceID string) (string, error) {
-	url := fmt.Sprintf("%s/Items/%s/PlaybackInfo?MediaSourceId=%s&api_key=%s",
-		api.EmbyURL, itemID, mediaSourceID, api.APIKey)
+// requestBuilder 返回为每次尝试创建请求的函数，token 通过 X-Emby-Token 请求头发送，不出现在 URL 中
+func (api *EmbyAPI) requestBuilder(token, path string, query url.Values) func(ctx context.Context) (*http.Request, error) {
+	reqURL := api.EmbyURL + path
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+	return func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Emby-Token", token)
+		return req, nil
+	}
+}
 
-	logger.Debug("Fetching media path: %s", url)
+// GetMediaSource 获取媒体源的路径和元数据
+func (api *EmbyAPI) GetMediaSource(ctx context.Context, itemID, mediaSourceID string) (*MediaSourceInfo, error) {
+	path := fmt.Sprintf("/Items/%s/PlaybackInfo", url.PathEscape(itemID))
+	logger.Debug("Fetching media source: %s%s?MediaSourceId=%s", api.EmbyURL, path, mediaSourceID)
 
-	resp, err := api.Client.Get(url)
+	source, err := call(ctx, api.Client, CallPlaybackInfo,
+		api.requestBuilder(api.APIKey, path, url.Values{"MediaSourceId": {mediaSourceID}}),
+		decodeMediaSource(mediaSourceID))
 	if err != nil {
 		logger.Error("Failed to fetch media path: %v", err)
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
+	logger.Info("Found media path: %s", source.Path)
+	return source, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		logger.Error("Received non-200 response from Emby: %d", resp.StatusCode)
-		return "", errors.New("failed to fetch media path")
-	}
+// GetMediaSources 获取条目的所有媒体源
+func (api *EmbyAPI) GetMediaSources(ctx context.Context, itemID string) ([]MediaSourceInfo, error) {
+	path := fmt.Sprintf("/Items/%s/PlaybackInfo", url.PathEscape(itemID))
+	return call(ctx, api.Client, CallPlaybackInfo, api.requestBuilder(api.APIKey, path, nil), decodeMediaSources)
+}
 
-	// ✅ 优化: 流式解析 JSON
-	// 避免 io.ReadAll 读取整个 Body 到内存，大幅降低 GC 压力
-	var result struct {
-		MediaSources []struct {
-			ID   string `json:"Id"`
-			Path string `json:"Path"`
-		} `json:"MediaSources"`
-	}
-	
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		logger.Error("Failed to decode Emby response: %v", err)
-		return "", err
-	}
+// GetUserItem 以指定用户的视角查询条目，用户不可见时返回 ErrNotFound
+func (api *EmbyAPI) GetUserItem(ctx context.Context, userID, itemID string) (*Item, error) {
+	path := fmt.Sprintf("/Users/%s/Items/%s", url.PathEscape(userID), url.PathEscape(itemID))
+	return call(ctx, api.Client, CallItems, api.requestBuilder(api.APIKey, path, nil), decodeItem)
+}
 
-	for _, source := range result.MediaSources {
-		if source.ID == mediaSourceID {
-			logger.Info("Found media path: %s", source.Path)
-			return source.Path, nil
-		}
-	}
+// GetAncestors 查询条目的上级目录，用于判断所属媒体库
+func (api *EmbyAPI) GetAncestors(ctx context.Context, userID, itemID string) ([]Item, error) {
+	path := fmt.Sprintf("/Items/%s/Ancestors", url.PathEscape(itemID))
+	return call(ctx, api.Client, CallItems, api.requestBuilder(api.APIKey, path, url.Values{"UserId": {userID}}), decodeJSON[[]Item]())
+}
+
+// GetParentalRatings 查询分级对照表
+func (api *EmbyAPI) GetParentalRatings(ctx context.Context) ([]ParentalRating, error) {
+	return call(ctx, api.Client, CallItems, api.requestBuilder(api.APIKey, "/Localization/ParentalRatings", nil), decodeJSON[[]ParentalRating]())
+}
+
+// GetCurrentUser 使用客户端令牌查询当前用户，令牌无效时返回 ErrUnauthorized
+func (api *EmbyAPI) GetCurrentUser(ctx context.Context, token string) (*User, error) {
+	return call(ctx, api.Client, CallAuth, api.requestBuilder(token, "/Users/Me", nil), decodeCurrentUser)
+}
+
+// ListItems 分页列出所有可播放条目及其媒体源路径
+func (api *EmbyAPI) ListItems(ctx context.Context, query LibraryQuery) (*LibraryPage, error) {
+	values := query.values()
+	return call(ctx, api.Client, CallItems, api.requestBuilder(api.APIKey, "/Items", values), decodeJSON[*LibraryPage]())
+}
 
-	return "", errors.New("media source not found")
+// ListUpcoming 查询用户的继续观看和下一集列表，用于预热路径缓存
+func (api *EmbyAPI) ListUpcoming(ctx context.Context, userID string, limit int) ([]LibraryItem, error) {
+	return listUpcoming(ctx, api.Client, userID, limit, func(path string, query url.Values) func(ctx context.Context) (*http.Request, error) {
+		return api.requestBuilder(api.APIKey, path, query)
+	})
 }
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"Go_Frontend/config"
+	"Go_Frontend/logger"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+type JellyfinAPI struct {
+	JellyfinURL string
+	APIKey      string
+	UserID      string
+	Client      *http.Client
+}
+
+func NewJellyfinAPI(server *config.ServerConfig) *JellyfinAPI {
+	return &JellyfinAPI{
+		JellyfinURL: server.FullURL(),
+		APIKey:      server.APIKey,
+		UserID:      server.UserID,
+		Client:      globalClient,
+	}
+}
+
+// authorizationHeader builds the MediaBrowser authorization scheme Jellyfin expects.
+func authorizationHeader(token string) string {
+	return fmt.Sprintf(`MediaBrowser Client="Go_Frontend", Device="Go_Frontend", DeviceId="go-frontend", Version="1.0.0", Token="%s"`, token)
+}
+
+// requestBuilder 返回为每次尝试创建请求的函数，token 通过 Authorization 请求头发送
+func (api *JellyfinAPI) requestBuilder(token, path string, query url.Values) func(ctx context.Context) (*http.Request, error) {
+	reqURL := api.JellyfinURL + path
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+	return func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", authorizationHeader(token))
+		return req, nil
+	}
+}
+
+// GetMediaSource 获取媒体源的路径和元数据
+// Jellyfin 10.8 requires a userId for PlaybackInfo, later versions accept the API key alone.
+func (api *JellyfinAPI) GetMediaSource(ctx context.Context, itemID, mediaSourceID string) (*MediaSourceInfo, error) {
+	query := url.Values{}
+	query.Set("MediaSourceId", mediaSourceID)
+	if api.UserID != "" {
+		query.Set("UserId", api.UserID)
+	}
+	path := fmt.Sprintf("/Items/%s/PlaybackInfo", url.PathEscape(itemID))
+	logger.Debug("Fetching media source: %s%s?%s", api.JellyfinURL, path, query.Encode())
+
+	source, err := call(ctx, api.Client, CallPlaybackInfo, api.requestBuilder(api.APIKey, path, query), decodeMediaSource(mediaSourceID))
+	if err != nil {
+		logger.Error("Failed to fetch media path: %v", err)
+		return nil, err
+	}
+	logger.Info("Found media path: %s", source.Path)
+	return source, nil
+}
+
+// GetMediaSources 获取条目的所有媒体源
+func (api *JellyfinAPI) GetMediaSources(ctx context.Context, itemID string) ([]MediaSourceInfo, error) {
+	query := url.Values{}
+	if api.UserID != "" {
+		query.Set("UserId", api.UserID)
+	}
+	path := fmt.Sprintf("/Items/%s/PlaybackInfo", url.PathEscape(itemID))
+	return call(ctx, api.Client, CallPlaybackInfo, api.requestBuilder(api.APIKey, path, query), decodeMediaSources)
+}
+
+// GetUserItem 以指定用户的视角查询条目，用户不可见时返回 ErrNotFound
+func (api *JellyfinAPI) GetUserItem(ctx context.Context, userID, itemID string) (*Item, error) {
+	path := fmt.Sprintf("/Users/%s/Items/%s", url.PathEscape(userID), url.PathEscape(itemID))
+	return call(ctx, api.Client, CallItems, api.requestBuilder(api.APIKey, path, nil), decodeItem)
+}
+
+// GetAncestors 查询条目的上级目录，用于判断所属媒体库
+func (api *JellyfinAPI) GetAncestors(ctx context.Context, userID, itemID string) ([]Item, error) {
+	path := fmt.Sprintf("/Items/%s/Ancestors", url.PathEscape(itemID))
+	return call(ctx, api.Client, CallItems, api.requestBuilder(api.APIKey, path, url.Values{"userId": {userID}}), decodeJSON[[]Item]())
+}
+
+// GetParentalRatings 查询分级对照表
+func (api *JellyfinAPI) GetParentalRatings(ctx context.Context) ([]ParentalRating, error) {
+	return call(ctx, api.Client, CallItems, api.requestBuilder(api.APIKey, "/Localization/ParentalRatings", nil), decodeJSON[[]ParentalRating]())
+}
+
+// GetCurrentUser 使用客户端令牌查询当前用户，令牌无效时返回 ErrUnauthorized
+func (api *JellyfinAPI) GetCurrentUser(ctx context.Context, token string) (*User, error) {
+	return call(ctx, api.Client, CallAuth, api.requestBuilder(token, "/Users/Me", nil), decodeCurrentUser)
+}
+
+// ListItems 分页列出所有可播放条目及其媒体源路径
+// Jellyfin 10.8 requires a userId for /Items, later versions accept the API key alone.
+func (api *JellyfinAPI) ListItems(ctx context.Context, query LibraryQuery) (*LibraryPage, error) {
+	values := query.values()
+	if api.UserID != "" {
+		values.Set("UserId", api.UserID)
+	}
+	return call(ctx, api.Client, CallItems, api.requestBuilder(api.APIKey, "/Items", values), decodeJSON[*LibraryPage]())
+}
+
+// ListUpcoming 查询用户的继续观看和下一集列表，用于预热路径缓存
+func (api *JellyfinAPI) ListUpcoming(ctx context.Context, userID string, limit int) ([]LibraryItem, error) {
+	return listUpcoming(ctx, api.Client, userID, limit, func(path string, query url.Values) func(ctx context.Context) (*http.Request, error) {
+		return api.requestBuilder(api.APIKey, path, query)
+	})
+}
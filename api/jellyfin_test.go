@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newRecordedJellyfin serves a recorded PlaybackInfo response and checks the request shape.
+func newRecordedJellyfin(t *testing.T, fixture string) *JellyfinAPI {
+	t.Helper()
+	body, err := os.ReadFile("testdata/" + fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/Items/") || !strings.HasSuffix(r.URL.Path, "/PlaybackInfo") {
+			http.NotFound(w, r)
+			return
+		}
+		if auth := r.Header.Get("Authorization"); !strings.HasPrefix(auth, "MediaBrowser ") || !strings.Contains(auth, `Token="test-key"`) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("api_key") != "" {
+			t.Error("API key must not be sent in the query string")
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+
+	return &JellyfinAPI{JellyfinURL: server.URL, APIKey: "test-key", Client: server.Client()}
+}
+
+func TestJellyfinGetMediaSource(t *testing.T) {
+	api := newRecordedJellyfin(t, "jellyfin_playbackinfo.json")
+
+	cases := []struct {
+		mediaSourceID string
+		want          string
+	}{
+		{"f2a1c6e04b9d4c8a8e2b7d5f3c1a9e07", "/mnt/gd/TV/Example Show/Season 01/Example Show - S01E01 - 2160p.mkv"},
+		// Dashed, upper-case GUIDs as sent by some clients
+		{"0C9E2D1B-7A6F-4E3D-9B8C-5A4F2E1D0C9B", "/mnt/gd2/TV/Example Show/Season 01/Example Show - S01E01 - 1080p.mkv"},
+	}
+	for _, tc := range cases {
+		got, err := api.GetMediaSource(context.Background(), "4e5c0c2a9f1b4b7e8d6a3c2b1a0f9e8d", tc.mediaSourceID)
+		if err != nil {
+			t.Fatalf("GetMediaSource(%s): %v", tc.mediaSourceID, err)
+		}
+		if got.Path != tc.want {
+			t.Errorf("GetMediaSource(%s).Path = %q, want %q", tc.mediaSourceID, got.Path, tc.want)
+		}
+	}
+
+	if _, err := api.GetMediaSource(context.Background(), "4e5c0c2a9f1b4b7e8d6a3c2b1a0f9e8d", "ffffffffffffffffffffffffffffffff"); err == nil {
+		t.Error("expected an error for an unknown media source")
+	}
+}
+
+func TestJellyfinGetMediaSourceMetadata(t *testing.T) {
+	api := newRecordedJellyfin(t, "jellyfin_playbackinfo.json")
+
+	source, err := api.GetMediaSource(context.Background(), "4e5c0c2a9f1b4b7e8d6a3c2b1a0f9e8d", "f2a1c6e04b9d4c8a8e2b7d5f3c1a9e07")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source.PrimaryContainer() != "mkv" || source.Size != 8231459871 || source.Bitrate != 24940221 {
+		t.Errorf("metadata = %+v", source)
+	}
+	if source.Duration() != 2640417*time.Millisecond {
+		t.Errorf("Duration() = %v", source.Duration())
+	}
+	if len(source.MediaStreams) != 2 || source.MediaStreams[0].Codec != "hevc" || source.MediaStreams[1].Channels != 6 {
+		t.Errorf("MediaStreams = %+v", source.MediaStreams)
+	}
+}
+
+func TestJellyfinGetMediaSourceErrorCode(t *testing.T) {
+	api := newRecordedJellyfin(t, "jellyfin_playbackinfo_error.json")
+
+	_, err := api.GetMediaSource(context.Background(), "4e5c0c2a9f1b4b7e8d6a3c2b1a0f9e8d", "f2a1c6e04b9d4c8a8e2b7d5f3c1a9e07")
+	if err == nil || !strings.Contains(err.Error(), "NoCompatibleStream") {
+		t.Fatalf("expected NoCompatibleStream error, got %v", err)
+	}
+}
+
+func TestJellyfinGetMediaSourceUnauthorized(t *testing.T) {
+	api := newRecordedJellyfin(t, "jellyfin_playbackinfo.json")
+	api.APIKey = "wrong-key"
+
+	if _, err := api.GetMediaSource(context.Background(), "4e5c0c2a9f1b4b7e8d6a3c2b1a0f9e8d", "f2a1c6e04b9d4c8a8e2b7d5f3c1a9e07"); err == nil {
+		t.Fatal("expected an error for a rejected token")
+	}
+}
+
+func TestJellyfinGetMediaSources(t *testing.T) {
+	api := newRecordedJellyfin(t, "jellyfin_playbackinfo.json")
+
+	sources, err := api.GetMediaSources(context.Background(), "4e5c0c2a9f1b4b7e8d6a3c2b1a0f9e8d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 2 {
+		t.Fatalf("got %d media sources, want 2", len(sources))
+	}
+	if s := sources[0]; s.ID != "f2a1c6e04b9d4c8a8e2b7d5f3c1a9e07" || s.Container != "mkv" || s.Bitrate != 24940221 {
+		t.Errorf("first media source = %+v", s)
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// LibraryQuery selects one page of the recursive library listing.
+type LibraryQuery struct {
+	StartIndex int
+	Limit      int
+	// MinDateLastSaved restricts the listing to items saved at or after this time; zero lists everything.
+	MinDateLastSaved time.Time
+}
+
+// LibraryPage is one page of the library listing.
+type LibraryPage struct {
+	Items            []LibraryItem `json:"Items"`
+	TotalRecordCount int           `json:"TotalRecordCount"`
+}
+
+// LibraryItem is a playable item together with the paths of its media sources.
+type LibraryItem struct {
+	ID           string            `json:"Id"`
+	Path         string            `json:"Path"`
+	MediaSources []MediaSourceInfo `json:"MediaSources"`
+}
+
+// values encodes the query for /Items. Folders are skipped since only their children are playable.
+func (q LibraryQuery) values() url.Values {
+	values := url.Values{
+		"Recursive":  {"true"},
+		"IsFolder":   {"false"},
+		"Fields":     {"Path,MediaSources"},
+		"SortBy":     {"DateCreated,SortName"},
+		"StartIndex": {strconv.Itoa(q.StartIndex)},
+		"Limit":      {strconv.Itoa(q.Limit)},
+	}
+	if !q.MinDateLastSaved.IsZero() {
+		values.Set("MinDateLastSaved", q.MinDateLastSaved.UTC().Format(time.RFC3339))
+	}
+	return values
+}
+
+// listUpcoming queries the "Next Up" and "Continue Watching" lists that Emby and Jellyfin share,
+// resumable items first. build creates the request for a path and query with the server's API key.
+func listUpcoming(ctx context.Context, client *http.Client, userID string, limit int,
+	build func(path string, query url.Values) func(ctx context.Context) (*http.Request, error)) ([]LibraryItem, error) {
+
+	fields := url.Values{
+		"Fields": {"Path,MediaSources"},
+		"Limit":  {strconv.Itoa(limit)},
+	}
+	resume := url.Values{"MediaTypes": {"Video"}}
+	nextUp := url.Values{"UserId": {userID}}
+	for key, values := range fields {
+		resume[key], nextUp[key] = values, values
+	}
+
+	var items []LibraryItem
+	for _, list := range []struct {
+		path  string
+		query url.Values
+	}{
+		{fmt.Sprintf("/Users/%s/Items/Resume", url.PathEscape(userID)), resume},
+		{"/Shows/NextUp", nextUp},
+	} {
+		page, err := call(ctx, client, CallItems, build(list.path, list.query), decodeJSON[*LibraryPage]())
+		if err != nil {
+			return items, err
+		}
+		items = append(items, page.Items...)
+	}
+	return items, nil
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"strings"
+	"time"
+)
+
+// MediaSourceInfo is one version of an item's media, as returned by PlaybackInfo and by /Items
+// with the MediaSources field.
+type MediaSourceInfo struct {
+	ID           string        `json:"Id"`
+	Path         string        `json:"Path"`
+	Name         string        `json:"Name,omitempty"`
+	Protocol     string        `json:"Protocol,omitempty"` // File or Http
+	IsRemote     bool          `json:"IsRemote,omitempty"`
+	Container    string        `json:"Container,omitempty"` // may list several, e.g. "mkv,webm"
+	Size         int64         `json:"Size,omitempty"`      // bytes, 0 when unknown
+	Bitrate      int64         `json:"Bitrate,omitempty"`   // bits per second, 0 when unknown
+	RunTimeTicks int64         `json:"RunTimeTicks,omitempty"`
+	MediaStreams []MediaStream `json:"MediaStreams,omitempty"`
+}
+
+// MediaStream is a video, audio or subtitle stream of a media source.
+type MediaStream struct {
+	Type         string `json:"Type"` // Video, Audio, Subtitle
+	Index        int    `json:"Index"`
+	Codec        string `json:"Codec,omitempty"`
+	Language     string `json:"Language,omitempty"`
+	DisplayTitle string `json:"DisplayTitle,omitempty"`
+	BitRate      int64  `json:"BitRate,omitempty"`
+	Width        int    `json:"Width,omitempty"`
+	Height       int    `json:"Height,omitempty"`
+	Channels     int    `json:"Channels,omitempty"`
+	IsDefault    bool   `json:"IsDefault,omitempty"`
+	IsExternal   bool   `json:"IsExternal,omitempty"`
+}
+
+// ticksPerSecond is the resolution of RunTimeTicks (100ns ticks, as in .NET).
+const ticksPerSecond = 10_000_000
+
+// Duration returns the run time of the media, or 0 when unknown.
+func (s *MediaSourceInfo) Duration() time.Duration {
+	return time.Duration(s.RunTimeTicks) * (time.Second / ticksPerSecond)
+}
+
+// PrimaryContainer returns the first container of the list, lowercased.
+func (s *MediaSourceInfo) PrimaryContainer() string {
+	container, _, _ := strings.Cut(s.Container, ",")
+	return strings.ToLower(strings.TrimSpace(container))
+}
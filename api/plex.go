@@ -0,0 +1,279 @@
+package api
+
+import (
+	"Go_Frontend/config"
+	"Go_Frontend/logger"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// errPlexUnsupported is returned for Emby user/library queries that Plex has no equivalent for.
+// Plex clients are authorized by fetching the item's metadata with their own token instead.
+var errPlexUnsupported = fmt.Errorf("%w by Plex", errors.ErrUnsupported)
+
+// plexItemTypes maps the library section types to the playable item type listed for the index:
+// movies, episodes of shows and tracks of artists.
+var plexItemTypes = map[string]string{
+	"movie":  "1",
+	"show":   "4",
+	"artist": "10",
+}
+
+type PlexAPI struct {
+	PlexURL string
+	Token   string
+	Client  *http.Client
+}
+
+func NewPlexAPI(server *config.ServerConfig) *PlexAPI {
+	return &PlexAPI{
+		PlexURL: server.FullURL(),
+		Token:   server.APIKey,
+		Client:  globalClient,
+	}
+}
+
+// PlexMetadata is an item of /library/metadata/{ratingKey} with its media and their parts.
+type PlexMetadata struct {
+	RatingKey string      `json:"ratingKey"`
+	Title     string      `json:"title"`
+	Duration  int64       `json:"duration"` // milliseconds
+	Media     []PlexMedia `json:"Media"`
+}
+
+// PlexMedia is one version of a Plex item. Each version consists of one or more parts (files).
+type PlexMedia struct {
+	ID        int64      `json:"id"`
+	Container string     `json:"container"`
+	Bitrate   int64      `json:"bitrate"`  // kbps
+	Duration  int64      `json:"duration"` // milliseconds
+	Part      []PlexPart `json:"Part"`
+}
+
+// PlexPart is a file of a Plex media, addressed by clients as /library/parts/{id}/{ts}/file.{ext}.
+type PlexPart struct {
+	ID        int64  `json:"id"`
+	File      string `json:"file"`
+	Container string `json:"container"`
+	Size      int64  `json:"size"`
+	Duration  int64  `json:"duration"` // milliseconds
+}
+
+// plexContainer is the JSON envelope of every Plex response.
+type plexContainer struct {
+	MediaContainer struct {
+		Size      int             `json:"size"`
+		TotalSize int             `json:"totalSize"`
+		Metadata  []PlexMetadata  `json:"Metadata"`
+		Directory []plexDirectory `json:"Directory"`
+	} `json:"MediaContainer"`
+}
+
+// plexDirectory is a library section of /library/sections.
+type plexDirectory struct {
+	Key  string `json:"key"`
+	Type string `json:"type"`
+}
+
+// MediaSources flattens the parts of every media into media sources keyed by part ID.
+func (m *PlexMetadata) MediaSources() []MediaSourceInfo {
+	var sources []MediaSourceInfo
+	for _, media := range m.Media {
+		for _, part := range media.Part {
+			sources = append(sources, media.source(part, m.Duration))
+		}
+	}
+	return sources
+}
+
+// Part returns the part partIndex of the media mediaIndex, as selected by a transcode request.
+func (m *PlexMetadata) Part(mediaIndex, partIndex int) (MediaSourceInfo, bool) {
+	if mediaIndex < 0 || mediaIndex >= len(m.Media) {
+		return MediaSourceInfo{}, false
+	}
+	media := m.Media[mediaIndex]
+	if partIndex < 0 || partIndex >= len(media.Part) {
+		return MediaSourceInfo{}, false
+	}
+	return media.source(media.Part[partIndex], m.Duration), true
+}
+
+// source converts a part to a media source. Plex reports durations in milliseconds and bitrates in kbps.
+func (media PlexMedia) source(part PlexPart, itemDuration int64) MediaSourceInfo {
+	container := part.Container
+	if container == "" {
+		container = media.Container
+	}
+	duration := part.Duration
+	if duration == 0 {
+		duration = media.Duration
+	}
+	if duration == 0 {
+		duration = itemDuration
+	}
+	return MediaSourceInfo{
+		ID:           strconv.FormatInt(part.ID, 10),
+		Path:         part.File,
+		Protocol:     "File",
+		Container:    container,
+		Size:         part.Size,
+		Bitrate:      media.Bitrate * 1000,
+		RunTimeTicks: duration * (ticksPerSecond / 1000),
+	}
+}
+
+// requestBuilder 返回为每次尝试创建请求的函数，token 通过 X-Plex-Token 请求头发送，并要求返回 JSON
+func (api *PlexAPI) requestBuilder(token, path string, query url.Values) func(ctx context.Context) (*http.Request, error) {
+	reqURL := api.PlexURL + path
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+	return func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Plex-Token", token)
+		req.Header.Set("Accept", "application/json")
+		return req, nil
+	}
+}
+
+// GetMetadata 使用 token 查询条目的元数据。使用客户端令牌时，令牌无效返回 ErrUnauthorized，
+// 条目对该用户不可见 (未共享的媒体库) 返回 ErrUnauthorized 或 ErrNotFound
+func (api *PlexAPI) GetMetadata(ctx context.Context, token, ratingKey string) (*PlexMetadata, error) {
+	path := "/library/metadata/" + url.PathEscape(ratingKey)
+	logger.Debug("Fetching Plex metadata: %s%s", api.PlexURL, path)
+
+	container, err := call(ctx, api.Client, CallPlaybackInfo, api.requestBuilder(token, path, nil), decodeJSON[plexContainer]())
+	if err != nil {
+		return nil, err
+	}
+	if len(container.MediaContainer.Metadata) == 0 {
+		return nil, ErrNotFound
+	}
+	return &container.MediaContainer.Metadata[0], nil
+}
+
+// GetMediaSource 获取 part 的文件路径和元数据，mediaSourceID 为 part ID
+func (api *PlexAPI) GetMediaSource(ctx context.Context, itemID, mediaSourceID string) (*MediaSourceInfo, error) {
+	sources, err := api.GetMediaSources(ctx, itemID)
+	if err != nil {
+		logger.Error("Failed to fetch media path: %v", err)
+		return nil, err
+	}
+	for i := range sources {
+		if sources[i].ID == mediaSourceID {
+			logger.Info("Found media path: %s", sources[i].Path)
+			return &sources[i], nil
+		}
+	}
+	return nil, ErrMediaSourceNotFound
+}
+
+// GetMediaSources 获取条目所有 media 的所有 part
+func (api *PlexAPI) GetMediaSources(ctx context.Context, itemID string) ([]MediaSourceInfo, error) {
+	metadata, err := api.GetMetadata(ctx, api.Token, itemID)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.MediaSources(), nil
+}
+
+// GetCurrentUser Plex 服务器不提供当前用户查询
+func (api *PlexAPI) GetCurrentUser(ctx context.Context, token string) (*User, error) {
+	return nil, errPlexUnsupported
+}
+
+// GetUserItem Plex 没有 Emby 式的用户视角查询
+func (api *PlexAPI) GetUserItem(ctx context.Context, userID, itemID string) (*Item, error) {
+	return nil, errPlexUnsupported
+}
+
+// GetAncestors Plex 没有 Emby 式的用户视角查询
+func (api *PlexAPI) GetAncestors(ctx context.Context, userID, itemID string) ([]Item, error) {
+	return nil, errPlexUnsupported
+}
+
+// GetParentalRatings Plex 没有分级对照表
+func (api *PlexAPI) GetParentalRatings(ctx context.Context) ([]ParentalRating, error) {
+	return nil, errPlexUnsupported
+}
+
+// ListUpcoming Plex 的 On Deck 需要用户自己的令牌，服务器令牌查不到
+func (api *PlexAPI) ListUpcoming(ctx context.Context, userID string, limit int) ([]LibraryItem, error) {
+	return nil, errPlexUnsupported
+}
+
+// ListItems 分页列出所有可播放条目及其 part 路径。
+// Plex 没有跨媒体库的递归列表，StartIndex 按媒体库顺序连续编号，一页不跨越媒体库
+func (api *PlexAPI) ListItems(ctx context.Context, query LibraryQuery) (*LibraryPage, error) {
+	sections, err := call(ctx, api.Client, CallItems, api.requestBuilder(api.Token, "/library/sections", nil), decodeJSON[plexContainer]())
+	if err != nil {
+		return nil, err
+	}
+
+	page := &LibraryPage{}
+	for _, section := range sections.MediaContainer.Directory {
+		itemType, ok := plexItemTypes[section.Type]
+		if !ok {
+			continue
+		}
+		// 只查询数量，确定 StartIndex 落在哪个媒体库
+		total, err := api.listSection(ctx, section.Key, itemType, query, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		offset := query.StartIndex - page.TotalRecordCount
+		if len(page.Items) == 0 && offset >= 0 && offset < total.MediaContainer.TotalSize {
+			items, err := api.listSection(ctx, section.Key, itemType, query, offset, query.Limit)
+			if err != nil {
+				return nil, err
+			}
+			for _, metadata := range items.MediaContainer.Metadata {
+				page.Items = append(page.Items, metadata.libraryItem())
+			}
+		}
+		page.TotalRecordCount += total.MediaContainer.TotalSize
+	}
+	return page, nil
+}
+
+// listSection 查询媒体库中某一类型条目的一页，size 为 0 时只返回 totalSize
+func (api *PlexAPI) listSection(ctx context.Context, key, itemType string, query LibraryQuery, start, size int) (plexContainer, error) {
+	values := url.Values{
+		"type":                   {itemType},
+		"sort":                   {"addedAt"},
+		"X-Plex-Container-Start": {strconv.Itoa(start)},
+		"X-Plex-Container-Size":  {strconv.Itoa(size)},
+	}
+	if !query.MinDateLastSaved.IsZero() {
+		// Plex 的过滤语法 updatedAt>>=<unix>，按第一个 = 拆分为参数名 updatedAt>>
+		values.Set("updatedAt>>", strconv.FormatInt(query.MinDateLastSaved.Unix(), 10))
+	}
+	path := "/library/sections/" + url.PathEscape(key) + "/all"
+	return call(ctx, api.Client, CallItems, api.requestBuilder(api.Token, path, values), decodeJSON[plexContainer]())
+}
+
+// libraryItem converts a listed item for the library index; Path is the first part's file.
+func (m *PlexMetadata) libraryItem() LibraryItem {
+	item := LibraryItem{ID: m.RatingKey, MediaSources: m.MediaSources()}
+	if len(item.MediaSources) > 0 {
+		item.Path = item.MediaSources[0].Path
+	}
+	return item
+}
+
+// ParseMetadataKey extracts the rating key from a metadata path such as /library/metadata/123.
+func ParseMetadataKey(path string) (string, bool) {
+	key, found := strings.CutPrefix(path, "/library/metadata/")
+	if !found || key == "" || strings.Contains(key, "/") {
+		return "", false
+	}
+	return key, true
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newRecordedPlex serves a recorded /library/metadata response for item 5123 and two
+// library sections for ListItems, checking the token and that JSON is requested.
+func newRecordedPlex(t *testing.T) *PlexAPI {
+	t.Helper()
+	body, err := os.ReadFile("testdata/plex_metadata.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sectionSizes := map[string]int{"1": 3, "2": 2}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Plex-Token") != "server-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("Accept") != "application/json" {
+			t.Error("Plex defaults to XML, JSON must be requested")
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/library/metadata/5123":
+			w.Write(body)
+		case "/library/sections":
+			fmt.Fprint(w, `{"MediaContainer":{"Directory":[{"key":"1","type":"movie"},{"key":"3","type":"photo"},{"key":"2","type":"show"}]}}`)
+		case "/library/sections/1/all", "/library/sections/2/all":
+			section := r.URL.Path[len("/library/sections/") : len("/library/sections/")+1]
+			start, _ := strconv.Atoi(r.URL.Query().Get("X-Plex-Container-Start"))
+			size, _ := strconv.Atoi(r.URL.Query().Get("X-Plex-Container-Size"))
+			var items string
+			for i := start; i < min(start+size, sectionSizes[section]); i++ {
+				if items != "" {
+					items += ","
+				}
+				items += fmt.Sprintf(`{"ratingKey":"%s%d","Media":[{"Part":[{"id":%s%d,"file":"/mnt/%s/%d.mkv"}]}]}`, section, i, section, i, section, i)
+			}
+			fmt.Fprintf(w, `{"MediaContainer":{"totalSize":%d,"Metadata":[%s]}}`, sectionSizes[section], items)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return &PlexAPI{PlexURL: server.URL, Token: "server-token", Client: server.Client()}
+}
+
+func TestPlexGetMediaSources(t *testing.T) {
+	api := newRecordedPlex(t)
+
+	sources, err := api.GetMediaSources(context.Background(), "5123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 3 {
+		t.Fatalf("got %d media sources, want one per part (3)", len(sources))
+	}
+
+	first := sources[0]
+	if first.ID != "7001" || first.Path != "/mnt/gd/Movies/Example Movie (2023)/Example Movie (2023) - 2160p.mkv" {
+		t.Errorf("first part = %+v", first)
+	}
+	if first.Size != 38456123456 || first.Bitrate != 42_350_000 || first.Duration() != 7265*time.Second {
+		t.Errorf("part metadata not converted: size %d, bitrate %d, duration %s", first.Size, first.Bitrate, first.Duration())
+	}
+	// Parts without their own container fall back to the media's
+	if sources[2].Container != "mp4" {
+		t.Errorf("Container = %q, want mp4 from the media", sources[2].Container)
+	}
+
+	source, err := api.GetMediaSource(context.Background(), "5123", "7003")
+	if err != nil || source.Path != "/mnt/gd2/Movies/Example Movie (2023)/Example Movie (2023) - 1080p - cd2.mp4" {
+		t.Errorf("GetMediaSource(7003) = %+v, %v", source, err)
+	}
+}
+
+func TestPlexMetadataPart(t *testing.T) {
+	api := newRecordedPlex(t)
+	metadata, err := api.GetMetadata(context.Background(), "server-token", "5123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if part, ok := metadata.Part(1, 1); !ok || part.ID != "7003" {
+		t.Errorf("Part(1, 1) = %+v, %v; want part 7003", part, ok)
+	}
+	if _, ok := metadata.Part(0, 1); ok {
+		t.Error("Part(0, 1) found a part the first media does not have")
+	}
+
+	if _, err := api.GetMetadata(context.Background(), "client-token", "5123"); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("GetMetadata with a rejected token: %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestPlexListItems(t *testing.T) {
+	api := newRecordedPlex(t)
+
+	var ids []string
+	query := LibraryQuery{Limit: 2}
+	for {
+		page, err := api.ListItems(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.TotalRecordCount != 5 {
+			t.Fatalf("TotalRecordCount = %d, want 5 (photo sections are skipped)", page.TotalRecordCount)
+		}
+		for _, item := range page.Items {
+			ids = append(ids, item.ID+"="+item.MediaSources[0].ID)
+		}
+		query.StartIndex += len(page.Items)
+		if len(page.Items) == 0 || query.StartIndex >= page.TotalRecordCount {
+			break
+		}
+	}
+
+	want := fmt.Sprint([]string{"10=10", "11=11", "12=12", "20=20", "21=21"})
+	if fmt.Sprint(ids) != want {
+		t.Errorf("listed %v, want %s", ids, want)
+	}
+}
+
+func TestParseMetadataKey(t *testing.T) {
+	if key, ok := ParseMetadataKey("/library/metadata/5123"); !ok || key != "5123" {
+		t.Errorf("ParseMetadataKey = %q, %v", key, ok)
+	}
+	for _, path := range []string{"/library/metadata/", "/library/metadata/5123/children", "/library/sections/1"} {
+		if _, ok := ParseMetadataKey(path); ok {
+			t.Errorf("ParseMetadataKey(%q) accepted a path that is not an item", path)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"Go_Frontend/config"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/goccy/go-json"
+)
+
+// MediaServer resolves a media source of an item to its path and metadata on the media server.
+// Every call honours ctx, so a client that disconnects cancels the lookup.
+type MediaServer interface {
+	GetMediaSource(ctx context.Context, itemID, mediaSourceID string) (*MediaSourceInfo, error)
+	// GetMediaSources returns every media source of an item, for requests that name none.
+	GetMediaSources(ctx context.Context, itemID string) ([]MediaSourceInfo, error)
+	// GetCurrentUser validates a client token and returns its user, or ErrUnauthorized.
+	GetCurrentUser(ctx context.Context, token string) (*User, error)
+	// GetUserItem returns an item as seen by the user, or ErrNotFound if the user cannot see it.
+	GetUserItem(ctx context.Context, userID, itemID string) (*Item, error)
+	// GetAncestors returns the parents of an item up to and including its library folder.
+	GetAncestors(ctx context.Context, userID, itemID string) ([]Item, error)
+	// GetParentalRatings returns the server's rating table.
+	GetParentalRatings(ctx context.Context) ([]ParentalRating, error)
+	// ListItems returns one page of all playable items with their media source paths.
+	ListItems(ctx context.Context, query LibraryQuery) (*LibraryPage, error)
+	// ListUpcoming returns the next-up episodes and resumable items of a user with their media source paths.
+	ListUpcoming(ctx context.Context, userID string, limit int) ([]LibraryItem, error)
+}
+
+// NewMediaServer returns the client for the given server's Type.
+func NewMediaServer(server *config.ServerConfig) MediaServer {
+	switch server.Type {
+	case config.ServerTypeJellyfin:
+		return NewJellyfinAPI(server)
+	case config.ServerTypePlex:
+		return NewPlexAPI(server)
+	}
+	return NewEmbyAPI(server)
+}
+
+// NormalizeID reduces an item or media source ID to a comparable form.
+// Jellyfin uses GUIDs that clients send both with and without dashes and in either case.
+func NormalizeID(id string) string {
+	return strings.ToLower(strings.ReplaceAll(id, "-", ""))
+}
+
+// decodeJSON returns a decode function for call that parses the body into a T.
+func decodeJSON[T any]() func(resp *http.Response) (T, error) {
+	return func(resp *http.Response) (T, error) {
+		var value T
+		err := json.NewDecoder(resp.Body).Decode(&value)
+		return value, err
+	}
+}
+
+// decodeMediaSources parses a PlaybackInfo response into its media sources.
+func decodeMediaSources(resp *http.Response) ([]MediaSourceInfo, error) {
+	// ✅ 优化: 流式解析 JSON
+	// 避免 io.ReadAll 读取整个 Body 到内存，大幅降低 GC 压力
+	var result struct {
+		MediaSources []MediaSourceInfo `json:"MediaSources"`
+		ErrorCode    string            `json:"ErrorCode"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if result.ErrorCode != "" {
+		return nil, fmt.Errorf("playback info error: %s", result.ErrorCode)
+	}
+	return result.MediaSources, nil
+}
+
+// decodeMediaSource parses a PlaybackInfo response and picks the requested media source.
+func decodeMediaSource(mediaSourceID string) func(resp *http.Response) (*MediaSourceInfo, error) {
+	return func(resp *http.Response) (*MediaSourceInfo, error) {
+		sources, err := decodeMediaSources(resp)
+		if err != nil {
+			return nil, err
+		}
+
+		wanted := NormalizeID(mediaSourceID)
+		for i := range sources {
+			if NormalizeID(sources[i].ID) == wanted {
+				return &sources[i], nil
+			}
+		}
+		return nil, ErrMediaSourceNotFound
+	}
+}
+
+// decodeCurrentUser parses /Users/Me and rejects disabled accounts.
+func decodeCurrentUser(resp *http.Response) (*User, error) {
+	user, err := decodeJSON[User]()(resp)
+	if err != nil {
+		return nil, err
+	}
+	if user.ID == "" || user.Policy.IsDisabled {
+		return nil, ErrUnauthorized
+	}
+	return &user, nil
+}
+
+// decodeItem parses a single item from the user-scoped item endpoint.
+func decodeItem(resp *http.Response) (*Item, error) {
+	item, err := decodeJSON[Item]()(resp)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
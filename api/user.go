@@ -0,0 +1,53 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUnauthorized is returned when the media server rejects a client token.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrNotFound is returned when an item does not exist or is not visible to the user.
+	ErrNotFound = errors.New("not found")
+	// ErrMediaSourceNotFound is returned when an item exists but has no media source with the requested ID.
+	ErrMediaSourceNotFound = fmt.Errorf("media source %w", ErrNotFound)
+)
+
+// User is the media server account behind a client token.
+type User struct {
+	ID     string     `json:"Id"`
+	Name   string     `json:"Name"`
+	Policy UserPolicy `json:"Policy"`
+}
+
+// UserPolicy is the subset of the Emby/Jellyfin user policy the frontend enforces.
+// Flags that default to allowed are pointers so that a server omitting them does not lock users out.
+type UserPolicy struct {
+	IsAdministrator     bool     `json:"IsAdministrator"`
+	IsDisabled          bool     `json:"IsDisabled"`
+	EnableMediaPlayback *bool    `json:"EnableMediaPlayback"`
+	EnableRemoteAccess  *bool    `json:"EnableRemoteAccess"`
+	EnableAllFolders    *bool    `json:"EnableAllFolders"`
+	EnabledFolders      []string `json:"EnabledFolders"`
+	MaxParentalRating   *int     `json:"MaxParentalRating"`
+}
+
+// Allows reports whether an optional policy flag is enabled; a missing flag counts as enabled.
+func Allows(flag *bool) bool {
+	return flag == nil || *flag
+}
+
+// Item is the subset of a BaseItemDto the frontend uses.
+type Item struct {
+	ID             string `json:"Id"`
+	Name           string `json:"Name"`
+	Type           string `json:"Type"`
+	OfficialRating string `json:"OfficialRating"`
+}
+
+// ParentalRating maps a rating name such as "PG-13" to its numeric level.
+type ParentalRating struct {
+	Name  string `json:"Name"`
+	Value int    `json:"Value"`
+}
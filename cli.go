@@ -0,0 +1,234 @@
+package main
+
+import (
+	"Go_Frontend/config"
+	"Go_Frontend/geoip"
+	"Go_Frontend/logger"
+	"Go_Frontend/stream"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runRouteCommand implements "go_frontend route test [flags] <emby-path | itemId mediaSourceId>".
+func runRouteCommand(args []string) int {
+	if len(args) == 0 || args[0] != "test" {
+		fmt.Fprintln(os.Stderr, "Usage: go_frontend route test [-config config.yaml] [-server name] [-ip client-ip] <emby-path | itemId mediaSourceId>")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("route test", flag.ContinueOnError)
+	configFile := fs.String("config", "config.yaml", "configuration file")
+	clientIP := fs.String("ip", "", "simulate a client address for GeoIP mirror selection")
+	serverName := fs.String("server", "", "media server to route for (default: the default server)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	var itemID, mediaSourceID, mediaPath string
+	switch fs.NArg() {
+	case 1:
+		mediaPath = fs.Arg(0)
+	case 2:
+		itemID, mediaSourceID = fs.Arg(0), fs.Arg(1)
+	default:
+		fmt.Fprintln(os.Stderr, "Expected an Emby path, or an itemId and a mediaSourceId")
+		return 2
+	}
+
+	// Keep the report readable: only errors from the normal startup logging
+	if err := initializeConfig(*configFile, "ERROR"); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load %s: %v\n", *configFile, err)
+		return 1
+	}
+
+	server := config.DefaultServer()
+	if *serverName != "" {
+		server = config.GetServer(*serverName)
+	}
+	if server == nil {
+		fmt.Fprintf(os.Stderr, "Unknown server %s\n", *serverName)
+		return 2
+	}
+
+	var location geoip.Location
+	if *clientIP != "" {
+		location = geoip.Lookup(*clientIP)
+	}
+
+	report := stream.DryRun(context.Background(), server, itemID, mediaSourceID, mediaPath, location)
+	printRouteReport(report)
+	if report.Error != "" {
+		return 1
+	}
+	return 0
+}
+
+func printRouteReport(report stream.RouteReport) {
+	fmt.Printf("Server:          %s\n", report.Server)
+	if report.ItemID != "" {
+		fmt.Printf("Item:            %s / %s\n", report.ItemID, report.MediaSourceID)
+	}
+	fmt.Printf("Media path:      %s\n", report.MediaPath)
+	if report.ItemID != "" {
+		fmt.Printf("Path source:     %s\n", report.PathSource)
+	}
+	if report.Strm == nil {
+		fmt.Printf("Normalized path: %s\n", report.NormalizedPath)
+	}
+	if report.Client != "" {
+		fmt.Printf("Client:          %s\n", report.Client)
+	}
+
+	if report.Strm == nil {
+		fmt.Println("Rules:")
+	}
+	for _, rule := range report.Rules {
+		line := fmt.Sprintf("  %-18s %-24s %s", rule.Verdict, rule.Backend, rule.Path)
+		if rule.Detail != "" {
+			line += "  (" + rule.Detail + ")"
+		}
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+
+	if report.Strm != nil {
+		if report.Strm.Rule >= 0 {
+			fmt.Printf("STRM rule:       %d\n", report.Strm.Rule)
+		} else {
+			fmt.Println("STRM rule:       none (default action)")
+		}
+	}
+
+	if report.Matched {
+		fmt.Printf("Backend:         %s\n", report.Backend.Name)
+		fmt.Printf("Backend URL:     %s\n", report.BackendURL)
+		fmt.Printf("Relative path:   %s\n", report.RelativePath)
+	}
+	if report.SignedURL != "" {
+		if report.Strm != nil && report.Strm.Backend == "" {
+			fmt.Printf("Redirect URL:    %s\n", report.SignedURL)
+		} else {
+			fmt.Printf("Signed URL:      %s\n", report.SignedURL)
+		}
+	}
+	if len(report.Hints) > 0 && (report.Strm == nil || report.Strm.Backend != "") {
+		keys := make([]string, 0, len(report.Hints))
+		for key := range report.Hints {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		hints := make([]string, 0, len(keys))
+		for _, key := range keys {
+			hints = append(hints, fmt.Sprintf("%s=%v", key, report.Hints[key]))
+		}
+		fmt.Printf("Signed hints:    %s\n", strings.Join(hints, ", "))
+	}
+	if report.Error != "" {
+		fmt.Printf("Error:           %s\n", report.Error)
+	}
+}
+
+const cacheUsage = "Usage: go_frontend cache [-config config.yaml] [-url http://127.0.0.1:60001] [-token token] [-server name] " +
+	"<stats | get itemId mediaSourceId | delete itemId | delete-path prefix | flush>"
+
+// runCacheCommand implements "go_frontend cache ...", which calls the cache endpoints of the
+// admin API of a running instance. The address and token default to those in the config file.
+func runCacheCommand(args []string) int {
+	fs := flag.NewFlagSet("cache", flag.ContinueOnError)
+	configFile := fs.String("config", "config.yaml", "configuration file, for the admin token and port")
+	baseURL := fs.String("url", "", "address of the running instance (default: http://127.0.0.1:<ServerPort>)")
+	token := fs.String("token", "", "admin token (default: Admin.token from the config file)")
+	serverName := fs.String("server", "", "media server of the entries (default: the default server)")
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, cacheUsage)
+		return 2
+	}
+
+	if *baseURL == "" || *token == "" {
+		logger.InitializeLogger("ERROR")
+		if err := config.Initialize(*configFile, "ERROR"); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load %s: %v\n", *configFile, err)
+			return 1
+		}
+		if *baseURL == "" {
+			port := config.GetConfig().ServerPort
+			if port == 0 {
+				port = 60001
+			}
+			*baseURL = "http://127.0.0.1:" + strconv.Itoa(port)
+		}
+		if *token == "" {
+			*token = config.GetConfig().Admin.Token
+		}
+	}
+	if *token == "" {
+		fmt.Fprintln(os.Stderr, "The admin API is disabled: set Admin.token or pass -token")
+		return 2
+	}
+
+	query := url.Values{}
+	if *serverName != "" {
+		query.Set("server", *serverName)
+	}
+	var method, path string
+	switch cmd, rest := fs.Arg(0), fs.Args()[1:]; {
+	case cmd == "stats" && len(rest) == 0:
+		method, path = http.MethodGet, "/admin/cache/stats"
+	case cmd == "get" && len(rest) == 2:
+		method, path = http.MethodGet, "/admin/cache/items/"+url.PathEscape(rest[0])+"/"+url.PathEscape(rest[1])
+	case cmd == "delete" && len(rest) == 1:
+		method, path = http.MethodDelete, "/admin/cache/items/"+url.PathEscape(rest[0])
+	case cmd == "delete-path" && len(rest) == 1:
+		method, path = http.MethodDelete, "/admin/cache/paths"
+		query.Set("prefix", rest[0])
+	case cmd == "flush" && len(rest) == 0:
+		method, path = http.MethodDelete, "/admin/cache"
+	default:
+		fmt.Fprintln(os.Stderr, cacheUsage)
+		return 2
+	}
+
+	reqURL := strings.TrimSuffix(*baseURL, "/") + path
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, reqURL, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	req.Header.Set("X-Admin-Token", *token)
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Request failed: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode == http.StatusNoContent {
+		fmt.Println("OK")
+		return 0
+	}
+	var pretty bytes.Buffer
+	if json.Indent(&pretty, body, "", "  ") == nil {
+		body = pretty.Bytes()
+	}
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", resp.Status, strings.TrimSpace(string(body)))
+		return 1
+	}
+	fmt.Println(string(body))
+	return 0
+}
@@ -2,31 +2,210 @@ package config
 
 import (
 	"Go_Frontend/util"
+	"fmt"
 	"github.com/spf13/viper"
-	"sort"
+	"strings"
+	"time"
+)
+
+// 媒体服务器类型
+const (
+	ServerTypeEmby     = "emby"
+	ServerTypeJellyfin = "jellyfin"
+	ServerTypePlex     = "plex"
 )
 
 // Config 保存所有配置值
 type Config struct {
-	LogLevel            string               // 日志级别
-	Encipher            string               // 加密密钥
-	EmbyURL             string               // Emby 地址
-	EmbyPort            int                  // Emby 端口
-	EmbyAPIKey          string               // API 密钥
-	
-	// --- 多后端配置 ---
-	Backends            []BackendConfig      
-	
-	PlayURLMaxAliveTime int                  // 链接有效期
-	ServerPort          int                  // 监听端口
-	SpecialMedias       []SpecialMediaConfig // 特殊媒体
+	LogLevel            string             // 日志级别
+	Encipher            string             // 加密密钥
+	Servers             []ServerConfig     // 媒体服务器，按请求的 Host 选择
+	EmbyClient          EmbyClientConfig   // Emby 请求的超时、重试与对冲
+	PlayURLMaxAliveTime int                // 链接有效期
+	ServerPort          int                // 监听端口
+	TrustedProxies      []string           // 信任其 X-Forwarded-For / X-Real-IP 的反向代理地址或网段，默认只信任本机
+	Admin               AdminConfig        // 管理接口
+	GeoIP               GeoIPConfig        // 离线 GeoIP 路由与地域限制
+	Auth                AuthConfig         // 客户端认证
+	Access              AccessConfig       // 用户媒体库与播放策略
+	Strm                StrmConfig         // STRM 远程地址的处理
+	Index               IndexConfig        // 媒体库路径索引
+	Webhook             WebhookConfig      // Emby/Jellyfin webhook 接收
+	PlaybackInfo        PlaybackInfoConfig // PlaybackInfo 拦截与改写
+	MediaSource         MediaSourceConfig  // 请求未带 MediaSourceId 时的媒体源选择
+	Hints               []string           // 写入签名、转发给后端的媒体信息: size, container, mime, duration
+	Cache               CacheConfig        // 媒体源路径的缓存，多实例部署时可共享
+	Warm                WarmConfig         // 按继续观看和下一集列表预热路径缓存
+	Timezone            string             // 特殊媒体时间规则使用的时区，如 Asia/Shanghai，留空使用系统时区
+}
+
+// ServerConfig 单个 Emby/Jellyfin/Plex 服务器及其后端和特殊媒体
+type ServerConfig struct {
+	Name          string               // 服务器名称，用于缓存键、日志和管理接口
+	Hosts         []string             // 匹配的主机名 (Host / X-Forwarded-Host / SNI)，支持 *.example.com；留空为默认服务器
+	Type          string               // 媒体服务器类型: emby (默认)、jellyfin 或 plex
+	URL           string               // Emby 地址
+	Port          int                  // Emby 端口
+	APIKey        string               // API 密钥，Plex 为服务器的 X-Plex-Token
+	UserID        string               // 用户 ID，Jellyfin 10.8 查询 PlaybackInfo 时需要
+	PublicURL     string               // 客户端可直接访问的 Plex 地址，无法签名的请求重定向到这里；留空则由前端代理
+	Backends      []BackendConfig      // 留空则使用顶层的 Backends
+	SpecialMedias []SpecialMediaConfig // 留空则使用顶层的 SpecialMedias
+}
+
+// EmbyClientConfig Emby 请求的超时、重试与对冲配置
+type EmbyClientConfig struct {
+	Timeouts struct {
+		PlaybackInfo time.Duration // 起播路径上的 PlaybackInfo 查询
+		Auth         time.Duration // 客户端令牌校验
+		Items        time.Duration // 条目、上级目录等媒体库查询
+	}
+	Retries         int           // 幂等请求的最大重试次数
+	RetryBackoff    time.Duration // 首次重试的基础等待时间，之后指数增长并加入随机抖动
+	Hedge           bool          // 请求慢于历史延迟分位数时再发一个请求，先返回者胜出
+	HedgePercentile float64       // 对冲等待时间取历史延迟的该分位数，默认 95
+}
+
+// AccessConfig 用户权限检查配置，需要同时开启 Auth
+type AccessConfig struct {
+	Enabled  bool // 检查条目可见性、播放/远程访问权限、分级和媒体库限制，默认开启
+	CacheTTL int  // 用户-条目判定缓存时间，单位秒
+}
+
+// WebhookConfig Emby/Jellyfin webhook 接收配置
+type WebhookConfig struct {
+	Secret string // 共享密钥，通过 ?secret= 或 X-Webhook-Secret 请求头传递；留空则不启用
+}
+
+// MediaSourceConfig 请求未带 MediaSourceId 时如何从条目的媒体源中选择
+type MediaSourceConfig struct {
+	Policy string // first (默认) 第一个; bitrate 码率最高; container 容器与请求的扩展名一致; maxBitrate 不超过客户端 MaxStreamingBitrate 的最高码率
+}
+
+// PlaybackInfoConfig PlaybackInfo 拦截：代理到媒体服务器后，把命中后端的媒体源改为已签名的直链
+type PlaybackInfoConfig struct {
+	Enabled          bool
+	StripTranscoding bool                     // 去掉 TranscodingUrl，客户端只能直连后端
+	Rules            []PlaybackInfoRuleConfig // 按用户和客户端覆盖上面的默认行为，按顺序匹配
+}
+
+// PlaybackInfoRuleConfig 按用户和客户端匹配的改写策略
+type PlaybackInfoRuleConfig struct {
+	Users            []string // 用户名或用户 ID，需要开启 Auth；留空匹配所有用户
+	Clients          []string // 客户端名称，如 "Infuse"、"Emby Web"，支持 * 通配；留空匹配所有客户端
+	Passthrough      bool     // 原样返回媒体服务器的响应，不改写
+	StripTranscoding bool     // 去掉 TranscodingUrl
+}
+
+// IndexConfig 媒体库路径索引：后台分页同步条目路径，起播时优先查索引，未命中再请求 PlaybackInfo
+type IndexConfig struct {
+	Enabled      bool
+	Dir          string        // 索引持久化目录，每个服务器一个文件；留空则不持久化
+	Interval     time.Duration // 增量同步 (MinDateLastSaved) 间隔
+	FullInterval time.Duration // 全量同步间隔，全量同步会清除已删除的条目
+	PageSize     int           // 每页条目数
+}
+
+// StrmConfig STRM 条目 (Path 为 http(s) 地址) 的处理方式
+type StrmConfig struct {
+	Action string           // 未命中规则时: redirect (默认) 直接重定向到远程地址, reject 拒绝
+	Rules  []StrmRuleConfig // 按顺序匹配远程地址
+}
+
+// StrmRuleConfig 按主机名和路径前缀匹配远程地址
+type StrmRuleConfig struct {
+	Hosts      []string // 远程地址的主机名，支持 *.example.com
+	PathPrefix string   // 可选，只匹配该前缀下的路径；改写到后端时去掉该前缀
+	Backend    string   // 改写到该后端，去掉前缀后的路径作为相对路径；留空则重定向到远程地址
+	Signer     string   // 重定向前为远程地址签名: alist；留空不签名
+	Secret     string   // 签名密钥，如 alist 的令牌
+}
+
+// CacheConfig 条目到媒体源路径的缓存，链接本身每次请求单独签名
+type CacheConfig struct {
+	Type        string        // memory (默认) 进程内缓存; redis 使用 Redis 协议的服务器，多个实例共享
+	TTL         time.Duration // 路径缓存时间
+	MaxEntries  int           // type 为 memory 时的条目上限，超出后淘汰最久未使用的条目；redis 由 maxmemory-policy 控制
+	Redis       RedisConfig   // type 为 redis 时的连接配置
+	Lock        bool          // 用分布式锁代替进程内的请求合并，多个实例不重复解析同一条目，需要 type: redis
+	LockTimeout time.Duration // 锁的有效期，也是等待其他实例解析的最长时间
+
+	NegativeTTL          time.Duration // 条目或媒体源不存在时缓存该结果的时间，0 表示不缓存
+	StaleWhileRevalidate time.Duration // 过期后的这段时间内直接使用旧路径，同时在后台重新解析
+	StaleIfError         time.Duration // 过期后的这段时间内，重新解析失败 (媒体服务器不可用) 时使用旧路径
+
+	Snapshot CacheSnapshotConfig // type 为 memory 时把路径缓存保存到磁盘，重启后恢复
+}
+
+// WarmConfig 定期查询活跃用户的继续观看和下一集列表，提前把媒体源路径写入缓存，需要开启 Auth
+type WarmConfig struct {
+	Enabled       bool
+	Interval      time.Duration // 预热间隔
+	ActiveWindow  time.Duration // 该时间内播放过的用户视为活跃
+	Limit         int           // 每个列表取的条目数
+	Concurrency   int           // 同时查询的用户数
+	RatePerSecond float64       // 每秒最多请求媒体服务器和后端的次数
+	PrefetchBytes int64         // 大于 0 时按签名链接请求后端文件开头的这些字节，让后端提前缓存；0 不预取
+}
+
+// CacheSnapshotConfig 路径缓存的磁盘快照
+type CacheSnapshotConfig struct {
+	File     string        // 快照文件，留空则不保存
+	Interval time.Duration // 定时写入间隔，正常退出时也会写入
+}
+
+// RedisConfig Redis 协议服务器 (Redis、KeyDB、Valkey 等) 的连接配置
+type RedisConfig struct {
+	Addr     string // host:port
+	Password string
+	DB       int
+	Prefix   string // 键前缀，多个部署共用一个 Redis 时用于区分
+}
+
+// AuthConfig 客户端认证配置
+type AuthConfig struct {
+	Enabled  bool // 校验请求方的 Emby 令牌，默认开启
+	CacheTTL int  // 验证通过的令牌缓存时间，单位秒
 }
 
 // BackendConfig 单个后端配置
 type BackendConfig struct {
-	Name string 
-	URL  string 
-	Path string 
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Path     string `json:"path"`
+	Disabled bool   `json:"disabled,omitempty"` // 停用的后端不参与路由
+
+	// 地域镜像：客户端国家或 ASN 命中时改用镜像地址，按顺序匹配
+	Mirrors []MirrorConfig `json:"mirrors,omitempty"`
+}
+
+// MirrorConfig 后端的地域镜像
+type MirrorConfig struct {
+	URL       string   `json:"url"`
+	Countries []string `json:"countries,omitempty"` // ISO 国家代码，如 HK、DE
+	ASNs      []uint   `json:"asns,omitempty"`
+}
+
+// GeoIPConfig 离线 GeoIP 配置，Database 与 ASNDatabase 都留空则不启用
+type GeoIPConfig struct {
+	Database      string          // 国家/城市库 (.mmdb)，支持 MaxMind 与 DB-IP
+	ASNDatabase   string          // ASN 库 (.mmdb)，可选
+	Policy        GeoPolicyConfig // 访问策略
+	BlockAction   string          // 被拦截时的处理: "403" (默认) 或 "media"
+	BlockMediaKey string          // BlockAction 为 media 时播放的 SpecialMedias key
+}
+
+// GeoPolicyConfig 按国家或 ASN 的白名单/黑名单
+type GeoPolicyConfig struct {
+	Mode      string   // "allow" 仅允许列表内, "deny" 拒绝列表内, 留空不限制
+	Countries []string
+	ASNs      []uint
+}
+
+// AdminConfig 管理接口配置
+type AdminConfig struct {
+	Token     string // 管理接口令牌，留空则不启用管理接口
+	StateFile string // 运行时修改的后端持久化文件，覆盖 YAML 中的 Backends
 }
 
 // SpecialMediaConfig 特殊媒体配置
@@ -36,6 +215,24 @@ type SpecialMediaConfig struct {
 	MediaPath     string
 	ItemId        string
 	MediaSourceID string
+	Schedule      []ScheduleRuleConfig // 播放时间规则，满足任一规则即播放；内置 key 留空时使用默认规则
+	Priority      int                  // 多个特殊媒体同时生效时优先级高的胜出，相同时按配置顺序
+}
+
+// ScheduleRuleConfig 一条时间规则，规则内填写的条件需要同时满足
+type ScheduleRuleConfig struct {
+	Cron     string        // 五段 cron 表达式 (分 时 日 月 周)，触发后持续 Duration
+	Duration time.Duration // cron 触发后的持续时间，默认 1m，最长 24h
+	Dates    string        // 日期范围，如 "2026-10-01..2026-10-07" 或单日 "2026-10-01"
+	Yearly   string        // 每年重复的日期，如 "09-18" 或 "12-24..01-02"
+	Weekdays []string      // 星期，如 ["sat", "sun"] 或 ["mon-fri"]
+	Hours    string        // 每天的时间段，如 "09:00-10:00"，跨零点的时间段 (如 "19:00-01:00") 属于开始的那一天
+
+	// 农历日期、节日和节气三者选一
+	Lunar     string // 农历日期，如 "08-15"、"12-last" (月末) 或 "12-23..01-15"
+	Leap      string // 闰月处理: exclude 只匹配正月份 (默认)，include 闰月也算同一个月，only 只匹配闰月
+	Festival  string // 节日，如 "MidAutumn"/"中秋"、"DragonBoat"/"端午"、"Qingming"/"清明"
+	SolarTerm string // 节气，如 "dongzhi" 或 "冬至"
 }
 
 var globalConfig Config
@@ -51,45 +248,226 @@ func Initialize(configFile string, loglevel string) error {
 		globalConfig = Config{
 			LogLevel:            defaultLogLevel(loglevel),
 			Encipher:            "vPQC5LWCN2CW2opz",
-			EmbyURL:             "http://127.0.0.1",
-			EmbyPort:            8096,
-			Backends:            []BackendConfig{},
+			Servers:             []ServerConfig{{Name: defaultServerName, Type: ServerTypeEmby, URL: "http://127.0.0.1", Port: 8096}},
+			EmbyClient:          EmbyClientConfig{Retries: 2},
 			PlayURLMaxAliveTime: 21600,
 			ServerPort:          60001,
-			SpecialMedias:       []SpecialMediaConfig{},
+			TrustedProxies:      defaultTrustedProxies,
+			Auth:                AuthConfig{Enabled: true, CacheTTL: 60},
+			Access:              AccessConfig{Enabled: true, CacheTTL: 300},
+			Cache:               CacheConfig{Type: "memory", TTL: 24 * time.Hour, MaxEntries: 100000, NegativeTTL: 30 * time.Second},
 		}
 	} else {
+		servers, err := loadServers()
+		if err != nil {
+			return err
+		}
 		globalConfig = Config{
 			LogLevel:            getLogLevel(loglevel),
 			Encipher:            viper.GetString("Encipher"),
-			EmbyURL:             viper.GetString("Emby.url"),
-			EmbyPort:            viper.GetInt("Emby.port"),
-			EmbyAPIKey:          viper.GetString("Emby.apiKey"),
-			Backends:            loadBackends(), // 加载并排序
+			Servers:             servers,
+			EmbyClient:          loadEmbyClient(),
 			PlayURLMaxAliveTime: viper.GetInt("PlayURLMaxAliveTime"),
 			ServerPort:          viper.GetInt("Server.port"),
-			SpecialMedias:       loadSpecialMedias(),
+			TrustedProxies:      loadTrustedProxies(),
+			Admin: AdminConfig{
+				Token:     viper.GetString("Admin.token"),
+				StateFile: viper.GetString("Admin.stateFile"),
+			},
+			GeoIP:  loadGeoIP(),
+			Auth:   loadAuth(),
+			Access: loadAccess(),
+			Strm:   loadStrm(),
+			Index:  loadIndex(),
+			Webhook: WebhookConfig{
+				Secret: viper.GetString("Webhook.secret"),
+			},
+			PlaybackInfo: loadPlaybackInfo(),
+			MediaSource: MediaSourceConfig{
+				Policy: viper.GetString("MediaSource.policy"),
+			},
+			Hints:    viper.GetStringSlice("Hints"),
+			Cache:    loadCache(),
+			Warm:     loadWarm(),
+			Timezone: viper.GetString("Timezone"),
 		}
 	}
 	return nil
 }
 
-// loadBackends 加载后端并按路径长度降序排序（防止短路径误匹配）
+// defaultTrustedProxies 前端通常部署在同一台机器的 nginx 后面
+var defaultTrustedProxies = []string{"127.0.0.1", "::1"}
+
+// loadTrustedProxies 未配置时只信任本机；配置为空列表则不信任任何代理，客户端地址取连接的对端地址
+func loadTrustedProxies() []string {
+	if !viper.IsSet("Server.trustedProxies") {
+		return defaultTrustedProxies
+	}
+	proxies := viper.GetStringSlice("Server.trustedProxies")
+	if proxies == nil {
+		return []string{}
+	}
+	return proxies
+}
+
+// loadBackends 加载后端列表
+// 最长匹配由 route 包编译的路径段前缀树负责，这里保持配置中的原始顺序
 func loadBackends() []BackendConfig {
 	var backends []BackendConfig
 	if err := viper.UnmarshalKey("Backends", &backends); err != nil {
 		return []BackendConfig{}
 	}
-	
-	// 核心优化：按 Path 长度降序排序
-	// 确保 /mnt/anime/movie (长) 优先于 /mnt/anime (短) 被匹配
-	sort.SliceStable(backends, func(i, j int) bool {
-		return len(backends[i].Path) > len(backends[j].Path)
-	})
-	
 	return backends
 }
 
+// loadServers 读取 Emby 配置。列表形式为多个服务器；映射形式 (旧配置) 为单个服务器，
+// 使用顶层的 ServerType。服务器未单独配置 Backends / SpecialMedias 时使用顶层配置
+func loadServers() ([]ServerConfig, error) {
+	var servers []ServerConfig
+	if embyIsList() {
+		if err := viper.UnmarshalKey("Emby", &servers); err != nil {
+			return nil, fmt.Errorf("parse Emby servers: %w", err)
+		}
+	} else {
+		servers = []ServerConfig{{
+			Name:   defaultServerName,
+			URL:    viper.GetString("Emby.url"),
+			Port:   viper.GetInt("Emby.port"),
+			APIKey: viper.GetString("Emby.apiKey"),
+			UserID: viper.GetString("Emby.userId"),
+		}}
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no Emby server configured")
+	}
+
+	backends := loadBackends()
+	specialMedias := loadSpecialMedias()
+	seen := make(map[string]bool, len(servers))
+	for i := range servers {
+		server := &servers[i]
+		if server.Name == "" {
+			server.Name = fmt.Sprintf("server%d", i+1)
+		}
+		if seen[server.Name] {
+			return nil, fmt.Errorf("duplicate Emby server name %q", server.Name)
+		}
+		seen[server.Name] = true
+		server.Type = getServerType(server.Type)
+		if len(server.Backends) == 0 {
+			server.Backends = backends
+		}
+		if len(server.SpecialMedias) == 0 {
+			server.SpecialMedias = specialMedias
+		}
+	}
+	return servers, nil
+}
+
+// embyIsList 判断 Emby 是否为多服务器的列表形式
+func embyIsList() bool {
+	_, isList := viper.Get("Emby").([]interface{})
+	return isList
+}
+
+// loadEmbyClient 旧配置写在 Emby 下，多服务器时写在 EmbyClient 下，对所有服务器生效
+func loadEmbyClient() EmbyClientConfig {
+	key := "Emby"
+	if embyIsList() {
+		key = "EmbyClient"
+	}
+	viper.SetDefault(key+".retries", 2)
+	var client EmbyClientConfig
+	if err := viper.UnmarshalKey(key, &client); err != nil {
+		return EmbyClientConfig{Retries: 2}
+	}
+	return client
+}
+
+// loadAuth 未配置时默认开启认证
+func loadAuth() AuthConfig {
+	viper.SetDefault("Auth.enabled", true)
+	viper.SetDefault("Auth.cacheTTL", 60)
+	return AuthConfig{
+		Enabled:  viper.GetBool("Auth.enabled"),
+		CacheTTL: viper.GetInt("Auth.cacheTTL"),
+	}
+}
+
+// loadAccess 未配置时默认开启权限检查
+func loadAccess() AccessConfig {
+	viper.SetDefault("Access.enabled", true)
+	viper.SetDefault("Access.cacheTTL", 300)
+	return AccessConfig{
+		Enabled:  viper.GetBool("Access.enabled"),
+		CacheTTL: viper.GetInt("Access.cacheTTL"),
+	}
+}
+
+func loadIndex() IndexConfig {
+	viper.SetDefault("Index.dir", "index")
+	viper.SetDefault("Index.interval", 10*time.Minute)
+	viper.SetDefault("Index.fullInterval", 24*time.Hour)
+	viper.SetDefault("Index.pageSize", 500)
+	var index IndexConfig
+	if err := viper.UnmarshalKey("Index", &index); err != nil {
+		return IndexConfig{}
+	}
+	return index
+}
+
+func loadCache() CacheConfig {
+	viper.SetDefault("Cache.type", "memory")
+	viper.SetDefault("Cache.ttl", 24*time.Hour)
+	viper.SetDefault("Cache.maxEntries", 100000)
+	viper.SetDefault("Cache.redis.prefix", "go_frontend:")
+	viper.SetDefault("Cache.lockTimeout", 5*time.Second)
+	viper.SetDefault("Cache.negativeTTL", 30*time.Second)
+	viper.SetDefault("Cache.snapshot.interval", 5*time.Minute)
+	var cache CacheConfig
+	if err := viper.UnmarshalKey("Cache", &cache); err != nil {
+		return CacheConfig{Type: "memory", TTL: 24 * time.Hour, MaxEntries: 100000}
+	}
+	return cache
+}
+
+func loadWarm() WarmConfig {
+	viper.SetDefault("Warm.interval", 10*time.Minute)
+	viper.SetDefault("Warm.activeWindow", 24*time.Hour)
+	viper.SetDefault("Warm.limit", 10)
+	viper.SetDefault("Warm.concurrency", 2)
+	viper.SetDefault("Warm.ratePerSecond", 5)
+	var warm WarmConfig
+	if err := viper.UnmarshalKey("Warm", &warm); err != nil {
+		return WarmConfig{}
+	}
+	return warm
+}
+
+func loadStrm() StrmConfig {
+	var strm StrmConfig
+	if err := viper.UnmarshalKey("Strm", &strm); err != nil {
+		return StrmConfig{}
+	}
+	return strm
+}
+
+func loadPlaybackInfo() PlaybackInfoConfig {
+	var playbackInfo PlaybackInfoConfig
+	if err := viper.UnmarshalKey("PlaybackInfo", &playbackInfo); err != nil {
+		return PlaybackInfoConfig{}
+	}
+	return playbackInfo
+}
+
+func loadGeoIP() GeoIPConfig {
+	var geoIP GeoIPConfig
+	if err := viper.UnmarshalKey("GeoIP", &geoIP); err != nil {
+		return GeoIPConfig{}
+	}
+	return geoIP
+}
+
 func loadSpecialMedias() []SpecialMediaConfig {
 	var specialMedias []SpecialMediaConfig
 	if err := viper.UnmarshalKey("SpecialMedias", &specialMedias); err != nil {
@@ -107,8 +485,9 @@ func (config SpecialMediaConfig) IsValid() bool {
 	return config.Key != "" && config.Name != "" && config.MediaPath != "" && config.ItemId != "" && config.MediaSourceID != ""
 }
 
-func GetFullEmbyURL() string {
-	return util.BuildFullURL(globalConfig.EmbyURL, globalConfig.EmbyPort)
+// FullURL 返回带端口的服务器地址
+func (server *ServerConfig) FullURL() string {
+	return util.BuildFullURL(server.URL, server.Port)
 }
 
 func defaultLogLevel(loglevel string) string {
@@ -116,6 +495,20 @@ func defaultLogLevel(loglevel string) string {
 	return "INFO"
 }
 
+// getServerType 服务器未指定类型时使用顶层的 ServerType
+func getServerType(serverType string) string {
+	if serverType == "" {
+		serverType = viper.GetString("ServerType")
+	}
+	switch {
+	case strings.EqualFold(serverType, ServerTypeJellyfin):
+		return ServerTypeJellyfin
+	case strings.EqualFold(serverType, ServerTypePlex):
+		return ServerTypePlex
+	}
+	return ServerTypeEmby
+}
+
 func getLogLevel(loglevel string) string {
 	if loglevel != "" { return loglevel }
 	return viper.GetString("LogLevel")
@@ -0,0 +1,41 @@
+package config
+
+import "Go_Frontend/util"
+
+// defaultServerName 旧的单服务器配置使用的服务器名称
+const defaultServerName = "default"
+
+// DefaultServer 返回未配置 Hosts 的第一个服务器，都配置了 Hosts 时返回第一个服务器
+func DefaultServer() *ServerConfig {
+	for i := range globalConfig.Servers {
+		if len(globalConfig.Servers[i].Hosts) == 0 {
+			return &globalConfig.Servers[i]
+		}
+	}
+	if len(globalConfig.Servers) == 0 {
+		return nil
+	}
+	return &globalConfig.Servers[0]
+}
+
+// GetServer 按名称查找服务器，不存在时返回 nil
+func GetServer(name string) *ServerConfig {
+	for i := range globalConfig.Servers {
+		if globalConfig.Servers[i].Name == name {
+			return &globalConfig.Servers[i]
+		}
+	}
+	return nil
+}
+
+// MatchServer 返回 Hosts 中有模式匹配 host 的第一个服务器，host 可以带端口；模式见 util.MatchHost
+func MatchServer(host string) (*ServerConfig, bool) {
+	for i := range globalConfig.Servers {
+		for _, pattern := range globalConfig.Servers[i].Hosts {
+			if util.MatchHost(pattern, host) {
+				return &globalConfig.Servers[i], true
+			}
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,24 @@
+package config
+
+import "testing"
+
+func TestMatchServer(t *testing.T) {
+	saved := globalConfig
+	defer func() { globalConfig = saved }()
+
+	globalConfig = Config{Servers: []ServerConfig{
+		{Name: "family", Hosts: []string{"family.example.com"}},
+		{Name: "friends", Hosts: []string{"*.friends.example.com"}},
+		{Name: "fallback"},
+	}}
+
+	if server, ok := MatchServer("tv.friends.example.com:443"); !ok || server.Name != "friends" {
+		t.Errorf("MatchServer(friends) = %v, %v", server, ok)
+	}
+	if _, ok := MatchServer("127.0.0.1"); ok {
+		t.Error("MatchServer(127.0.0.1) matched, want no match")
+	}
+	if server := DefaultServer(); server.Name != "fallback" {
+		t.Errorf("DefaultServer() = %s, want fallback", server.Name)
+	}
+}
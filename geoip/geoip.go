@@ -0,0 +1,173 @@
+// Package geoip resolves client addresses against local MaxMind / DB-IP databases
+// for geo-routing and geo-blocking.
+package geoip
+
+import (
+	"Go_Frontend/config"
+	"Go_Frontend/logger"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Location is the lookup result for a client address.
+type Location struct {
+	IP      string
+	Country string // ISO 3166-1 alpha-2, empty when unknown
+	ASN     uint
+	ASOrg   string
+	Private bool // loopback, link-local or RFC 1918 address
+}
+
+// String formats the location for log lines, e.g. "203.0.113.7 HK AS4760 (HKT)".
+func (l Location) String() string {
+	var b strings.Builder
+	b.WriteString(l.IP)
+	switch {
+	case l.Private:
+		b.WriteString(" private")
+	case l.Country != "":
+		b.WriteString(" ")
+		b.WriteString(l.Country)
+	default:
+		b.WriteString(" unknown")
+	}
+	if l.ASN != 0 {
+		fmt.Fprintf(&b, " AS%d", l.ASN)
+		if l.ASOrg != "" {
+			fmt.Fprintf(&b, " (%s)", l.ASOrg)
+		}
+	}
+	return b.String()
+}
+
+// countryRecord matches the country block shared by GeoLite2/GeoIP2 Country and City
+// and the DB-IP country/city lite databases.
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// asnRecord matches GeoLite2-ASN and DB-IP ASN lite.
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+var (
+	countryDB *maxminddb.Reader
+	asnDB     *maxminddb.Reader
+	policy    config.GeoPolicyConfig
+)
+
+// Initialize opens the configured databases. GeoIP stays disabled when no database is configured.
+func Initialize(cfg config.GeoIPConfig) error {
+	policy = cfg.Policy
+	policy.Mode = strings.ToLower(policy.Mode)
+	if policy.Mode != "" && policy.Mode != "allow" && policy.Mode != "deny" {
+		return fmt.Errorf("invalid GeoIP policy mode %q, expected allow or deny", cfg.Policy.Mode)
+	}
+
+	if cfg.Database != "" {
+		db, err := maxminddb.Open(cfg.Database)
+		if err != nil {
+			return fmt.Errorf("open GeoIP database: %w", err)
+		}
+		countryDB = db
+		logger.Info("GeoIP database loaded: %s (%s)", cfg.Database, db.Metadata.DatabaseType)
+	}
+	if cfg.ASNDatabase != "" {
+		db, err := maxminddb.Open(cfg.ASNDatabase)
+		if err != nil {
+			return fmt.Errorf("open ASN database: %w", err)
+		}
+		asnDB = db
+		logger.Info("ASN database loaded: %s (%s)", cfg.ASNDatabase, db.Metadata.DatabaseType)
+	}
+	return nil
+}
+
+// Enabled reports whether any database is loaded.
+func Enabled() bool {
+	return countryDB != nil || asnDB != nil
+}
+
+// Lookup resolves ip. Fields that cannot be resolved are left empty.
+func Lookup(ip string) Location {
+	loc := Location{IP: ip}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return loc
+	}
+	if parsed.IsLoopback() || parsed.IsPrivate() || parsed.IsLinkLocalUnicast() {
+		loc.Private = true
+		return loc
+	}
+
+	if countryDB != nil {
+		var record countryRecord
+		if err := countryDB.Lookup(parsed, &record); err != nil {
+			logger.Warn("GeoIP lookup failed for %s: %v", ip, err)
+		}
+		loc.Country = record.Country.ISOCode
+		if loc.Country == "" {
+			loc.Country = record.RegisteredCountry.ISOCode
+		}
+	}
+	if asnDB != nil {
+		var record asnRecord
+		if err := asnDB.Lookup(parsed, &record); err != nil {
+			logger.Warn("ASN lookup failed for %s: %v", ip, err)
+		}
+		loc.ASN = record.Number
+		loc.ASOrg = record.Organization
+	}
+	return loc
+}
+
+// Allowed applies the allow/deny policy. Private addresses are always allowed, and in
+// allow mode a public address whose country and ASN are both unknown is blocked.
+func Allowed(loc Location) bool {
+	if loc.Private || policy.Mode == "" {
+		return true
+	}
+	listed := matches(loc, policy.Countries, policy.ASNs)
+	if policy.Mode == "allow" {
+		return listed
+	}
+	return !listed
+}
+
+// ResolveURL returns the URL of the first backend mirror serving loc, or the backend's own URL.
+func ResolveURL(backend config.BackendConfig, loc Location) string {
+	for _, mirror := range backend.Mirrors {
+		if matches(loc, mirror.Countries, mirror.ASNs) {
+			return mirror.URL
+		}
+	}
+	return backend.URL
+}
+
+func matches(loc Location, countries []string, asns []uint) bool {
+	if loc.Country != "" {
+		for _, country := range countries {
+			if strings.EqualFold(country, loc.Country) {
+				return true
+			}
+		}
+	}
+	if loc.ASN != 0 {
+		for _, asn := range asns {
+			if asn == loc.ASN {
+				return true
+			}
+		}
+	}
+	return false
+}
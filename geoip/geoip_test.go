@@ -0,0 +1,209 @@
+package geoip
+
+import (
+	"Go_Frontend/config"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestDatabase writes an IPv4 MaxMind DB mapping each network to its record. Records hold
+// strings, uint32 numbers and nested maps, which is all the country and ASN databases need.
+func writeTestDatabase(t *testing.T, databaseType string, networks map[string]map[string]any) string {
+	t.Helper()
+
+	// Search tree: a record is 0 while unset, the index of the next node, or -(k+1) for data k
+	nodes := [][2]int{{0, 0}}
+	var data [][]byte
+	for cidr, record := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, _ := network.Mask.Size()
+		ip := network.IP.To4()
+		node := 0
+		for i := 0; i < ones; i++ {
+			bit := int(ip[i/8]>>(7-i%8)) & 1
+			if i == ones-1 {
+				nodes[node][bit] = -(len(data) + 1)
+				break
+			}
+			if nodes[node][bit] <= 0 {
+				nodes = append(nodes, [2]int{})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+		data = append(data, encodeTestValue(record))
+	}
+
+	nodeCount := len(nodes)
+	offsets := make([]int, len(data))
+	var section []byte
+	for i, value := range data {
+		offsets[i] = len(section)
+		section = append(section, value...)
+	}
+	var buf bytes.Buffer
+	for _, node := range nodes {
+		for _, record := range node {
+			value := nodeCount // not found
+			switch {
+			case record > 0:
+				value = record
+			case record < 0:
+				value = nodeCount + 16 + offsets[-record-1]
+			}
+			buf.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+		}
+	}
+	buf.Write(make([]byte, 16))
+	buf.Write(section)
+	buf.WriteString("\xAB\xCD\xEFMaxMind.com")
+	buf.Write(encodeTestValue(map[string]any{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(24),
+		"ip_version":                  uint16(4),
+		"database_type":               databaseType,
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+	}))
+
+	path := filepath.Join(t.TempDir(), databaseType+".mmdb")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func encodeTestValue(value any) []byte {
+	control := func(kind, size int) []byte {
+		if size >= 29 {
+			return []byte{byte(kind<<5 | 29), byte(size - 29)}
+		}
+		return []byte{byte(kind<<5 | size)}
+	}
+	switch v := value.(type) {
+	case string:
+		return append(control(2, len(v)), v...)
+	case uint16:
+		return append(control(5, 2), byte(v>>8), byte(v))
+	case uint32:
+		return binary.BigEndian.AppendUint32(control(6, 4), v)
+	case map[string]any:
+		out := control(7, len(v))
+		for key, item := range v {
+			out = append(out, encodeTestValue(key)...)
+			out = append(out, encodeTestValue(item)...)
+		}
+		return out
+	}
+	panic(fmt.Sprintf("unsupported value %T", value))
+}
+
+func useTestDatabases(t *testing.T, policyConfig config.GeoPolicyConfig) {
+	t.Helper()
+	cfg := config.GeoIPConfig{
+		Database: writeTestDatabase(t, "GeoLite2-Country", map[string]map[string]any{
+			"203.0.113.0/24":  {"country": map[string]any{"iso_code": "HK"}},
+			"198.51.100.0/24": {"registered_country": map[string]any{"iso_code": "JP"}},
+		}),
+		ASNDatabase: writeTestDatabase(t, "GeoLite2-ASN", map[string]map[string]any{
+			"203.0.113.0/24": {"autonomous_system_number": uint32(4760), "autonomous_system_organization": "HKT"},
+			"192.0.2.0/24":   {"autonomous_system_number": uint32(64500), "autonomous_system_organization": "Example"},
+		}),
+		Policy: policyConfig,
+	}
+	t.Cleanup(func() {
+		countryDB, asnDB, policy = nil, nil, config.GeoPolicyConfig{}
+	})
+	if err := Initialize(cfg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	useTestDatabases(t, config.GeoPolicyConfig{})
+	if !Enabled() {
+		t.Fatal("GeoIP is not enabled with databases loaded")
+	}
+
+	tests := []struct {
+		ip   string
+		want Location
+		text string
+	}{
+		{"203.0.113.7", Location{IP: "203.0.113.7", Country: "HK", ASN: 4760, ASOrg: "HKT"}, "203.0.113.7 HK AS4760 (HKT)"},
+		{"198.51.100.1", Location{IP: "198.51.100.1", Country: "JP"}, "198.51.100.1 JP"}, // registered country
+		{"192.0.2.1", Location{IP: "192.0.2.1", ASN: 64500, ASOrg: "Example"}, "192.0.2.1 unknown AS64500 (Example)"},
+		{"100.64.0.1", Location{IP: "100.64.0.1"}, "100.64.0.1 unknown"},
+		{"10.1.2.3", Location{IP: "10.1.2.3", Private: true}, "10.1.2.3 private"},
+		{"127.0.0.1", Location{IP: "127.0.0.1", Private: true}, "127.0.0.1 private"},
+		{"::1", Location{IP: "::1", Private: true}, "::1 private"},
+		{"fe80::1", Location{IP: "fe80::1", Private: true}, "fe80::1 private"},
+		{"not-an-ip", Location{IP: "not-an-ip"}, "not-an-ip unknown"},
+	}
+	for _, test := range tests {
+		got := Lookup(test.ip)
+		if got != test.want {
+			t.Errorf("Lookup(%s) = %+v, want %+v", test.ip, got, test.want)
+		}
+		if got.String() != test.text {
+			t.Errorf("Lookup(%s).String() = %q, want %q", test.ip, got.String(), test.text)
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	hongKong := Location{IP: "203.0.113.7", Country: "HK", ASN: 4760}
+	japan := Location{IP: "198.51.100.1", Country: "JP"}
+	asnOnly := Location{IP: "192.0.2.1", ASN: 64500}
+	unknown := Location{IP: "100.64.0.1"}
+	private := Location{IP: "10.1.2.3", Private: true}
+
+	tests := []struct {
+		policy  config.GeoPolicyConfig
+		allowed []Location
+		blocked []Location
+	}{
+		{
+			policy:  config.GeoPolicyConfig{},
+			allowed: []Location{hongKong, japan, asnOnly, unknown, private},
+		},
+		{
+			policy:  config.GeoPolicyConfig{Mode: "Allow", Countries: []string{"hk"}, ASNs: []uint{64500}},
+			allowed: []Location{hongKong, asnOnly, private},
+			blocked: []Location{japan, unknown},
+		},
+		{
+			policy:  config.GeoPolicyConfig{Mode: "deny", Countries: []string{"JP"}, ASNs: []uint{4760}},
+			allowed: []Location{asnOnly, unknown, private},
+			blocked: []Location{hongKong, japan},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.policy.Mode, func(t *testing.T) {
+			useTestDatabases(t, test.policy)
+			for _, loc := range test.allowed {
+				if !Allowed(loc) {
+					t.Errorf("%s was blocked", loc)
+				}
+			}
+			for _, loc := range test.blocked {
+				if Allowed(loc) {
+					t.Errorf("%s was allowed", loc)
+				}
+			}
+		})
+	}
+
+	t.Cleanup(func() { policy = config.GeoPolicyConfig{} })
+	if err := Initialize(config.GeoIPConfig{Policy: config.GeoPolicyConfig{Mode: "block"}}); err == nil {
+		t.Error("invalid policy mode was accepted")
+	}
+}
@@ -0,0 +1,272 @@
+// Package library keeps a local index of media paths so that playback does not need a
+// PlaybackInfo request per item. A background syncer pages through the library of every
+// server, incrementally via MinDateLastSaved, and persists the index to disk.
+package library
+
+import (
+	"Go_Frontend/api"
+	"Go_Frontend/config"
+	"Go_Frontend/logger"
+	"Go_Frontend/util"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Index maps the items of one server to the paths of their media sources.
+type Index struct {
+	server string
+
+	mu           sync.RWMutex
+	items        map[string]map[string]Source // item ID -> media source ID -> source, both normalized
+	lastSync     time.Time
+	lastFullSync time.Time
+}
+
+// snapshot is the on-disk form of an Index.
+type snapshot struct {
+	Server       string                       `json:"server"`
+	LastSync     time.Time                    `json:"lastSync"`
+	LastFullSync time.Time                    `json:"lastFullSync"`
+	Items        map[string]map[string]Source `json:"items"`
+}
+
+// Source is the indexed part of a media source: its path and the metadata sent to backends as hints.
+type Source struct {
+	Path         string `json:"path"`
+	Container    string `json:"container,omitempty"`
+	Size         int64  `json:"size,omitempty"`
+	RunTimeTicks int64  `json:"runTimeTicks,omitempty"`
+}
+
+// UnmarshalJSON also accepts the bare path that older snapshots stored.
+func (s *Source) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*s = Source{}
+		return json.Unmarshal(data, &s.Path)
+	}
+	type plain Source
+	return json.Unmarshal(data, (*plain)(s))
+}
+
+var (
+	indexCfg config.IndexConfig
+	// indexes is built by Initialize and only read afterwards.
+	indexes map[string]*Index
+)
+
+// Initialize creates an index for every server and loads the persisted snapshots.
+// Syncing only starts with Start.
+func Initialize(cfg config.IndexConfig, servers []config.ServerConfig) error {
+	indexCfg = cfg
+	indexes = nil
+	if !cfg.Enabled {
+		return nil
+	}
+
+	loaded := make(map[string]*Index, len(servers))
+	for _, server := range servers {
+		idx := &Index{server: server.Name, items: make(map[string]map[string]Source)}
+		if err := idx.load(); err != nil {
+			return err
+		}
+		loaded[server.Name] = idx
+	}
+	indexes = loaded
+	return nil
+}
+
+// Enabled reports whether the library index is in use.
+func Enabled() bool {
+	return indexes != nil
+}
+
+// Save persists every index, so that removals since the last sync survive a restart.
+func Save() error {
+	var errs []error
+	for _, idx := range indexes {
+		if err := idx.save(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Lookup returns the indexed path and metadata of a media source.
+func Lookup(server, itemID, mediaSourceID string) (*api.MediaSourceInfo, bool) {
+	idx := indexes[server]
+	if idx == nil {
+		return nil, false
+	}
+	idx.mu.RLock()
+	source, ok := idx.items[api.NormalizeID(itemID)][api.NormalizeID(mediaSourceID)]
+	idx.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return &api.MediaSourceInfo{
+		ID:           mediaSourceID,
+		Path:         source.Path,
+		Container:    source.Container,
+		Size:         source.Size,
+		RunTimeTicks: source.RunTimeTicks,
+	}, true
+}
+
+// FindItem returns the ID of the item owning a media source. Plex clients request parts
+// without naming their item; this scans the index, so callers should cache the result.
+func FindItem(server, mediaSourceID string) (string, bool) {
+	idx := indexes[server]
+	if idx == nil {
+		return "", false
+	}
+	key := api.NormalizeID(mediaSourceID)
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	for itemID, sources := range idx.items {
+		if _, ok := sources[key]; ok {
+			return itemID, true
+		}
+	}
+	return "", false
+}
+
+// Remove drops an item from the index of server and reports whether it was indexed.
+func Remove(server, itemID string) bool {
+	idx := indexes[server]
+	if idx == nil {
+		return false
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	key := api.NormalizeID(itemID)
+	_, found := idx.items[key]
+	delete(idx.items, key)
+	return found
+}
+
+// RemoveUnder drops every item with a media source at or below dir, matching whole
+// path segments, and returns the normalized IDs of the removed items.
+func RemoveUnder(server, dir string) []string {
+	idx := indexes[server]
+	dir = strings.TrimRight(dir, `/\`)
+	if idx == nil || dir == "" {
+		return nil
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	var removed []string
+	for itemID, sources := range idx.items {
+		for _, source := range sources {
+			if IsUnder(source.Path, dir) {
+				removed = append(removed, itemID)
+				delete(idx.items, itemID)
+				break
+			}
+		}
+	}
+	return removed
+}
+
+// IsUnder reports whether path p is dir or lies below it, matching whole path segments.
+// dir must not end with a separator.
+func IsUnder(p, dir string) bool {
+	if !strings.HasPrefix(p, dir) {
+		return false
+	}
+	return len(p) == len(dir) || p[len(dir)] == '/' || p[len(dir)] == '\\'
+}
+
+// Len returns the number of indexed items.
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.items)
+}
+
+// replace swaps in the result of a full sync.
+func (idx *Index) replace(items map[string]map[string]Source, syncedAt time.Time) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.items = items
+	idx.lastSync = syncedAt
+	idx.lastFullSync = syncedAt
+}
+
+// merge applies the result of an incremental sync. An item's sources are replaced as a whole.
+func (idx *Index) merge(items map[string]map[string]Source, syncedAt time.Time) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for itemID, sources := range items {
+		idx.items[itemID] = sources
+	}
+	idx.lastSync = syncedAt
+}
+
+// file returns where the index is persisted, or "" when persistence is off.
+func (idx *Index) file() string {
+	if indexCfg.Dir == "" {
+		return ""
+	}
+	return filepath.Join(indexCfg.Dir, idx.server+".json")
+}
+
+func (idx *Index) load() error {
+	file := idx.file()
+	if file == "" {
+		return nil
+	}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read library index: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		// A corrupt index is only a cache: start over with a full sync
+		logger.Warn("Ignoring unreadable library index %s: %v", file, err)
+		return nil
+	}
+	if snap.Items != nil {
+		idx.items = snap.Items
+	}
+	idx.lastSync = snap.LastSync
+	idx.lastFullSync = snap.LastFullSync
+	logger.Info("Loaded library index of server %s with %d items (synced %s)", idx.server, len(idx.items), snap.LastSync.Format(time.RFC3339))
+	return nil
+}
+
+func (idx *Index) save() error {
+	file := idx.file()
+	if file == "" {
+		return nil
+	}
+
+	idx.mu.RLock()
+	data, err := json.Marshal(snapshot{
+		Server:       idx.server,
+		LastSync:     idx.lastSync,
+		LastFullSync: idx.lastFullSync,
+		Items:        idx.items,
+	})
+	idx.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(indexCfg.Dir, 0o755); err != nil {
+		return fmt.Errorf("write library index: %w", err)
+	}
+	if err := util.WriteFileAtomic(file, data); err != nil {
+		return fmt.Errorf("write library index: %w", err)
+	}
+	return nil
+}
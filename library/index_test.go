@@ -0,0 +1,58 @@
+package library
+
+import (
+	"Go_Frontend/config"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRemove(t *testing.T) {
+	cfg := config.IndexConfig{Enabled: true}
+	if err := Initialize(cfg, []config.ServerConfig{{Name: "test"}}); err != nil {
+		t.Fatal(err)
+	}
+	indexes["test"].items = map[string]map[string]Source{
+		"1": {"a": {Path: "/mnt/gd/Show/S01/e1.mkv"}},
+		"2": {"b": {Path: "/mnt/gd/Show/S01/e2.mkv"}},
+		"3": {"c": {Path: "/mnt/gd/Show 2/e1.mkv"}},
+		"4": {"d": {Path: "/mnt/gd/Movie.mkv"}},
+	}
+
+	if itemID, ok := FindItem("test", "b"); !ok || itemID != "2" {
+		t.Errorf("FindItem(b) = %q, %v; want item 2", itemID, ok)
+	}
+
+	removed := RemoveUnder("test", "/mnt/gd/Show/")
+	slices.Sort(removed)
+	if !slices.Equal(removed, []string{"1", "2"}) {
+		t.Errorf("RemoveUnder(/mnt/gd/Show/) = %v, want [1 2]", removed)
+	}
+	if _, ok := Lookup("test", "3", "c"); !ok {
+		t.Error("RemoveUnder removed a sibling directory sharing the prefix")
+	}
+
+	if !Remove("test", "4") || Remove("test", "4") {
+		t.Error("Remove should report the item only while it is indexed")
+	}
+	if RemoveUnder("unknown", "/mnt") != nil || Remove("unknown", "1") {
+		t.Error("removing from an unknown server should be a no-op")
+	}
+}
+
+func TestLoadLegacySnapshot(t *testing.T) {
+	dir := t.TempDir()
+	legacy := `{"server":"test","items":{"1":{"a":"/mnt/gd/1.mkv"}}}`
+	if err := os.WriteFile(filepath.Join(dir, "test.json"), []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.IndexConfig{Enabled: true, Dir: dir}
+	if err := Initialize(cfg, []config.ServerConfig{{Name: "test"}}); err != nil {
+		t.Fatal(err)
+	}
+	if source, ok := Lookup("test", "1", "a"); !ok || source.Path != "/mnt/gd/1.mkv" {
+		t.Errorf("Lookup(1, a) = %+v, %v; snapshots storing bare paths must still load", source, ok)
+	}
+}
@@ -0,0 +1,115 @@
+package library
+
+import (
+	"Go_Frontend/api"
+	"Go_Frontend/config"
+	"Go_Frontend/logger"
+	"context"
+	"time"
+)
+
+// syncOverlap is subtracted from the previous sync time in incremental syncs, so items
+// saved while that sync was running, or under clock skew with the server, are not missed.
+const syncOverlap = time.Minute
+
+// Start launches one background syncer per server. It returns immediately.
+func Start(ctx context.Context) {
+	if !Enabled() {
+		return
+	}
+	for i := range config.GetConfig().Servers {
+		server := &config.GetConfig().Servers[i]
+		go run(ctx, server, indexes[server.Name])
+	}
+}
+
+// run syncs the index right away and then every Interval, doing a full sync whenever
+// the last one is older than FullInterval.
+func run(ctx context.Context, server *config.ServerConfig, idx *Index) {
+	interval := indexCfg.Interval
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+
+	for {
+		idx.mu.RLock()
+		full := time.Since(idx.lastFullSync) >= indexCfg.FullInterval || idx.lastSync.IsZero()
+		idx.mu.RUnlock()
+
+		if err := syncIndex(ctx, server, idx, full); err != nil {
+			logger.Error("Library index sync of server %s failed: %v", server.Name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// syncIndex pages through the library of server. A full sync rebuilds the index, dropping
+// deleted items; an incremental one only fetches items saved since the previous sync.
+func syncIndex(ctx context.Context, server *config.ServerConfig, idx *Index, full bool) error {
+	started := time.Now()
+	query := api.LibraryQuery{Limit: indexCfg.PageSize}
+	if query.Limit <= 0 {
+		query.Limit = 500
+	}
+	if !full {
+		idx.mu.RLock()
+		query.MinDateLastSaved = idx.lastSync.Add(-syncOverlap)
+		idx.mu.RUnlock()
+	}
+
+	mediaServer := api.NewMediaServer(server)
+	items := make(map[string]map[string]Source)
+	for {
+		page, err := mediaServer.ListItems(ctx, query)
+		if err != nil {
+			return err
+		}
+		for _, item := range page.Items {
+			addItem(items, item)
+		}
+		query.StartIndex += len(page.Items)
+		if len(page.Items) == 0 || query.StartIndex >= page.TotalRecordCount {
+			break
+		}
+	}
+
+	if full {
+		idx.replace(items, started)
+	} else {
+		idx.merge(items, started)
+	}
+	if err := idx.save(); err != nil {
+		logger.Error("Failed to persist library index of server %s: %v", server.Name, err)
+	}
+
+	kind := "Incremental"
+	if full {
+		kind = "Full"
+	}
+	logger.Info("%s library index sync of server %s: %d items fetched, %d indexed, took %s",
+		kind, server.Name, len(items), idx.Len(), time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+// addItem records the media sources of item. Items without sources are skipped.
+func addItem(items map[string]map[string]Source, item api.LibraryItem) {
+	sources := make(map[string]Source, len(item.MediaSources))
+	for _, source := range item.MediaSources {
+		if source.ID != "" && source.Path != "" {
+			sources[api.NormalizeID(source.ID)] = Source{
+				Path:         source.Path,
+				Container:    source.Container,
+				Size:         source.Size,
+				RunTimeTicks: source.RunTimeTicks,
+			}
+		}
+	}
+	if len(sources) > 0 {
+		items[api.NormalizeID(item.ID)] = sources
+	}
+}
@@ -0,0 +1,87 @@
+package library
+
+import (
+	"Go_Frontend/api"
+	"Go_Frontend/config"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// fakeLibrary serves /Items from items, honouring StartIndex and Limit. When
+// MinDateLastSaved is set it only returns changed.
+func fakeLibrary(t *testing.T, items, changed *[]api.LibraryItem) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		source := *items
+		if r.URL.Query().Get("MinDateLastSaved") != "" {
+			source = *changed
+		}
+		start, _ := strconv.Atoi(r.URL.Query().Get("StartIndex"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("Limit"))
+		end := min(start+limit, len(source))
+		json.NewEncoder(w).Encode(api.LibraryPage{Items: source[start:end], TotalRecordCount: len(source)})
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func item(id, sourceID, path string) api.LibraryItem {
+	return api.LibraryItem{ID: id, MediaSources: []api.MediaSourceInfo{{ID: sourceID, Path: path, Container: "mkv", Size: 1 << 30}}}
+}
+
+func TestSyncIndex(t *testing.T) {
+	items := []api.LibraryItem{
+		item("1", "a", "/mnt/gd/1.mkv"),
+		item("2", "b", "/mnt/gd/2.mkv"),
+		item("3", "c", "/mnt/gd/3.mkv"),
+		{ID: "4"}, // no media sources
+	}
+	changed := []api.LibraryItem{item("2", "b", "/mnt/gd/moved/2.mkv")}
+	ts := fakeLibrary(t, &items, &changed)
+
+	server := config.ServerConfig{Name: "test", Type: config.ServerTypeEmby, URL: ts.URL}
+	dir := t.TempDir()
+	cfg := config.IndexConfig{Enabled: true, Dir: dir, PageSize: 2}
+	if err := Initialize(cfg, []config.ServerConfig{server}); err != nil {
+		t.Fatal(err)
+	}
+	idx := indexes["test"]
+
+	if err := syncIndex(context.Background(), &server, idx, true); err != nil {
+		t.Fatal(err)
+	}
+	if idx.Len() != 3 {
+		t.Fatalf("indexed %d items after full sync, want 3", idx.Len())
+	}
+	if s, ok := Lookup("test", "3", "C"); !ok || s.Path != "/mnt/gd/3.mkv" || s.Container != "mkv" || s.Size != 1<<30 {
+		t.Errorf("Lookup(3, C) = %+v, %v", s, ok)
+	}
+
+	if err := syncIndex(context.Background(), &server, idx, false); err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := Lookup("test", "2", "b"); !ok || s.Path != "/mnt/gd/moved/2.mkv" {
+		t.Errorf("Lookup(2, b) after incremental sync = %+v, %v", s, ok)
+	}
+
+	// Deleted items disappear with the next full sync
+	items = items[:1]
+	if err := syncIndex(context.Background(), &server, idx, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Lookup("test", "3", "c"); ok {
+		t.Error("deleted item 3 is still indexed after a full sync")
+	}
+
+	// The persisted snapshot is picked up again
+	if err := Initialize(cfg, []config.ServerConfig{server}); err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := Lookup("test", "1", "a"); !ok || s.Path != "/mnt/gd/1.mkv" || s.Size != 1<<30 {
+		t.Errorf("Lookup(1, a) after reload = %+v, %v", s, ok)
+	}
+}
@@ -65,7 +65,7 @@ func (l *Logger) log(level int, format string, args ...interface{}) {
 	}
 
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	msg := fmt.Sprintf(format, args...)
+	msg := Redact(fmt.Sprintf(format, args...))
 	fmt.Printf("%s %s %s\n", colorFunc(timestamp), colorFunc(levelStr), msg)
 }
 
@@ -0,0 +1,32 @@
+package logger
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	cases := []struct {
+		in     string
+		secret string
+	}{
+		{"GET /Items/1/PlaybackInfo?MediaSourceId=2&api_key=6a15d65893024675", "6a15d65893024675"},
+		{"https://stream.example.com/stream?path=a.mkv&signature=eyJkYXRhIjoi+/abc==", "eyJkYXRhIjoi+/abc=="},
+		{"Request Headers: map[Accept:[*/*] X-Emby-Token:[0123abcd]]", "0123abcd"},
+		{`Authorization: MediaBrowser Client="Web", Token="0123abcd"`, "0123abcd"},
+		{"Authorization: Bearer s3cr3t-admin", "s3cr3t-admin"},
+		{`Request Body: {"Username":"alice","Pw":"hunter2"}`, "hunter2"},
+		{"/library/parts/1/2/file.mkv?X-Plex-Token=plexsecret", "plexsecret"},
+		{"https://alist.example.com/d/gd/a.mkv?sign=Z1y5SuSKqh-lYrw6:1700000000", "Z1y5SuSKqh-lYrw6"},
+	}
+	for _, tc := range cases {
+		out := Redact(tc.in)
+		if strings.Contains(out, tc.secret) {
+			t.Errorf("Redact(%q) = %q, still contains the secret", tc.in, out)
+		}
+	}
+
+	if in := "Matched backend: GoogleDrive path=Movies/a.mkv"; Redact(in) != in {
+		t.Errorf("Redact changed a line without secrets: %q", Redact(in))
+	}
+}
@@ -1,25 +1,38 @@
 package main
 
 import (
+	"Go_Frontend/admin"
 	"Go_Frontend/config"
+	"Go_Frontend/geoip"
+	"Go_Frontend/library"
 	"Go_Frontend/logger"
 	"Go_Frontend/middleware"
+	"Go_Frontend/route"
 	"Go_Frontend/stream"
+	"Go_Frontend/strm"
+	"Go_Frontend/webhook"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
     // ✅ 优化: 自动适配容器 CPU
 	_ "go.uber.org/automaxprocs"
 )
 
 // initializeConfig initializes the configuration from the config file.
-func initializeConfig(configFile string) error {
+// A non-empty loglevel overrides the level from the config file.
+func initializeConfig(configFile string, loglevel string) error {
 	logger.Info("Initializing config...")
 
-	err := config.Initialize(configFile, "")
+	err := config.Initialize(configFile, loglevel)
 	if err != nil {
 		log.Printf("Error initializing config: %v", err)
 		return err
@@ -28,17 +41,65 @@ func initializeConfig(configFile string) error {
 	logger.Info("Configuration initialized successfully")
 
 	// Set up logger based on configuration log level
-	loglevel := config.GetConfig().LogLevel
-	logger.InitializeLogger(loglevel)
+	logger.InitializeLogger(config.GetConfig().LogLevel)
 
 	// Initialize the Signature instance
 	encipher := config.GetConfig().Encipher
 	if err := stream.InitializeSignature(encipher); err != nil {
-		logger.Error("Failed to initialize Signature", "error", err)
+		logger.Error("Failed to initialize Signature: %v", err)
 		return err
 	}
 	logger.Info("Signature initialized successfully")
 
+	stream.InitializeAuth(config.GetConfig().Auth)
+	stream.InitializeAccess(config.GetConfig().Access)
+	if err := stream.InitializeMediaSource(config.GetConfig().MediaSource); err != nil {
+		logger.Error("Invalid media source selection: %v", err)
+		return err
+	}
+	if err := stream.InitializeHints(config.GetConfig().Hints); err != nil {
+		logger.Error("Invalid signed hints: %v", err)
+		return err
+	}
+
+	// Compile the backend routing table, including runtime changes made through the admin API.
+	// The cache snapshot is checked against these effective rules, so load them first
+	cfg := config.GetConfig()
+	if err := route.Load(cfg.Servers, cfg.Admin.StateFile); err != nil {
+		logger.Error("Failed to load backends: %v", err)
+		return err
+	}
+
+	if err := stream.InitializeCache(config.GetConfig().Cache); err != nil {
+		logger.Error("Failed to initialize cache: %v", err)
+		return err
+	}
+
+	if err := stream.InitializeWarm(config.GetConfig().Warm); err != nil {
+		logger.Error("Invalid cache warming: %v", err)
+		return err
+	}
+
+	if err := stream.InitializeSpecialMedia(config.GetConfig().Servers, config.GetConfig().Timezone); err != nil {
+		logger.Error("Invalid special media schedule: %v", err)
+		return err
+	}
+
+	if err := library.Initialize(cfg.Index, cfg.Servers); err != nil {
+		logger.Error("Failed to load library index: %v", err)
+		return err
+	}
+
+	if err := strm.Initialize(cfg.Strm); err != nil {
+		logger.Error("Failed to initialize STRM rules: %v", err)
+		return err
+	}
+
+	if err := geoip.Initialize(cfg.GeoIP); err != nil {
+		logger.Error("Failed to initialize GeoIP: %v", err)
+		return err
+	}
+
 	return nil
 }
 
@@ -46,36 +107,110 @@ func initializeConfig(configFile string) error {
 func initializeRoutes(r *gin.Engine) {
 	logger.Info("Initializing routes...")
 
-	paths := []string{
+	embyPaths := []string{
 		"/emby/videos/:itemID/original.:type",
 		"/videos/:itemID/original.:type",
 		"/emby/videos/:itemID/stream.:type",
 		"/emby/Videos/:itemID/stream.:type",
 		"/Videos/:itemID/stream",
 	}
+	jellyfinPaths := []string{
+		"/Videos/:itemID/stream",
+		"/Videos/:itemID/stream.:type",
+		"/videos/:itemID/stream",
+		"/videos/:itemID/stream.:type",
+		"/Audio/:itemID/universal",
+		"/Audio/:itemID/stream",
+		"/Audio/:itemID/stream.:type",
+	}
 
-	for _, path := range paths {
-		r.GET(path, stream.HandleStreamRequest)
+	// Plex direct play: part files, and universal transcode requests with directPlay=1.
+	// gin cannot match the literal colon of /video/:/transcode/..., so everything under /video/
+	// goes to one handler that dispatches on the rest of the path.
+	plexPartPaths := []string{
+		"/library/parts/:partID/:ts/:file",
+	}
+	plexVideoPaths := []string{
+		"/video/*rest",
+	}
+
+	// Register the playback routes of every configured server type; the handler picks the server per request
+	registered := make(map[string]bool)
+	register := func(paths []string, handler gin.HandlerFunc) {
+		for _, path := range paths {
+			if !registered[path] {
+				registered[path] = true
+				r.GET(path, handler)
+			}
+		}
+	}
+	for _, server := range config.GetConfig().Servers {
+		switch server.Type {
+		case config.ServerTypeJellyfin:
+			register(jellyfinPaths, stream.HandleStreamRequest)
+		case config.ServerTypePlex:
+			// Parts that cannot be traced to an item are passed to Plex, which streams them through us
+			// unless the index knows the part or the client can be redirected
+			if !config.GetConfig().Index.Enabled && server.PublicURL == "" {
+				logger.Warn("Plex server %s has neither Index nor publicUrl; unindexed parts are proxied through the frontend", server.Name)
+			}
+			register(plexPartPaths, stream.HandlePlexPart)
+			register(plexVideoPaths, stream.HandlePlexVideo)
+		default:
+			register(embyPaths, stream.HandleStreamRequest)
+		}
+	}
+
+	// PlaybackInfo is proxied to the media server and its media sources rewritten to direct links
+	if config.GetConfig().PlaybackInfo.Enabled {
+		for _, path := range []string{"/Items/:itemID/PlaybackInfo", "/emby/Items/:itemID/PlaybackInfo"} {
+			r.GET(path, stream.HandlePlaybackInfo)
+			r.POST(path, stream.HandlePlaybackInfo)
+		}
+		logger.Info("PlaybackInfo rewriting enabled.")
+	}
+
+	// Webhooks are only accepted when a shared secret is configured
+	if config.GetConfig().Webhook.Secret != "" {
+		r.POST("/webhook", webhook.Handle)
+		logger.Info("Webhook receiver enabled.")
+	}
+
+	// The admin API is only exposed when a token is configured
+	if config.GetConfig().Admin.Token != "" {
+		admin.RegisterRoutes(r.Group("/admin", middleware.AdminAuthMiddleware()))
+		logger.Info("Admin API enabled.")
 	}
 
 	logger.Info("Routes initialized successfully.")
 }
 
 // initializeGinEngine initializes the Gin engine with middlewares and routes.
-func initializeGinEngine() *gin.Engine {
+func initializeGinEngine() (*gin.Engine, error) {
 	logger.Info("Initializing Gin engine...")
 
 	gin.SetMode(gin.ReleaseMode)
-	r := gin.Default()
+	r := gin.New()
+	// The client address decides geo-blocking, mirror selection and remote access, so forwarding
+	// headers are only honoured from the configured proxies
+	if err := r.SetTrustedProxies(config.GetConfig().TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	// Access log goes through the same redaction as the application logger
+	r.Use(gin.LoggerWithWriter(logger.NewRedactingWriter(os.Stdout)), gin.Recovery())
 	r.Use(middleware.CorsMiddleware())
 	initializeRoutes(r)
 
 	logger.Info("Gin engine initialized successfully.")
-	return r
+	return r, nil
 }
 
-// startServer starts the Gin server on the configured port.
-func startServer(r *gin.Engine) error {
+// shutdownTimeout bounds how long in-flight requests may take to finish on shutdown.
+const shutdownTimeout = 30 * time.Second
+
+// startServer serves r on the configured port until ctx is cancelled, then stops
+// accepting connections, waits for in-flight requests and saves the caches.
+func startServer(ctx context.Context, r *gin.Engine) error {
 	logger.Info("Starting the server...")
 
 	port := config.GetConfig().ServerPort
@@ -83,14 +218,43 @@ func startServer(r *gin.Engine) error {
 		port = 60001
 	}
 
-	err := r.Run("0.0.0.0:" + strconv.Itoa(port))
-	if err != nil {
+	srv := &http.Server{Addr: "0.0.0.0:" + strconv.Itoa(port), Handler: r}
+	stopped := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		stopped <- shutdown(srv)
+	}()
+
+	logger.Info("Server listening on port %d", port)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
 		logger.Error("Error starting server: %v", err)
 		return err
 	}
+	return <-stopped
+}
 
-	logger.Info("Server started successfully on port %s", port)
-	return nil
+// shutdown drains srv and then persists the path cache and the library index, so that
+// a restart or deploy does not begin with cold caches. Saving only starts once no
+// request can change them any more.
+func shutdown(srv *http.Server) error {
+	logger.Info("Shutting down, waiting for in-flight requests...")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Warn("Requests still running after %s: %v", shutdownTimeout, err)
+	}
+
+	logger.Info("Saving caches before exit...")
+	var errs []error
+	if err := stream.SaveCacheSnapshot(); err != nil {
+		logger.Error("Failed to write cache snapshot: %v", err)
+		errs = append(errs, err)
+	}
+	if err := library.Save(); err != nil {
+		logger.Error("Failed to write library index: %v", err)
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
 }
 
 // handleRequest processes the entire request handling flow.
@@ -99,12 +263,25 @@ func handleRequest(configFile string) error {
 	logger.Info("\n-----------------------------------------------\n")
 	logger.Info("Start request handle (Optimized).")
 
-	if err := initializeConfig(configFile); err != nil {
+	if err := initializeConfig(configFile, ""); err != nil {
 		return err
 	}
 
-	r := initializeGinEngine()
-	if err := startServer(r); err != nil {
+	// SIGINT and SIGTERM stop the background jobs and shut the server down gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Keep the library index in sync in the background
+	library.Start(ctx)
+	stream.StartCacheSnapshots(ctx)
+	stream.StartWarmer(ctx)
+
+	r, err := initializeGinEngine()
+	if err != nil {
+		logger.Error("Failed to initialize Gin engine: %v", err)
+		return err
+	}
+	if err := startServer(ctx, r); err != nil {
 		return err
 	}
 	return nil
@@ -116,6 +293,15 @@ func main() {
 		fmt.Println("Please provide the configuration file as an argument.")
 		return
 	}
+
+	// Subcommands
+	switch args[0] {
+	case "route":
+		os.Exit(runRouteCommand(args[1:]))
+	case "cache":
+		os.Exit(runCacheCommand(args[1:]))
+	}
+
 	configFile := args[0]
 
 	if err := handleRequest(configFile); err != nil {
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"Go_Frontend/config"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPlexTranscodeRoute(t *testing.T) {
+	var proxied []string
+	plex := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.Path)
+		io.WriteString(w, "transcoded")
+	}))
+	defer plex.Close()
+
+	savedServers := config.GetConfig().Servers
+	config.GetConfig().Servers = []config.ServerConfig{
+		{Name: "plex", Type: config.ServerTypePlex, Hosts: []string{"plex.example.com"}, URL: plex.URL},
+		{Name: "plex-direct", Type: config.ServerTypePlex, Hosts: []string{"plex-direct.example.com"}, URL: plex.URL,
+			PublicURL: "https://direct.example.com:32400/"},
+		{Name: "jellyfin", Type: config.ServerTypeJellyfin, URL: "http://127.0.0.1:1"},
+	}
+	t.Cleanup(func() { config.GetConfig().Servers = savedServers })
+
+	// Built like the real server, with the Jellyfin /videos/ routes next to /video/
+	r, err := initializeGinEngine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	frontend := httptest.NewServer(r)
+	defer frontend.Close()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	tests := []struct {
+		host   string
+		path   string
+		status int
+	}{
+		{"plex.example.com", "/video/:/transcode/universal/start?path=/library/metadata/1&directPlay=0", http.StatusOK},
+		{"plex.example.com", "/video/:/transcode/universal/start.m3u8?path=/library/metadata/1&directPlay=0", http.StatusOK},
+		{"plex.example.com", "/video/:/transcode/universal/session/1/base/index.m3u8", http.StatusNotFound},
+		{"plex.example.com", "/video/:/transcode/universal/start.m3u8/extra", http.StatusNotFound},
+		// With a public URL the request is redirected to Plex instead of proxied
+		{"plex-direct.example.com", "/video/:/transcode/universal/start.m3u8?path=/library/metadata/1&directPlay=0", http.StatusFound},
+	}
+	for _, test := range tests {
+		proxied = nil
+		req, err := http.NewRequest(http.MethodGet, frontend.URL+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = test.host
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != test.status {
+			t.Errorf("GET %s = %d, want %d", test.path, resp.StatusCode, test.status)
+		}
+		if test.status == http.StatusOK && (len(proxied) != 1 || string(body) != "transcoded") {
+			t.Errorf("GET %s was not proxied to Plex: %v %q", test.path, proxied, body)
+		}
+		if test.status == http.StatusFound {
+			if location := resp.Header.Get("Location"); location != "https://direct.example.com:32400"+test.path || len(proxied) != 0 {
+				t.Errorf("GET %s redirected to %q, proxied %v", test.path, location, proxied)
+			}
+		}
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	savedProxies := config.GetConfig().TrustedProxies
+	t.Cleanup(func() { config.GetConfig().TrustedProxies = savedProxies })
+
+	tests := []struct {
+		proxies []string
+		want    string
+	}{
+		{[]string{"127.0.0.1", "::1"}, "203.0.113.7"}, // nginx on the same host
+		{[]string{}, "127.0.0.1"},                     // forwarding headers are ignored
+		{[]string{"10.0.0.0/8"}, "127.0.0.1"},         // the peer is not one of the proxies
+	}
+	for _, test := range tests {
+		config.GetConfig().TrustedProxies = test.proxies
+		r, err := initializeGinEngine()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.GET("/client-ip", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+		frontend := httptest.NewServer(r)
+
+		req, _ := http.NewRequest(http.MethodGet, frontend.URL+"/client-ip", nil)
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		req.Header.Set("X-Real-IP", "203.0.113.7")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		frontend.Close()
+
+		if string(body) != test.want {
+			t.Errorf("trusted proxies %v: client IP = %q, want %s", test.proxies, body, test.want)
+		}
+	}
+
+	config.GetConfig().TrustedProxies = []string{"not-an-address"}
+	if _, err := initializeGinEngine(); err == nil {
+		t.Error("invalid trusted proxy was accepted")
+	}
+}
+
+func TestPlexServerSelection(t *testing.T) {
+	var plexRequests, embyRequests []string
+	plex := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		plexRequests = append(plexRequests, r.URL.Path)
+		io.WriteString(w, "plex")
+	}))
+	defer plex.Close()
+	emby := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		embyRequests = append(embyRequests, r.URL.Path)
+		io.WriteString(w, "emby")
+	}))
+	defer emby.Close()
+
+	savedServers, savedIndex := config.GetConfig().Servers, config.GetConfig().Index
+	t.Cleanup(func() { config.GetConfig().Servers, config.GetConfig().Index = savedServers, savedIndex })
+	config.GetConfig().Index.Enabled = false
+	// The Emby server is the default, since it is the first without hosts
+	config.GetConfig().Servers = []config.ServerConfig{
+		{Name: "emby", Type: config.ServerTypeEmby, URL: emby.URL},
+		{Name: "jellyfin", Type: config.ServerTypeJellyfin, Hosts: []string{"jellyfin.example.com"}, URL: emby.URL},
+		{Name: "plex", Type: config.ServerTypePlex, Hosts: []string{"plex.example.com"}, URL: plex.URL},
+	}
+
+	r, err := initializeGinEngine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	frontend := httptest.NewServer(r)
+	defer frontend.Close()
+
+	tests := []struct {
+		host   string
+		path   string
+		status int
+	}{
+		{"plex.example.com", "/library/parts/1/1700000000/file.mkv", http.StatusOK},
+		// An unknown host falls back to the Plex server rather than the default Emby server
+		{"unknown.example.com", "/library/parts/1/1700000000/file.mkv", http.StatusOK},
+		{"unknown.example.com", "/video/:/transcode/universal/start?path=/library/metadata/1&directPlay=0", http.StatusOK},
+		// A host that belongs to another server type is not served as Plex
+		{"jellyfin.example.com", "/library/parts/1/1700000000/file.mkv", http.StatusNotFound},
+		{"jellyfin.example.com", "/video/:/transcode/universal/start?path=/library/metadata/1&directPlay=0", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		plexRequests = nil
+		req, err := http.NewRequest(http.MethodGet, frontend.URL+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = test.host
+		req.Header.Set("X-Plex-Token", "secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != test.status {
+			t.Errorf("GET %s (host %s) = %d, want %d", test.path, test.host, resp.StatusCode, test.status)
+		}
+		if test.status == http.StatusOK && len(plexRequests) != 1 {
+			t.Errorf("GET %s (host %s) was not passed to Plex: %v", test.path, test.host, plexRequests)
+		}
+	}
+	if len(embyRequests) != 0 {
+		t.Errorf("Plex requests reached the Emby server: %v", embyRequests)
+	}
+}
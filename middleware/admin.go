@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"Go_Frontend/config"
+	"Go_Frontend/logger"
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// AdminAuthMiddleware rejects requests that do not carry the configured admin token,
+// either as "Authorization: Bearer <token>" or in the X-Admin-Token header.
+func AdminAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		expected := config.GetConfig().Admin.Token
+		token := c.GetHeader("X-Admin-Token")
+		if token == "" {
+			token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		}
+
+		if expected == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			logger.Warn("Rejected admin request from %s", c.ClientIP())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
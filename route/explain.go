@@ -0,0 +1,80 @@
+package route
+
+import (
+	"Go_Frontend/config"
+	"strings"
+)
+
+// Verdicts reported for each backend by Explain.
+const (
+	VerdictSelected         = "selected"
+	VerdictShadowed         = "shadowed"
+	VerdictDuplicate        = "duplicate"
+	VerdictBoundaryMismatch = "boundary-mismatch"
+	VerdictNoMatch          = "no-match"
+	VerdictDisabled         = "disabled"
+)
+
+// RuleResult is the outcome of matching one backend during a dry run.
+type RuleResult struct {
+	Backend string `json:"backend"`
+	Path    string `json:"path"`
+	Verdict string `json:"verdict"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// Explanation describes how a media path is routed against the current backend table.
+type Explanation struct {
+	NormalizedPath string               `json:"normalizedPath"`
+	Rules          []RuleResult         `json:"rules"`
+	Backend        config.BackendConfig `json:"backend"`
+	RelativePath   string               `json:"relativePath"`
+	Matched        bool                 `json:"matched"`
+}
+
+// Explain matches mediaPath exactly as Match does and reports a verdict for every
+// backend in the registry, including disabled ones. It is meant for troubleshooting,
+// not for the request path.
+func (r *Registry) Explain(mediaPath string) Explanation {
+	backend, relativePath, matched := r.Match(mediaPath)
+	e := Explanation{
+		NormalizedPath: normalizePath(mediaPath),
+		Backend:        backend,
+		RelativePath:   relativePath,
+		Matched:        matched,
+	}
+	selectedPath := normalizePath(backend.Path)
+
+	for _, candidate := range r.List() {
+		result := RuleResult{Backend: candidate.Name, Path: candidate.Path}
+		candidatePath := normalizePath(candidate.Path)
+		switch {
+		case candidate.Disabled:
+			result.Verdict = VerdictDisabled
+		case matched && candidate.Name == backend.Name:
+			result.Verdict = VerdictSelected
+		case !hasSegmentPrefix(e.NormalizedPath, candidatePath):
+			result.Verdict = VerdictNoMatch
+			if strings.HasPrefix(e.NormalizedPath, candidatePath) {
+				result.Verdict = VerdictBoundaryMismatch
+				result.Detail = "prefix ends inside a path segment"
+			}
+		case candidatePath == selectedPath:
+			result.Verdict = VerdictDuplicate
+			result.Detail = "same path as " + backend.Name
+		default:
+			result.Verdict = VerdictShadowed
+			result.Detail = "longer prefix " + backend.Path + " wins"
+		}
+		e.Rules = append(e.Rules, result)
+	}
+	return e
+}
+
+// hasSegmentPrefix reports whether the normalized path p starts with the normalized prefix on a segment boundary.
+func hasSegmentPrefix(p, prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
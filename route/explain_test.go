@@ -0,0 +1,53 @@
+package route
+
+import (
+	"Go_Frontend/config"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	r := &Registry{server: "explain", base: []config.BackendConfig{
+		{Name: "gd", URL: "https://gd.example.com", Path: "/mnt/gd"},
+		{Name: "anime", URL: "https://anime.example.com", Path: "/mnt/gd/anime"},
+		{Name: "anime-copy", URL: "https://copy.example.com", Path: "/mnt//gd/anime/"},
+		{Name: "ani", URL: "https://ani.example.com", Path: "/mnt/gd/ani"},
+		{Name: "other", URL: "https://other.example.com", Path: "/mnt/other"},
+		{Name: "archive", URL: "https://archive.example.com", Path: "/mnt/gd/anime/archive", Disabled: true},
+	}}
+	r.publish()
+
+	e := r.Explain("/mnt//gd/anime/archive/ep01.mkv")
+	if !e.Matched || e.Backend.Name != "anime" || e.RelativePath != "archive/ep01.mkv" {
+		t.Errorf("Explain selected %q with %q (matched %v), want anime with archive/ep01.mkv", e.Backend.Name, e.RelativePath, e.Matched)
+	}
+	if e.NormalizedPath != "/mnt/gd/anime/archive/ep01.mkv" {
+		t.Errorf("NormalizedPath = %q", e.NormalizedPath)
+	}
+	want := map[string]string{
+		"gd":         VerdictShadowed,
+		"anime":      VerdictSelected,
+		"anime-copy": VerdictDuplicate,
+		"ani":        VerdictBoundaryMismatch,
+		"other":      VerdictNoMatch,
+		"archive":    VerdictDisabled,
+	}
+	if len(e.Rules) != len(want) {
+		t.Fatalf("got %d rules, want %d", len(e.Rules), len(want))
+	}
+	for _, rule := range e.Rules {
+		if rule.Verdict != want[rule.Backend] {
+			t.Errorf("%s: verdict %s, want %s", rule.Backend, rule.Verdict, want[rule.Backend])
+		}
+	}
+
+	// Explain agrees with Match, also when nothing matches
+	e = r.Explain("/srv/media/movie.mkv")
+	if e.Matched {
+		t.Errorf("unmatched path selected %q", e.Backend.Name)
+	}
+	for _, rule := range e.Rules {
+		if rule.Verdict != VerdictNoMatch && rule.Verdict != VerdictDisabled {
+			t.Errorf("%s: verdict %s for an unmatched path", rule.Backend, rule.Verdict)
+		}
+	}
+}
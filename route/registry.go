@@ -0,0 +1,356 @@
+package route
+
+import (
+	"Go_Frontend/config"
+	"Go_Frontend/logger"
+	"Go_Frontend/util"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrNotFound is returned when no backend has the requested name.
+	ErrNotFound = errors.New("backend not found")
+	// ErrConflict is returned when a change would duplicate a backend name or path.
+	ErrConflict = errors.New("backend conflict")
+	// ErrInvalid is returned when a backend definition fails validation.
+	ErrInvalid = errors.New("invalid backend")
+)
+
+// Registry owns the runtime backend table of one media server: the YAML backends
+// overlaid with changes made through the admin API. Every change is persisted to the
+// state file and then published as a freshly compiled Matcher, so readers never
+// observe a partial table.
+type Registry struct {
+	server  string
+	base    []config.BackendConfig
+	overlay []stateEntry
+	// active is the routing table used by Match. It is only ever replaced as a whole,
+	// so concurrent lookups always see either the old or the new table.
+	active atomic.Pointer[Matcher]
+}
+
+// stateEntry is one runtime change, keyed by backend name.
+// A removed entry hides the YAML backend of the same name.
+type stateEntry struct {
+	config.BackendConfig
+	Removed bool `json:"removed,omitempty"`
+}
+
+// stateFileContent holds the overlays of every server. Backends is the format used
+// before multiple servers were supported and belongs to the default server.
+type stateFileContent struct {
+	Backends []stateEntry            `json:"backends,omitempty"`
+	Servers  map[string][]stateEntry `json:"servers,omitempty"`
+}
+
+var (
+	// mu serialises changes to every registry, since they share one state file.
+	mu         sync.Mutex
+	stateFile  string
+	registries atomic.Pointer[map[string]*Registry]
+)
+
+// GetRegistry returns the backend registry of the named server, or nil if there is none.
+func GetRegistry(server string) *Registry {
+	m := registries.Load()
+	if m == nil {
+		return nil
+	}
+	return (*m)[server]
+}
+
+// Load builds a registry for every server from its YAML backends, applies the overlay
+// from file (if any) and compiles the results into the active routing tables.
+func Load(servers []config.ServerConfig, file string) error {
+	content, err := readState(file)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	stateFile = file
+	defaultServer := config.DefaultServer()
+	loaded := make(map[string]*Registry, len(servers))
+	for _, server := range servers {
+		r := &Registry{server: server.Name, base: server.Backends, overlay: content.Servers[server.Name]}
+		if r.overlay == nil && defaultServer != nil && server.Name == defaultServer.Name {
+			r.overlay = content.Backends
+		}
+		r.publish()
+		loaded[server.Name] = r
+	}
+	registries.Store(&loaded)
+	return nil
+}
+
+// Match resolves mediaPath against the active routing table.
+func (r *Registry) Match(mediaPath string) (config.BackendConfig, string, bool) {
+	return r.active.Load().Match(mediaPath)
+}
+
+// List returns every backend, including disabled ones, in routing-table order.
+func (r *Registry) List() []config.BackendConfig {
+	mu.Lock()
+	defer mu.Unlock()
+	return r.effective()
+}
+
+// Get returns the backend with the given name.
+func (r *Registry) Get(name string) (config.BackendConfig, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, backend := range r.effective() {
+		if backend.Name == name {
+			return backend, nil
+		}
+	}
+	return config.BackendConfig{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// Add registers a new backend.
+func (r *Registry) Add(backend config.BackendConfig) error {
+	return r.apply(backend.Name, func(current []config.BackendConfig) (stateEntry, error) {
+		if indexOf(current, backend.Name) >= 0 {
+			return stateEntry{}, fmt.Errorf("%w: name %s already exists", ErrConflict, backend.Name)
+		}
+		return stateEntry{BackendConfig: backend}, nil
+	})
+}
+
+// Update replaces the backend called name. Renaming is not supported.
+func (r *Registry) Update(name string, backend config.BackendConfig) error {
+	if backend.Name == "" {
+		backend.Name = name
+	}
+	if backend.Name != name {
+		return fmt.Errorf("%w: backend name cannot be changed", ErrInvalid)
+	}
+	return r.apply(name, func(current []config.BackendConfig) (stateEntry, error) {
+		if indexOf(current, name) < 0 {
+			return stateEntry{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		return stateEntry{BackendConfig: backend}, nil
+	})
+}
+
+// SetDisabled enables or disables the backend called name without removing it.
+func (r *Registry) SetDisabled(name string, disabled bool) error {
+	return r.apply(name, func(current []config.BackendConfig) (stateEntry, error) {
+		i := indexOf(current, name)
+		if i < 0 {
+			return stateEntry{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		backend := current[i]
+		backend.Disabled = disabled
+		return stateEntry{BackendConfig: backend}, nil
+	})
+}
+
+// Remove deletes the backend called name.
+func (r *Registry) Remove(name string) error {
+	return r.apply(name, func(current []config.BackendConfig) (stateEntry, error) {
+		if indexOf(current, name) < 0 {
+			return stateEntry{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		return stateEntry{BackendConfig: config.BackendConfig{Name: name}, Removed: true}, nil
+	})
+}
+
+// apply computes the overlay entry for name, validates the resulting table,
+// persists it and only then publishes it.
+func (r *Registry) apply(name string, change func(current []config.BackendConfig) (stateEntry, error)) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	entry, err := change(r.effective())
+	if err != nil {
+		return err
+	}
+
+	overlay := make([]stateEntry, 0, len(r.overlay)+1)
+	for _, existing := range r.overlay {
+		if existing.Name != name {
+			overlay = append(overlay, existing)
+		}
+	}
+	// A tombstone is only needed when there is a YAML backend to hide.
+	if !entry.Removed || indexOf(r.base, name) >= 0 {
+		overlay = append(overlay, entry)
+	}
+
+	if err := validateChange(entry, merge(r.base, overlay)); err != nil {
+		return err
+	}
+	if err := writeState(r.server, overlay); err != nil {
+		return err
+	}
+
+	r.overlay = overlay
+	r.publish()
+	logger.Info("Backend %s of server %s updated at runtime", name, r.server)
+	return nil
+}
+
+func (r *Registry) effective() []config.BackendConfig {
+	return merge(r.base, r.overlay)
+}
+
+// publish compiles the enabled backends and atomically swaps them in.
+func (r *Registry) publish() {
+	var enabled []config.BackendConfig
+	for _, backend := range r.effective() {
+		if !backend.Disabled {
+			enabled = append(enabled, backend)
+		}
+	}
+	m := Compile(enabled)
+	r.active.Store(m)
+	logger.Info("Route table of server %s compiled with %d backends", r.server, m.Len())
+}
+
+// merge overlays runtime entries onto the YAML backends. Overlaid YAML backends keep
+// their position; backends added at runtime follow in the order they were added.
+func merge(base []config.BackendConfig, overlay []stateEntry) []config.BackendConfig {
+	byName := make(map[string]stateEntry, len(overlay))
+	for _, entry := range overlay {
+		byName[entry.Name] = entry
+	}
+
+	merged := make([]config.BackendConfig, 0, len(base)+len(overlay))
+	seen := make(map[string]bool, len(base))
+	for _, backend := range base {
+		seen[backend.Name] = true
+		if entry, ok := byName[backend.Name]; ok {
+			if !entry.Removed {
+				merged = append(merged, entry.BackendConfig)
+			}
+			continue
+		}
+		merged = append(merged, backend)
+	}
+	for _, entry := range overlay {
+		if !seen[entry.Name] && !entry.Removed {
+			merged = append(merged, entry.BackendConfig)
+		}
+	}
+	return merged
+}
+
+// validateBackend checks a single backend definition.
+func validateBackend(backend config.BackendConfig) error {
+	if strings.TrimSpace(backend.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	u, err := url.Parse(backend.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: %s: url must be an absolute http(s) URL", ErrInvalid, backend.Name)
+	}
+	if normalizePath(backend.Path) == "" {
+		return fmt.Errorf("%w: %s: path is required", ErrInvalid, backend.Name)
+	}
+	for _, mirror := range backend.Mirrors {
+		u, err := url.Parse(mirror.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: %s: mirror url must be an absolute http(s) URL", ErrInvalid, backend.Name)
+		}
+		if len(mirror.Countries) == 0 && len(mirror.ASNs) == 0 {
+			return fmt.Errorf("%w: %s: mirror %s needs countries or asns", ErrInvalid, backend.Name, mirror.URL)
+		}
+	}
+	return nil
+}
+
+// validateChange checks a changed backend and rejects it if it would share an
+// enabled path with another backend. Pre-existing YAML entries are not re-validated.
+func validateChange(entry stateEntry, backends []config.BackendConfig) error {
+	if entry.Removed {
+		return nil
+	}
+	if err := validateBackend(entry.BackendConfig); err != nil {
+		return err
+	}
+	if entry.Disabled {
+		return nil
+	}
+	p := normalizePath(entry.Path)
+	for _, other := range backends {
+		if other.Name != entry.Name && !other.Disabled && normalizePath(other.Path) == p {
+			return fmt.Errorf("%w: path %s is already used by %s", ErrConflict, entry.Path, other.Name)
+		}
+	}
+	return nil
+}
+
+// normalizePath reduces a backend path to its segments so "/mnt/gd" and "/mnt//gd/" compare equal.
+func normalizePath(p string) string {
+	var b strings.Builder
+	forEachSegment(p, func(segment string, _ int) bool {
+		b.WriteByte('/')
+		b.WriteString(segment)
+		return true
+	})
+	return b.String()
+}
+
+func indexOf(backends []config.BackendConfig, name string) int {
+	for i, backend := range backends {
+		if backend.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func readState(file string) (stateFileContent, error) {
+	var content stateFileContent
+	if file == "" {
+		return content, nil
+	}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return content, nil
+	}
+	if err != nil {
+		return content, fmt.Errorf("read backend state file: %w", err)
+	}
+	if err := json.Unmarshal(data, &content); err != nil {
+		return content, fmt.Errorf("parse backend state file: %w", err)
+	}
+	logger.Info("Loaded runtime backend changes from %s", file)
+	return content, nil
+}
+
+// writeState persists the overlays of all servers, with server's replaced by overlay.
+// Callers hold mu.
+func writeState(server string, overlay []stateEntry) error {
+	if stateFile == "" {
+		logger.Warn("Admin.stateFile is not set, runtime backend changes of server %s will be lost on restart", server)
+		return nil
+	}
+	content := stateFileContent{Servers: make(map[string][]stateEntry)}
+	for name, r := range *registries.Load() {
+		if name != server && len(r.overlay) > 0 {
+			content.Servers[name] = r.overlay
+		}
+	}
+	if len(overlay) > 0 {
+		content.Servers[server] = overlay
+	}
+
+	data, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := util.WriteFileAtomic(stateFile, data); err != nil {
+		return fmt.Errorf("write backend state file: %w", err)
+	}
+	return nil
+}
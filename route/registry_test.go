@@ -0,0 +1,183 @@
+package route
+
+import (
+	"Go_Frontend/config"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func backendNames(backends []config.BackendConfig) []string {
+	names := make([]string, len(backends))
+	for i, backend := range backends {
+		names[i] = backend.Name
+		if backend.Disabled {
+			names[i] += " (disabled)"
+		}
+	}
+	return names
+}
+
+// loadTestRegistries loads two servers with YAML backends and restores the package state afterwards.
+func loadTestRegistries(t *testing.T, file string) (*Registry, *Registry) {
+	t.Helper()
+	savedServers := config.GetConfig().Servers
+	t.Cleanup(func() {
+		config.GetConfig().Servers = savedServers
+		Load(savedServers, "")
+	})
+	config.GetConfig().Servers = []config.ServerConfig{
+		{Name: "family", Backends: []config.BackendConfig{
+			{Name: "gd", URL: "https://gd.example.com/stream", Path: "/mnt/gd"},
+			{Name: "od", URL: "https://od.example.com/stream", Path: "/mnt/od"},
+		}},
+		{Name: "friends", Hosts: []string{"friends.example.com"}, Backends: []config.BackendConfig{
+			{Name: "gd", URL: "https://friends.example.com/stream", Path: "/mnt/gd"},
+		}},
+	}
+	if err := Load(config.GetConfig().Servers, file); err != nil {
+		t.Fatal(err)
+	}
+	return GetRegistry("family"), GetRegistry("friends")
+}
+
+func TestRegistryChanges(t *testing.T) {
+	family, friends := loadTestRegistries(t, filepath.Join(t.TempDir(), "state.json"))
+
+	steps := []struct {
+		name   string
+		change func() error
+		err    error
+		want   []string
+	}{
+		{"add", func() error {
+			return family.Add(config.BackendConfig{Name: "anime", URL: "https://anime.example.com/stream", Path: "/mnt/gd/anime"})
+		}, nil, []string{"gd", "od", "anime"}},
+		{"add an existing name", func() error {
+			return family.Add(config.BackendConfig{Name: "od", URL: "https://od2.example.com/stream", Path: "/mnt/od2"})
+		}, ErrConflict, []string{"gd", "od", "anime"}},
+		{"add a path in use", func() error {
+			return family.Add(config.BackendConfig{Name: "gd2", URL: "https://gd2.example.com/stream", Path: "/mnt//gd/"})
+		}, ErrConflict, []string{"gd", "od", "anime"}},
+		{"add without url", func() error {
+			return family.Add(config.BackendConfig{Name: "bad", Path: "/mnt/bad"})
+		}, ErrInvalid, []string{"gd", "od", "anime"}},
+		{"update keeps the position", func() error {
+			return family.Update("od", config.BackendConfig{URL: "https://od.example.net/stream", Path: "/mnt/onedrive"})
+		}, nil, []string{"gd", "od", "anime"}},
+		{"update a missing backend", func() error {
+			return family.Update("nope", config.BackendConfig{URL: "https://x.example.com", Path: "/mnt/x"})
+		}, ErrNotFound, []string{"gd", "od", "anime"}},
+		{"rename", func() error {
+			return family.Update("od", config.BackendConfig{Name: "onedrive", URL: "https://od.example.net/stream", Path: "/mnt/od"})
+		}, ErrInvalid, []string{"gd", "od", "anime"}},
+		{"disable", func() error { return family.SetDisabled("gd", true) }, nil, []string{"gd (disabled)", "od", "anime"}},
+		// A disabled backend does not hold on to its path
+		{"add over a disabled path", func() error {
+			return family.Add(config.BackendConfig{Name: "gd-new", URL: "https://gd-new.example.com/stream", Path: "/mnt/gd"})
+		}, nil, []string{"gd (disabled)", "od", "anime", "gd-new"}},
+		{"enable with a conflicting path", func() error { return family.SetDisabled("gd", false) }, ErrConflict,
+			[]string{"gd (disabled)", "od", "anime", "gd-new"}},
+		{"remove a YAML backend", func() error { return family.Remove("gd") }, nil, []string{"od", "anime", "gd-new"}},
+		{"remove a runtime backend", func() error { return family.Remove("anime") }, nil, []string{"od", "gd-new"}},
+		{"remove again", func() error { return family.Remove("anime") }, ErrNotFound, []string{"od", "gd-new"}},
+	}
+	for _, step := range steps {
+		if err := step.change(); !errors.Is(err, step.err) {
+			t.Fatalf("%s: error %v, want %v", step.name, err, step.err)
+		}
+		if got := backendNames(family.List()); !reflect.DeepEqual(got, step.want) {
+			t.Fatalf("%s: backends %v, want %v", step.name, got, step.want)
+		}
+	}
+
+	// Changes are published to Match at once
+	if backend, rest, ok := family.Match("/mnt/gd/anime/ep01.mkv"); !ok || backend.Name != "gd-new" || rest != "anime/ep01.mkv" {
+		t.Errorf("Match = %s %q %v, want gd-new", backend.Name, rest, ok)
+	}
+	if backend, _, _ := family.Match("/mnt/onedrive/a.mkv"); backend.Name != "od" {
+		t.Errorf("updated path was not published, matched %q", backend.Name)
+	}
+	if _, _, ok := family.Match("/mnt/od/a.mkv"); ok {
+		t.Error("old path of an updated backend still matches")
+	}
+	if backend, _ := family.Get("od"); backend.URL != "https://od.example.net/stream" {
+		t.Errorf("Get(od) = %+v", backend)
+	}
+
+	// Each server has its own table
+	if got := backendNames(friends.List()); !reflect.DeepEqual(got, []string{"gd"}) {
+		t.Errorf("friends backends = %v", got)
+	}
+}
+
+func TestRegistryStateFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "state.json")
+	family, friends := loadTestRegistries(t, file)
+	if err := family.Add(config.BackendConfig{Name: "anime", URL: "https://anime.example.com/stream", Path: "/mnt/anime"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := family.Remove("od"); err != nil {
+		t.Fatal(err)
+	}
+	if err := friends.SetDisabled("gd", true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reloading from the state file restores the overlays of both servers on top of the YAML backends
+	family, friends = loadTestRegistries(t, file)
+	if got, want := backendNames(family.List()), []string{"gd", "anime"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("family after reload = %v, want %v", got, want)
+	}
+	if got, want := backendNames(friends.List()), []string{"gd (disabled)"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("friends after reload = %v, want %v", got, want)
+	}
+	if _, _, ok := friends.Match("/mnt/gd/a.mkv"); ok {
+		t.Error("disabled backend matched after reload")
+	}
+
+	// Removing a runtime backend leaves no tombstone behind
+	if err := family.Remove("anime"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "anime") {
+		t.Errorf("state file still mentions the removed runtime backend:\n%s", data)
+	}
+
+	// The single-server format belongs to the default server
+	legacy := `{"backends": [{"Name": "od", "URL": "https://od.example.org/stream", "Path": "/mnt/od", "Disabled": true}]}`
+	if err := os.WriteFile(file, []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	family, friends = loadTestRegistries(t, file)
+	if got, want := backendNames(family.List()), []string{"gd", "od (disabled)"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("family with a legacy state file = %v, want %v", got, want)
+	}
+	if got := backendNames(friends.List()); !reflect.DeepEqual(got, []string{"gd"}) {
+		t.Errorf("friends with a legacy state file = %v", got)
+	}
+
+	if err := os.WriteFile(file, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(config.GetConfig().Servers, file); err == nil {
+		t.Error("unreadable state file was accepted")
+	}
+}
+
+func TestRegistryWithoutStateFile(t *testing.T) {
+	family, _ := loadTestRegistries(t, "")
+	if err := family.SetDisabled("gd", true); err != nil {
+		t.Fatal(err)
+	}
+	if backend, _ := family.Get("gd"); !backend.Disabled {
+		t.Error("change was not applied in memory")
+	}
+}
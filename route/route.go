@@ -0,0 +1,112 @@
+// Package route maps Emby media paths onto the configured streaming backends.
+package route
+
+import (
+	"Go_Frontend/config"
+	"Go_Frontend/logger"
+)
+
+// Matcher is a path-segment trie compiled from the backend table.
+// Lookups cost O(depth of the media path), independent of how many backends are configured,
+// and a backend only matches on whole segments: "/mnt/gd" matches "/mnt/gd/a.mkv" but not "/mnt/gd2/a.mkv".
+type Matcher struct {
+	root *node
+	size int
+}
+
+type node struct {
+	children map[string]*node
+	backend  *config.BackendConfig
+}
+
+// Compile builds a Matcher from the given backends.
+// If two backends share the same path, the first one wins.
+func Compile(backends []config.BackendConfig) *Matcher {
+	m := &Matcher{root: &node{}}
+	for i := range backends {
+		backend := backends[i]
+		n := m.root
+		forEachSegment(backend.Path, func(segment string, _ int) bool {
+			child, ok := n.children[segment]
+			if !ok {
+				if n.children == nil {
+					n.children = make(map[string]*node)
+				}
+				child = &node{}
+				n.children[segment] = child
+			}
+			n = child
+			return true
+		})
+		if n.backend != nil {
+			logger.Warn("Backend %s ignored: path %s is already used by %s", backend.Name, backend.Path, n.backend.Name)
+			continue
+		}
+		n.backend = &backend
+		m.size++
+	}
+	return m
+}
+
+// Len returns the number of backends in the matcher.
+func (m *Matcher) Len() int {
+	return m.size
+}
+
+// Match returns the backend with the longest path prefix of mediaPath, together with
+// the remainder of mediaPath relative to that backend (without a leading separator).
+func (m *Matcher) Match(mediaPath string) (config.BackendConfig, string, bool) {
+	best := m.root.backend
+	bestEnd := 0
+
+	n := m.root
+	forEachSegment(mediaPath, func(segment string, end int) bool {
+		n = n.children[segment]
+		if n == nil {
+			return false
+		}
+		if n.backend != nil {
+			best = n.backend
+			bestEnd = end
+		}
+		return true
+	})
+
+	if best == nil {
+		return config.BackendConfig{}, "", false
+	}
+	return *best, trimSeparators(mediaPath[bestEnd:]), true
+}
+
+// forEachSegment calls fn for every non-empty segment of p along with the offset just past it.
+// Both '/' and '\' are separators so Windows-hosted Emby paths are matched as well.
+// Iteration stops as soon as fn returns false.
+func forEachSegment(p string, fn func(segment string, end int) bool) {
+	i := 0
+	for i < len(p) {
+		for i < len(p) && isSeparator(p[i]) {
+			i++
+		}
+		start := i
+		for i < len(p) && !isSeparator(p[i]) {
+			i++
+		}
+		if start == i {
+			return
+		}
+		if !fn(p[start:i], i) {
+			return
+		}
+	}
+}
+
+func trimSeparators(p string) string {
+	for len(p) > 0 && isSeparator(p[0]) {
+		p = p[1:]
+	}
+	return p
+}
+
+func isSeparator(c byte) bool {
+	return c == '/' || c == '\\'
+}
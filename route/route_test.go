@@ -0,0 +1,104 @@
+package route
+
+import (
+	"Go_Frontend/config"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMatchSegmentBoundary(t *testing.T) {
+	m := Compile([]config.BackendConfig{
+		{Name: "gd", URL: "https://gd.example.com/stream", Path: "/mnt/gd"},
+		{Name: "gd2", URL: "https://gd2.example.com/stream", Path: "/mnt/gd2/"},
+		{Name: "anime", URL: "https://anime.example.com/stream", Path: "/mnt/gd/anime"},
+		{Name: "win", URL: "https://win.example.com/stream", Path: `D:\Media`},
+	})
+
+	cases := []struct {
+		path    string
+		backend string
+		rest    string
+		ok      bool
+	}{
+		{"/mnt/gd/movie.mkv", "gd", "movie.mkv", true},
+		{"/mnt/gd2/movie.mkv", "gd2", "movie.mkv", true},
+		{"/mnt/gd/anime/ep01.mkv", "anime", "ep01.mkv", true},
+		{"/mnt/gd/animes/ep01.mkv", "gd", "animes/ep01.mkv", true},
+		{"/mnt//gd/movie.mkv", "gd", "movie.mkv", true},
+		{`D:\Media\Movies\a.mkv`, "win", `Movies\a.mkv`, true},
+		{"/mnt/gd3/movie.mkv", "", "", false},
+		{"/mnt", "", "", false},
+	}
+
+	for _, tc := range cases {
+		backend, rest, ok := m.Match(tc.path)
+		if ok != tc.ok || backend.Name != tc.backend || rest != tc.rest {
+			t.Errorf("Match(%q) = (%q, %q, %v), want (%q, %q, %v)",
+				tc.path, backend.Name, rest, ok, tc.backend, tc.rest, tc.ok)
+		}
+	}
+}
+
+func TestCompileKeepsFirstDuplicate(t *testing.T) {
+	m := Compile([]config.BackendConfig{
+		{Name: "first", Path: "/mnt/gd"},
+		{Name: "second", Path: "/mnt/gd/"},
+	})
+	if m.Len() != 1 {
+		t.Fatalf("Len() = %d, want 1", m.Len())
+	}
+	if backend, _, _ := m.Match("/mnt/gd/a.mkv"); backend.Name != "first" {
+		t.Fatalf("Match picked %q, want first", backend.Name)
+	}
+}
+
+func benchmarkBackends(n int) []config.BackendConfig {
+	backends := make([]config.BackendConfig, n)
+	for i := range backends {
+		backends[i] = config.BackendConfig{
+			Name: fmt.Sprintf("drive-%d", i),
+			URL:  fmt.Sprintf("https://stream-%d.example.com/stream", i),
+			Path: fmt.Sprintf("/mnt/drive-%d", i),
+		}
+	}
+	return backends
+}
+
+func BenchmarkMatch(b *testing.B) {
+	for _, n := range []int{10, 100, 1000, 10000} {
+		m := Compile(benchmarkBackends(n))
+		mediaPath := fmt.Sprintf("/mnt/drive-%d/TV/Show/Season 01/S01E01.mkv", n-1)
+		b.Run(fmt.Sprintf("backends=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, _, ok := m.Match(mediaPath); !ok {
+					b.Fatal("no match")
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkLinearScan measures the prefix scan the trie replaced, for comparison.
+func BenchmarkLinearScan(b *testing.B) {
+	for _, n := range []int{10, 100, 1000, 10000} {
+		backends := benchmarkBackends(n)
+		mediaPath := fmt.Sprintf("/mnt/drive-%d/TV/Show/Season 01/S01E01.mkv", n-1)
+		b.Run(fmt.Sprintf("backends=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				matched := false
+				for _, backend := range backends {
+					if strings.HasPrefix(mediaPath, backend.Path+"/") {
+						matched = true
+						break
+					}
+				}
+				if !matched {
+					b.Fatal("no match")
+				}
+			}
+		})
+	}
+}
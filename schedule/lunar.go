@@ -0,0 +1,199 @@
+package schedule
+
+import (
+	"fmt"
+	"github.com/6tail/lunar-go/calendar"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Leap month handling of lunar rules.
+const (
+	LeapExclude = "exclude" // default: only the regular month, as festivals are observed
+	LeapInclude = "include" // a leap month counts as the month it repeats
+	LeapOnly    = "only"    // only the leap month
+)
+
+// lastDay stands for the last day of a lunar month, which has 29 or 30 days.
+const lastDay = 30
+
+// solarTerms maps the pinyin names of the 24 solar terms to the Chinese names used by lunar-go.
+var solarTerms = map[string]string{
+	"lichun": "立春", "yushui": "雨水", "jingzhe": "惊蛰", "chunfen": "春分", "qingming": "清明", "guyu": "谷雨",
+	"lixia": "立夏", "xiaoman": "小满", "mangzhong": "芒种", "xiazhi": "夏至", "xiaoshu": "小暑", "dashu": "大暑",
+	"liqiu": "立秋", "chushu": "处暑", "bailu": "白露", "qiufen": "秋分", "hanlu": "寒露", "shuangjiang": "霜降",
+	"lidong": "立冬", "xiaoxue": "小雪", "daxue": "大雪", "dongzhi": "冬至", "xiaohan": "小寒", "dahan": "大寒",
+}
+
+// festival is a named day given either as a lunar date or as a solar term.
+type festival struct {
+	lunar     string
+	solarTerm string
+}
+
+var festivals = map[string]festival{
+	"springfestival":  {lunar: "01-01"},
+	"lanternfestival": {lunar: "01-15"},
+	"dragonboat":      {lunar: "05-05"},
+	"qixi":            {lunar: "07-07"},
+	"ghostfestival":   {lunar: "07-15"},
+	"midautumn":       {lunar: "08-15"},
+	"doubleninth":     {lunar: "09-09"},
+	"laba":            {lunar: "12-08"},
+	"newyeareve":      {lunar: "12-last"},
+	"qingming":        {solarTerm: "清明"},
+	"wintersolstice":  {solarTerm: "冬至"},
+}
+
+var festivalAliases = map[string]string{
+	"春节": "springfestival", "元宵": "lanternfestival", "端午": "dragonboat", "七夕": "qixi", "中元": "ghostfestival",
+	"中秋": "midautumn", "重阳": "doubleninth", "腊八": "laba", "除夕": "newyeareve", "清明": "qingming", "冬至": "wintersolstice",
+}
+
+// lunarDate is a day of the lunar calendar.
+type lunarDate struct {
+	month     int
+	day       int
+	leap      bool
+	last      bool   // last day of the month
+	solarTerm string // solar term starting on this day, if any
+}
+
+// lunarCache holds the lunar date of the most recently converted day. Converting computes the
+// solar terms of the whole year, and requests on the same day ask for the same date.
+var lunarCache atomic.Pointer[struct {
+	day  int
+	date lunarDate
+}]
+
+func lunarDateOf(t time.Time) lunarDate {
+	day := dayNumber(t)
+	if cached := lunarCache.Load(); cached != nil && cached.day == day {
+		return cached.date
+	}
+	lunar := calendar.NewSolarFromYmd(t.Year(), int(t.Month()), t.Day()).GetLunar()
+	month := lunar.GetMonth()
+	date := lunarDate{
+		month:     month,
+		day:       lunar.GetDay(),
+		last:      lunar.Next(1).GetDay() == 1,
+		solarTerm: lunar.GetJieQi(),
+	}
+	// lunar-go numbers leap months negatively
+	if month < 0 {
+		date.month, date.leap = -month, true
+	}
+	lunarCache.Store(&struct {
+		day  int
+		date lunarDate
+	}{day, date})
+	return date
+}
+
+// lunarRange is an inclusive range of lunar days, stored as month*100+day. A range whose end
+// comes before its start runs over the lunar new year.
+type lunarRange struct {
+	from, to int
+	// lastOnly is set for a single "MM-last" day, which is the 29th in short months
+	lastOnly bool
+	leap     string
+}
+
+// parseLunarRange parses "08-15", "12-last" or "12-23..01-15".
+func parseLunarRange(s, leap string) (*lunarRange, error) {
+	switch leap {
+	case "":
+		leap = LeapExclude
+	case LeapExclude, LeapInclude, LeapOnly:
+	default:
+		return nil, fmt.Errorf("leap %q: want %s, %s or %s", leap, LeapExclude, LeapInclude, LeapOnly)
+	}
+	fromText, toText, isRange := strings.Cut(s, "..")
+	fromText, toText = strings.TrimSpace(fromText), strings.TrimSpace(toText)
+	from, err := parseLunarDay(fromText)
+	if err != nil {
+		return nil, fmt.Errorf("lunar %q: %w", s, err)
+	}
+	r := &lunarRange{from: from, to: from, leap: leap}
+	isLast := strings.HasSuffix(fromText, "-last")
+	if !isRange {
+		r.lastOnly = isLast
+		return r, nil
+	}
+	if isLast {
+		return nil, fmt.Errorf("lunar %q: a range cannot start on the last day of a month", s)
+	}
+	if r.to, err = parseLunarDay(toText); err != nil {
+		return nil, fmt.Errorf("lunar %q: %w", s, err)
+	}
+	return r, nil
+}
+
+func parseLunarDay(s string) (int, error) {
+	monthText, dayText, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, fmt.Errorf("want MM-DD or MM-last, got %q", s)
+	}
+	month, err := strconv.Atoi(monthText)
+	if err != nil || month < 1 || month > 12 {
+		return 0, fmt.Errorf("invalid lunar month %q", monthText)
+	}
+	day := lastDay
+	if dayText != "last" {
+		if day, err = strconv.Atoi(dayText); err != nil || day < 1 || day > lastDay {
+			return 0, fmt.Errorf("invalid lunar day %q", dayText)
+		}
+	}
+	return month*100 + day, nil
+}
+
+func (r *lunarRange) contains(t time.Time) bool {
+	date := lunarDateOf(t)
+	switch {
+	case r.leap == LeapExclude && date.leap, r.leap == LeapOnly && !date.leap:
+		return false
+	case r.lastOnly:
+		return date.month == r.from/100 && date.last
+	}
+	day := date.month*100 + date.day
+	if r.from <= r.to {
+		return day >= r.from && day <= r.to
+	}
+	return day >= r.from || day <= r.to
+}
+
+// parseSolarTerm accepts the Chinese or pinyin name of a solar term, such as "清明" or "qingming".
+func parseSolarTerm(name string) (string, error) {
+	if term, ok := solarTerms[strings.ToLower(name)]; ok {
+		return term, nil
+	}
+	for _, term := range solarTerms {
+		if term == name {
+			return term, nil
+		}
+	}
+	return "", fmt.Errorf("unknown solar term %q", name)
+}
+
+// parseFestival resolves a festival name to a lunar date or solar term condition.
+func parseFestival(name string) (*lunarRange, string, error) {
+	key := strings.ToLower(name)
+	if alias, ok := festivalAliases[name]; ok {
+		key = alias
+	}
+	f, ok := festivals[key]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown festival %q", name)
+	}
+	if f.solarTerm != "" {
+		return nil, f.solarTerm, nil
+	}
+	r, err := parseLunarRange(f.lunar, LeapExclude)
+	return r, "", err
+}
+
+func solarTermOn(t time.Time, term string) bool {
+	return lunarDateOf(t).solarTerm == term
+}
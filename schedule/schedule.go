@@ -0,0 +1,308 @@
+// Package schedule decides when special media replaces the requested media. A Schedule is a list
+// of rules and matches when any of them does; a rule matches when all of its conditions do.
+package schedule
+
+import (
+	"Go_Frontend/config"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCronDuration bounds how far back a cron rule looks for its last firing.
+const maxCronDuration = 24 * time.Hour
+
+// Matcher reports whether a point in time falls inside a schedule.
+type Matcher interface {
+	Match(t time.Time) bool
+}
+
+// Schedule matches when any of its rules matches.
+type Schedule []Matcher
+
+func (s Schedule) Match(t time.Time) bool {
+	for _, m := range s {
+		if m.Match(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compile validates and compiles rule configurations.
+func Compile(rules []config.ScheduleRuleConfig) (Schedule, error) {
+	schedule := make(Schedule, 0, len(rules))
+	for i, cfg := range rules {
+		r, err := compileRule(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		schedule = append(schedule, r)
+	}
+	return schedule, nil
+}
+
+// rule is the conjunction of the conditions set in one ScheduleRuleConfig.
+type rule struct {
+	cron      *cronExpr
+	duration  time.Duration
+	dates     *dateRange
+	yearly    *yearlyRange
+	weekdays  uint8 // bit per time.Weekday, 0 means any day
+	hours     *hourWindow
+	lunar     *lunarRange
+	solarTerm string
+}
+
+func compileRule(cfg config.ScheduleRuleConfig) (*rule, error) {
+	r := &rule{duration: cfg.Duration}
+	var err error
+	if cfg.Cron != "" {
+		if r.cron, err = parseCron(cfg.Cron); err != nil {
+			return nil, err
+		}
+		if r.duration <= 0 {
+			r.duration = time.Minute
+		}
+		if r.duration > maxCronDuration {
+			return nil, fmt.Errorf("duration %s is longer than %s", r.duration, maxCronDuration)
+		}
+	} else if cfg.Duration != 0 {
+		return nil, errors.New("duration is only used with cron")
+	}
+	if cfg.Dates != "" {
+		if r.dates, err = parseDateRange(cfg.Dates); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Yearly != "" {
+		if r.yearly, err = parseYearlyRange(cfg.Yearly); err != nil {
+			return nil, err
+		}
+	}
+	if len(cfg.Weekdays) > 0 {
+		if r.weekdays, err = parseWeekdays(cfg.Weekdays); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Hours != "" {
+		if r.hours, err = parseHourWindow(cfg.Hours); err != nil {
+			return nil, err
+		}
+	}
+	if err := compileLunar(r, cfg); err != nil {
+		return nil, err
+	}
+	if r.cron == nil && r.dates == nil && r.yearly == nil && r.weekdays == 0 && r.hours == nil && r.lunar == nil && r.solarTerm == "" {
+		return nil, errors.New("rule has no conditions")
+	}
+	return r, nil
+}
+
+func (r *rule) Match(t time.Time) bool {
+	// A window that runs past midnight belongs to the day it started on, so the day conditions are
+	// checked against that day
+	day := t
+	if r.hours != nil {
+		var ok bool
+		if day, ok = r.hours.contains(t); !ok {
+			return false
+		}
+	}
+	if r.dates != nil && !r.dates.contains(day) {
+		return false
+	}
+	if r.yearly != nil && !r.yearly.contains(day) {
+		return false
+	}
+	if r.weekdays != 0 && r.weekdays&(1<<day.Weekday()) == 0 {
+		return false
+	}
+	if r.lunar != nil && !r.lunar.contains(day) {
+		return false
+	}
+	if r.solarTerm != "" && !solarTermOn(day, r.solarTerm) {
+		return false
+	}
+	if r.cron != nil && !r.cron.firedWithin(t, r.duration) {
+		return false
+	}
+	return true
+}
+
+// compileLunar sets the lunar condition of a rule. Lunar dates, festivals and solar terms each
+// pick a day of the year, so a rule may use only one of them.
+func compileLunar(r *rule, cfg config.ScheduleRuleConfig) error {
+	set := 0
+	for _, value := range []string{cfg.Lunar, cfg.Festival, cfg.SolarTerm} {
+		if value != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return errors.New("lunar, festival and solarTerm cannot be combined in one rule")
+	}
+	if cfg.Leap != "" && cfg.Lunar == "" {
+		return errors.New("leap is only used with lunar")
+	}
+	var err error
+	switch {
+	case cfg.Lunar != "":
+		r.lunar, err = parseLunarRange(cfg.Lunar, cfg.Leap)
+	case cfg.Festival != "":
+		r.lunar, r.solarTerm, err = parseFestival(cfg.Festival)
+	case cfg.SolarTerm != "":
+		r.solarTerm, err = parseSolarTerm(cfg.SolarTerm)
+	}
+	return err
+}
+
+// dateRange is an inclusive range of calendar days, stored as yyyymmdd.
+type dateRange struct{ from, to int }
+
+// parseDateRange parses "2006-01-02" or "2006-01-02..2006-01-31".
+func parseDateRange(s string) (*dateRange, error) {
+	fromText, toText, isRange := strings.Cut(s, "..")
+	if !isRange {
+		toText = fromText
+	}
+	from, err := time.Parse(time.DateOnly, strings.TrimSpace(fromText))
+	if err != nil {
+		return nil, fmt.Errorf("dates %q: %w", s, err)
+	}
+	to, err := time.Parse(time.DateOnly, strings.TrimSpace(toText))
+	if err != nil {
+		return nil, fmt.Errorf("dates %q: %w", s, err)
+	}
+	r := &dateRange{from: dayNumber(from), to: dayNumber(to)}
+	if r.from > r.to {
+		return nil, fmt.Errorf("dates %q: range ends before it starts", s)
+	}
+	return r, nil
+}
+
+func dayNumber(t time.Time) int {
+	return t.Year()*10000 + int(t.Month())*100 + t.Day()
+}
+
+func (r *dateRange) contains(t time.Time) bool {
+	day := dayNumber(t)
+	return day >= r.from && day <= r.to
+}
+
+// yearlyRange is an inclusive range of days that recurs every year, stored as mmdd. A range
+// whose end comes before its start runs over the new year.
+type yearlyRange struct{ from, to int }
+
+// parseYearlyRange parses "09-18" or "12-24..01-02".
+func parseYearlyRange(s string) (*yearlyRange, error) {
+	fromText, toText, isRange := strings.Cut(s, "..")
+	if !isRange {
+		toText = fromText
+	}
+	from, err := parseMonthDay(strings.TrimSpace(fromText))
+	if err != nil {
+		return nil, fmt.Errorf("yearly %q: %w", s, err)
+	}
+	to, err := parseMonthDay(strings.TrimSpace(toText))
+	if err != nil {
+		return nil, fmt.Errorf("yearly %q: %w", s, err)
+	}
+	return &yearlyRange{from: from, to: to}, nil
+}
+
+func parseMonthDay(s string) (int, error) {
+	// Parsed in a leap year so that 02-29 is accepted
+	t, err := time.Parse("2006-01-02", "2024-"+s)
+	if err != nil {
+		return 0, fmt.Errorf("want MM-DD: %w", err)
+	}
+	return int(t.Month())*100 + t.Day(), nil
+}
+
+func (r *yearlyRange) contains(t time.Time) bool {
+	day := int(t.Month())*100 + t.Day()
+	if r.from <= r.to {
+		return day >= r.from && day <= r.to
+	}
+	return day >= r.from || day <= r.to
+}
+
+// parseWeekdays parses names such as "sat" and ranges such as "mon-fri" or "fri-mon".
+func parseWeekdays(names []string) (uint8, error) {
+	var bits uint8
+	for _, name := range names {
+		fromText, toText, isRange := strings.Cut(strings.TrimSpace(name), "-")
+		from, ok := weekdayNames[strings.ToLower(fromText)]
+		if !ok {
+			return 0, fmt.Errorf("unknown weekday %q", name)
+		}
+		to := from
+		if isRange {
+			if to, ok = weekdayNames[strings.ToLower(toText)]; !ok {
+				return 0, fmt.Errorf("unknown weekday %q", name)
+			}
+		}
+		for d := from; ; d = (d + 1) % 7 {
+			bits |= 1 << d
+			if d == to {
+				break
+			}
+		}
+	}
+	return bits, nil
+}
+
+// hourWindow is a daily window [start, end) in minutes after midnight. A window whose end is
+// not after its start runs past midnight.
+type hourWindow struct{ start, end int }
+
+// parseHourWindow parses "09:00-10:00", "19:00-24:00" or "23:00-01:00".
+func parseHourWindow(s string) (*hourWindow, error) {
+	startText, endText, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("hours %q: want HH:MM-HH:MM", s)
+	}
+	start, err := parseClock(strings.TrimSpace(startText))
+	if err != nil {
+		return nil, fmt.Errorf("hours %q: %w", s, err)
+	}
+	end, err := parseClock(strings.TrimSpace(endText))
+	if err != nil {
+		return nil, fmt.Errorf("hours %q: %w", s, err)
+	}
+	if start == end || start == 24*60 {
+		return nil, fmt.Errorf("hours %q: empty window", s)
+	}
+	return &hourWindow{start: start, end: end}, nil
+}
+
+func parseClock(s string) (int, error) {
+	hourText, minuteText, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	hour, err1 := strconv.Atoi(hourText)
+	minute, err2 := strconv.Atoi(minuteText)
+	if err1 != nil || err2 != nil || hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return hour*60 + minute, nil
+}
+
+// contains reports whether t is inside the window and returns the day the window started on.
+func (w *hourWindow) contains(t time.Time) (time.Time, bool) {
+	minute := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return t, minute >= w.start && minute < w.end
+	}
+	if minute >= w.start {
+		return t, true
+	}
+	if minute < w.end {
+		return t.AddDate(0, 0, -1), true
+	}
+	return t, false
+}
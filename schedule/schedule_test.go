@@ -0,0 +1,157 @@
+package schedule
+
+import (
+	"Go_Frontend/config"
+	"testing"
+	"time"
+)
+
+func at(value string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", value, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  config.ScheduleRuleConfig
+		match []string
+		miss  []string
+	}{
+		{
+			name:  "yearly morning",
+			rule:  config.ScheduleRuleConfig{Yearly: "09-18", Hours: "09:00-10:00"},
+			match: []string{"2026-09-18 09:00", "2031-09-18 09:59"},
+			miss:  []string{"2026-09-18 10:00", "2026-09-17 09:30", "2026-09-18 08:59"},
+		},
+		{
+			name:  "yearly range over the new year",
+			rule:  config.ScheduleRuleConfig{Yearly: "12-30..01-02"},
+			match: []string{"2026-12-31 12:00", "2027-01-02 23:59"},
+			miss:  []string{"2027-01-03 00:00", "2026-12-29 23:59"},
+		},
+		{
+			name:  "date range on weekends",
+			rule:  config.ScheduleRuleConfig{Dates: "2026-10-01..2026-10-07", Weekdays: []string{"sat", "sun"}},
+			match: []string{"2026-10-03 08:00", "2026-10-04 22:00"},
+			miss:  []string{"2026-10-05 08:00", "2026-10-10 08:00"},
+		},
+		{
+			name:  "window past midnight belongs to the day it starts",
+			rule:  config.ScheduleRuleConfig{Weekdays: []string{"fri"}, Hours: "23:00-01:00"},
+			match: []string{"2026-10-16 23:30", "2026-10-17 00:30"},
+			miss:  []string{"2026-10-16 00:30", "2026-10-17 23:30", "2026-10-17 01:00"},
+		},
+		{
+			name:  "weekday range",
+			rule:  config.ScheduleRuleConfig{Weekdays: []string{"mon-wed"}, Hours: "19:00-24:00"},
+			match: []string{"2026-10-19 19:00", "2026-10-21 23:59"},
+			miss:  []string{"2026-10-22 20:00", "2026-10-19 18:59"},
+		},
+		{
+			name:  "cron with duration",
+			rule:  config.ScheduleRuleConfig{Cron: "0 20 * * fri", Duration: 90 * time.Minute},
+			match: []string{"2026-10-16 20:00", "2026-10-16 21:29"},
+			miss:  []string{"2026-10-16 21:30", "2026-10-16 19:59", "2026-10-17 20:30"},
+		},
+		{
+			name:  "cron day of month or weekday",
+			rule:  config.ScheduleRuleConfig{Cron: "*/30 9 1,15 * mon"},
+			match: []string{"2026-10-01 09:30", "2026-10-19 09:00"},
+			miss:  []string{"2026-10-20 09:00", "2026-10-19 09:15"},
+		},
+		{
+			name:  "new year's eve evening into the new year",
+			rule:  config.ScheduleRuleConfig{Festival: "NewYearEve", Hours: "19:00-01:00"},
+			match: []string{"2026-02-16 19:00", "2026-02-17 00:59"}, // the 12th month of 2025 has 29 days
+			miss:  []string{"2026-02-16 18:59", "2026-02-17 01:00", "2026-02-15 20:00"},
+		},
+		{
+			name:  "festival by chinese name",
+			rule:  config.ScheduleRuleConfig{Festival: "中秋"},
+			match: []string{"2025-10-06 12:00"},
+			miss:  []string{"2025-10-07 12:00"},
+		},
+		{
+			name:  "festival on a solar term",
+			rule:  config.ScheduleRuleConfig{Festival: "Qingming", Hours: "08:00-20:00"},
+			match: []string{"2026-04-05 08:00"},
+			miss:  []string{"2026-04-06 08:00", "2026-04-05 20:00"},
+		},
+		{
+			name:  "solar term",
+			rule:  config.ScheduleRuleConfig{SolarTerm: "dongzhi"},
+			match: []string{"2025-12-21 18:00"},
+			miss:  []string{"2025-12-22 18:00"},
+		},
+		{
+			name:  "lunar range over the lunar new year",
+			rule:  config.ScheduleRuleConfig{Lunar: "12-23..01-15"},
+			match: []string{"2026-02-10 00:00", "2026-03-03 23:59"},
+			miss:  []string{"2026-02-09 12:00", "2026-03-04 00:00"},
+		},
+		{
+			name:  "lunar date skips the leap month by default",
+			rule:  config.ScheduleRuleConfig{Lunar: "06-01"},
+			match: []string{"2025-06-25 12:00"},
+			miss:  []string{"2025-07-25 12:00"}, // first day of the leap 6th month
+		},
+		{
+			name:  "lunar date including the leap month",
+			rule:  config.ScheduleRuleConfig{Lunar: "06-01", Leap: "include"},
+			match: []string{"2025-06-25 12:00", "2025-07-25 12:00"},
+		},
+		{
+			name:  "lunar date in the leap month only",
+			rule:  config.ScheduleRuleConfig{Lunar: "06-01", Leap: "only"},
+			match: []string{"2025-07-25 12:00"},
+			miss:  []string{"2025-06-25 12:00"},
+		},
+	}
+	for _, test := range tests {
+		s, err := Compile([]config.ScheduleRuleConfig{test.rule})
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		for _, value := range test.match {
+			if !s.Match(at(value)) {
+				t.Errorf("%s: %s did not match", test.name, value)
+			}
+		}
+		for _, value := range test.miss {
+			if s.Match(at(value)) {
+				t.Errorf("%s: %s matched", test.name, value)
+			}
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	invalid := []config.ScheduleRuleConfig{
+		{},
+		{Cron: "0 9 * *"},
+		{Cron: "0 25 * * *"},
+		{Cron: "0 9 * * *", Duration: 48 * time.Hour},
+		{Hours: "09:00-10:00", Duration: time.Hour},
+		{Dates: "2026-10-07..2026-10-01"},
+		{Yearly: "13-01"},
+		{Weekdays: []string{"someday"}},
+		{Hours: "09:00-09:00"},
+		{Hours: "9-10"},
+		{Lunar: "13-01"},
+		{Lunar: "12-last..01-15"},
+		{Lunar: "08-15", Leap: "maybe"},
+		{Festival: "MidAutumn", Leap: "include"},
+		{Festival: "MidAutumn", SolarTerm: "qiufen"},
+		{Festival: "Halloween"},
+		{SolarTerm: "spring"},
+	}
+	for _, rule := range invalid {
+		if _, err := Compile([]config.ScheduleRuleConfig{rule}); err == nil {
+			t.Errorf("Compile(%+v) succeeded", rule)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package stream
+
+import (
+	"Go_Frontend/api"
+	"Go_Frontend/config"
+	"Go_Frontend/geoip"
+	"Go_Frontend/logger"
+	"Go_Frontend/util"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// accessDecision 缓存某用户能否播放某条目
+type accessDecision struct {
+	allowed bool
+	reason  string
+}
+
+var (
+	// policyCache 记录每个用户最近一次看到的策略，策略变化时清空该用户的条目判定
+	policyCache = util.NewTTLCache[api.UserPolicy](24 * time.Hour)
+	// itemAccessCache 以 "server:userID:itemID" 为键缓存条目判定
+	itemAccessCache = util.NewTTLCache[accessDecision](5 * time.Minute)
+	// ratingCache 按服务器名称缓存分级对照表
+	ratingCache = util.NewTTLCache[map[string]int](24 * time.Hour)
+)
+
+// InitializeAccess applies the configured lifetime of per-user item decisions.
+func InitializeAccess(cfg config.AccessConfig) {
+	ttl := time.Duration(cfg.CacheTTL) * time.Second
+	if ttl <= 0 {
+		ttl = 5 * time.Minute
+	}
+	itemAccessCache = util.NewTTLCache[accessDecision](ttl)
+}
+
+// InvalidateUser 清除某服务器上某用户的认证、策略和条目判定缓存
+func InvalidateUser(server *config.ServerConfig, userID string) int {
+	prefix := serverKey(server, "")
+	removed := authCache.DeleteFunc(func(key string, user *api.User) bool {
+		return user.ID == userID && strings.HasPrefix(key, prefix)
+	})
+	policyCache.Delete(serverKey(server, userID))
+	removed += itemAccessCache.DeleteFunc(func(key string, _ accessDecision) bool {
+		return strings.HasPrefix(key, serverKey(server, userID+":"))
+	})
+	return removed
+}
+
+// notePolicy 在获取到新的用户信息时调用，策略有变化则丢弃旧的条目判定
+func notePolicy(server *config.ServerConfig, user *api.User) {
+	key := serverKey(server, user.ID)
+	previous, found := policyCache.Get(key)
+	if found && !reflect.DeepEqual(previous, user.Policy) {
+		logger.Info("Policy of user %s changed, dropping cached access decisions", user.Name)
+		itemAccessCache.DeleteFunc(func(k string, _ accessDecision) bool {
+			return strings.HasPrefix(k, key+":")
+		})
+	}
+	policyCache.Set(key, user.Policy)
+}
+
+// authorizeItem 检查用户策略以及条目对该用户是否可见，拒绝时直接写入 403 响应
+func authorizeItem(c *gin.Context, server *config.ServerConfig, user *api.User, itemID string, location geoip.Location) bool {
+	if user == nil || !config.GetConfig().Access.Enabled {
+		return true
+	}
+
+	policy := user.Policy
+	// 认证时已拒绝被禁用的账号，这里再检查一次作为兜底
+	if policy.IsDisabled {
+		return denyAccess(c, user, itemID, "user is disabled")
+	}
+	if !api.Allows(policy.EnableMediaPlayback) {
+		return denyAccess(c, user, itemID, "media playback is disabled for this user")
+	}
+	if !api.Allows(policy.EnableRemoteAccess) && !location.Private {
+		return denyAccess(c, user, itemID, "remote access is disabled for this user")
+	}
+
+	key := serverKey(server, user.ID+":"+api.NormalizeID(itemID))
+	decision, found := itemAccessCache.Get(key)
+	if !found {
+		v, err := sharedCall(c.Request.Context(), "access:"+key, func(ctx context.Context) (interface{}, error) {
+			return checkItemAccess(ctx, server, user, itemID)
+		})
+		if err != nil {
+			logger.Error("Failed to check item access for user %s: %v", user.Name, err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to check item access"})
+			return false
+		}
+		decision = v.(accessDecision)
+		itemAccessCache.Set(key, decision)
+	}
+
+	if !decision.allowed {
+		return denyAccess(c, user, itemID, decision.reason)
+	}
+	return true
+}
+
+func denyAccess(c *gin.Context, user *api.User, itemID, reason string) bool {
+	logger.Warn("Denied item %s to user %s: %s", itemID, user.Name, reason)
+	c.JSON(http.StatusForbidden, gin.H{"error": reason})
+	return false
+}
+
+// checkItemAccess 通过用户视角的条目接口判断可见性，再核对分级和媒体库限制。
+// Emby/Jellyfin 在用户视角下已经过滤了受限条目，这里的显式检查用于兜底。
+func checkItemAccess(ctx context.Context, server *config.ServerConfig, user *api.User, itemID string) (accessDecision, error) {
+	mediaServer := api.NewMediaServer(server)
+
+	item, err := mediaServer.GetUserItem(ctx, user.ID, itemID)
+	if errors.Is(err, api.ErrNotFound) {
+		return accessDecision{reason: "item is not visible to this user"}, nil
+	}
+	if err != nil {
+		return accessDecision{}, err
+	}
+
+	if limit := user.Policy.MaxParentalRating; limit != nil && item.OfficialRating != "" {
+		ratings, err := parentalRatings(ctx, server, mediaServer)
+		if err != nil {
+			return accessDecision{}, err
+		}
+		if value, known := ratings[strings.ToUpper(item.OfficialRating)]; known && value > *limit {
+			return accessDecision{reason: fmt.Sprintf("parental rating %s exceeds the user's limit", item.OfficialRating)}, nil
+		}
+	}
+
+	if !api.Allows(user.Policy.EnableAllFolders) {
+		ancestors, err := mediaServer.GetAncestors(ctx, user.ID, itemID)
+		if err != nil {
+			return accessDecision{}, err
+		}
+		if !inEnabledFolders(ancestors, user.Policy.EnabledFolders) {
+			return accessDecision{reason: "item is outside the libraries enabled for this user"}, nil
+		}
+	}
+
+	return accessDecision{allowed: true}, nil
+}
+
+func inEnabledFolders(ancestors []api.Item, enabledFolders []string) bool {
+	enabled := make(map[string]bool, len(enabledFolders))
+	for _, folder := range enabledFolders {
+		enabled[api.NormalizeID(folder)] = true
+	}
+	for _, ancestor := range ancestors {
+		if enabled[api.NormalizeID(ancestor.ID)] {
+			return true
+		}
+	}
+	return false
+}
+
+// parentalRatings 返回以大写分级名为键的对照表
+func parentalRatings(ctx context.Context, server *config.ServerConfig, mediaServer api.MediaServer) (map[string]int, error) {
+	if ratings, found := ratingCache.Get(server.Name); found {
+		return ratings, nil
+	}
+	list, err := mediaServer.GetParentalRatings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ratings := make(map[string]int, len(list))
+	for _, rating := range list {
+		ratings[strings.ToUpper(rating.Name)] = rating.Value
+	}
+	ratingCache.Set(server.Name, ratings)
+	return ratings, nil
+}
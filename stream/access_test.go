@@ -0,0 +1,184 @@
+package stream
+
+import (
+	"Go_Frontend/api"
+	"Go_Frontend/config"
+	"Go_Frontend/geoip"
+	"Go_Frontend/util"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuthorizeItem(t *testing.T) {
+	var requests atomic.Int32
+	var failing atomic.Bool
+	emby := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		switch r.URL.Path {
+		case "/Users/u1/Items/movie":
+			w.Write([]byte(`{"Id": "movie", "OfficialRating": "R"}`))
+		case "/Items/movie/Ancestors":
+			w.Write([]byte(`[{"Id": "movies"}, {"Id": "root"}]`))
+		case "/Localization/ParentalRatings":
+			w.Write([]byte(`[{"Name": "PG-13", "Value": 13}, {"Name": "R", "Value": 17}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(emby.Close)
+
+	savedAccess, savedRetries := config.GetConfig().Access, config.GetConfig().EmbyClient.Retries
+	savedItems, savedRatings, savedPolicies := itemAccessCache, ratingCache, policyCache
+	t.Cleanup(func() {
+		config.GetConfig().Access, config.GetConfig().EmbyClient.Retries = savedAccess, savedRetries
+		itemAccessCache, ratingCache, policyCache = savedItems, savedRatings, savedPolicies
+	})
+	config.GetConfig().Access = config.AccessConfig{Enabled: true, CacheTTL: 60}
+	config.GetConfig().EmbyClient.Retries = 0
+	ratingCache = util.NewTTLCache[map[string]int](time.Hour)
+	policyCache = util.NewTTLCache[api.UserPolicy](time.Hour)
+
+	server := &config.ServerConfig{Name: "access", Type: config.ServerTypeEmby, URL: emby.URL}
+	public := geoip.Location{IP: "203.0.113.7", Country: "HK"}
+	private := geoip.Location{IP: "192.168.1.10", Private: true}
+	disabled, limit := false, 13
+
+	authorize := func(user *api.User, itemID string, location geoip.Location) int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/videos/"+itemID+"/stream", nil)
+		if authorizeItem(c, server, user, itemID, location) {
+			return http.StatusOK
+		}
+		return w.Code
+	}
+
+	tests := []struct {
+		name     string
+		policy   api.UserPolicy
+		itemID   string
+		location geoip.Location
+		want     int
+	}{
+		{"visible item", api.UserPolicy{}, "movie", public, http.StatusOK},
+		{"hidden item", api.UserPolicy{}, "hidden", public, http.StatusForbidden},
+		{"disabled user", api.UserPolicy{IsDisabled: true}, "movie", private, http.StatusForbidden},
+		{"playback disabled", api.UserPolicy{EnableMediaPlayback: &disabled}, "movie", private, http.StatusForbidden},
+		{"remote access disabled", api.UserPolicy{EnableRemoteAccess: &disabled}, "movie", public, http.StatusForbidden},
+		{"remote access disabled, local client", api.UserPolicy{EnableRemoteAccess: &disabled}, "movie", private, http.StatusOK},
+		{"parental rating", api.UserPolicy{MaxParentalRating: &limit}, "movie", public, http.StatusForbidden},
+		{"enabled library", api.UserPolicy{EnableAllFolders: &disabled, EnabledFolders: []string{"movies"}}, "movie", public, http.StatusOK},
+		{"other library", api.UserPolicy{EnableAllFolders: &disabled, EnabledFolders: []string{"shows"}}, "movie", public, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		InitializeAccess(config.GetConfig().Access)
+		user := &api.User{ID: "u1", Name: "alice", Policy: test.policy}
+		if got := authorize(user, test.itemID, test.location); got != test.want {
+			t.Errorf("%s: status %d, want %d", test.name, got, test.want)
+		}
+	}
+
+	// Without a user or with the check switched off every item is allowed
+	if got := authorize(nil, "hidden", public); got != http.StatusOK {
+		t.Errorf("anonymous request: status %d, want %d", got, http.StatusOK)
+	}
+	config.GetConfig().Access.Enabled = false
+	if got := authorize(&api.User{ID: "u1", Policy: api.UserPolicy{IsDisabled: true}}, "hidden", public); got != http.StatusOK {
+		t.Errorf("access check disabled: status %d, want %d", got, http.StatusOK)
+	}
+	config.GetConfig().Access.Enabled = true
+
+	// Verdicts are cached per user and item, allowed or not, and outlive a failing media server
+	InitializeAccess(config.GetConfig().Access)
+	user := &api.User{ID: "u1", Name: "alice"}
+	authorize(user, "movie", public)
+	authorize(user, "hidden", public)
+	before := requests.Load()
+	failing.Store(true)
+	if got := authorize(user, "movie", public); got != http.StatusOK {
+		t.Errorf("cached allow: status %d, want %d", got, http.StatusOK)
+	}
+	if got := authorize(user, "hidden", public); got != http.StatusForbidden {
+		t.Errorf("cached deny: status %d, want %d", got, http.StatusForbidden)
+	}
+	if n := requests.Load() - before; n != 0 {
+		t.Errorf("cached verdicts made %d requests", n)
+	}
+	if got := authorize(user, "other", public); got != http.StatusServiceUnavailable {
+		t.Errorf("media server down: status %d, want %d", got, http.StatusServiceUnavailable)
+	}
+
+	// A changed policy drops the user's cached verdicts
+	failing.Store(false)
+	notePolicy(server, user)
+	notePolicy(server, &api.User{ID: "u1", Policy: api.UserPolicy{EnableAllFolders: &disabled, EnabledFolders: []string{"shows"}}})
+	if got := authorize(&api.User{ID: "u1", Policy: api.UserPolicy{EnableAllFolders: &disabled, EnabledFolders: []string{"shows"}}}, "movie", public); got != http.StatusForbidden {
+		t.Errorf("after policy change: status %d, want %d", got, http.StatusForbidden)
+	}
+}
+
+func TestFetchParametersAuthorizesFirst(t *testing.T) {
+	var playbackInfo atomic.Int32
+	emby := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/Users/u1/Items/movie":
+			w.Write([]byte(`{"Id": "movie"}`))
+		case "/Items/movie/PlaybackInfo", "/Items/hidden/PlaybackInfo":
+			playbackInfo.Add(1)
+			w.Write([]byte(`{"MediaSources": [{"Id": "a", "Path": "/mnt/gd/Movie.mkv"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(emby.Close)
+
+	savedAccess, savedRetries := config.GetConfig().Access, config.GetConfig().EmbyClient.Retries
+	savedItems, savedPolicies, savedSources := itemAccessCache, policyCache, mediaSourcesCache
+	t.Cleanup(func() {
+		config.GetConfig().Access, config.GetConfig().EmbyClient.Retries = savedAccess, savedRetries
+		itemAccessCache, policyCache, mediaSourcesCache = savedItems, savedPolicies, savedSources
+	})
+	config.GetConfig().Access = config.AccessConfig{Enabled: true, CacheTTL: 60}
+	config.GetConfig().EmbyClient.Retries = 0
+	InitializeAccess(config.GetConfig().Access)
+	policyCache = util.NewTTLCache[api.UserPolicy](time.Hour)
+	mediaSourcesCache = util.NewTTLCache[[]api.MediaSourceInfo](time.Hour)
+
+	server := &config.ServerConfig{Name: "params", Type: config.ServerTypeEmby, URL: emby.URL}
+	user := &api.User{ID: "u1", Name: "alice"}
+	fetch := func(itemID string) (string, int) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/videos/"+itemID+"/stream", nil)
+		c.Params = gin.Params{{Key: "itemID", Value: itemID}}
+		_, mediaSourceID, _, _ := fetchParameters(c, server, user, geoip.Location{IP: "203.0.113.7"})
+		if mediaSourceID == "" {
+			return "", w.Code
+		}
+		return mediaSourceID, http.StatusOK
+	}
+
+	// A denied item never reaches PlaybackInfo, so its media sources are not disclosed
+	if _, status := fetch("hidden"); status != http.StatusForbidden {
+		t.Errorf("hidden item: status %d, want %d", status, http.StatusForbidden)
+	}
+	if n := playbackInfo.Load(); n != 0 {
+		t.Errorf("denied request made %d PlaybackInfo requests", n)
+	}
+
+	if mediaSourceID, status := fetch("movie"); status != http.StatusOK || mediaSourceID != "a" {
+		t.Errorf("visible item: media source %q, status %d", mediaSourceID, status)
+	}
+	if n := playbackInfo.Load(); n != 1 {
+		t.Errorf("visible item made %d PlaybackInfo requests, want 1", n)
+	}
+}
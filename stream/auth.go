@@ -0,0 +1,128 @@
+package stream
+
+import (
+	"Go_Frontend/api"
+	"Go_Frontend/config"
+	"Go_Frontend/logger"
+	"Go_Frontend/util"
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// authCache 短期缓存已验证的客户端令牌，避免每次播放都请求 Emby
+var authCache = util.NewTTLCache[*api.User](time.Minute)
+
+// InitializeAuth applies the configured lifetime of the authenticated-token cache.
+func InitializeAuth(cfg config.AuthConfig) {
+	ttl := time.Duration(cfg.CacheTTL) * time.Second
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	authCache = util.NewTTLCache[*api.User](ttl)
+	plexAccessCache = util.NewTTLCache[struct{}](ttl)
+	if !cfg.Enabled {
+		logger.Warn("Client authentication is disabled, any caller can obtain signed links")
+	}
+}
+
+// authenticateRequest 向所选服务器验证请求方的 Emby 令牌，失败时直接写入 401 响应
+// 未启用认证时返回 (nil, true)
+func authenticateRequest(c *gin.Context, server *config.ServerConfig) (*api.User, bool) {
+	if !config.GetConfig().Auth.Enabled {
+		return nil, true
+	}
+
+	token := extractClientToken(c.Request)
+	if token == "" {
+		logger.Warn("Rejected stream request without access token from %s", c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing access token"})
+		return nil, false
+	}
+
+	key := serverKey(server, token)
+	if user, found := authCache.Get(key); found {
+		noteActiveUser(server, user)
+		return user, true
+	}
+
+	v, err := sharedCall(c.Request.Context(), "auth:"+key, func(ctx context.Context) (interface{}, error) {
+		return api.NewMediaServer(server).GetCurrentUser(ctx, token)
+	})
+	if errors.Is(err, api.ErrUnauthorized) {
+		logger.Warn("Rejected stream request with invalid access token from %s", c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid access token"})
+		return nil, false
+	}
+	if err != nil {
+		logger.Error("Failed to validate access token: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to validate access token"})
+		return nil, false
+	}
+
+	user := v.(*api.User)
+	authCache.Set(key, user)
+	notePolicy(server, user)
+	noteActiveUser(server, user)
+	logger.Info("Authenticated user %s (%s) on server %s", user.Name, user.ID, server.Name)
+	return user, true
+}
+
+// extractClientToken 按 Emby/Jellyfin 客户端的习惯依次查找访问令牌
+func extractClientToken(r *http.Request) string {
+	query := r.URL.Query()
+	for key, values := range query {
+		if (strings.EqualFold(key, "api_key") || strings.EqualFold(key, "X-Emby-Token")) && len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+
+	for _, header := range []string{"X-Emby-Token", "X-MediaBrowser-Token"} {
+		if token := r.Header.Get(header); token != "" {
+			return token
+		}
+	}
+
+	for _, header := range []string{"X-Emby-Authorization", "Authorization"} {
+		if token := parseAuthorizationToken(r.Header.Get(header)); token != "" {
+			return token
+		}
+	}
+	return ""
+}
+
+// parseAuthorizationToken 解析 `MediaBrowser Client="...", Token="..."` 形式的认证头
+func parseAuthorizationToken(header string) string {
+	return parseAuthorizationParam(header, "Token")
+}
+
+// parseAuthorizationParam 读取 MediaBrowser/Emby 认证头中的一个参数
+func parseAuthorizationParam(header, name string) string {
+	scheme, params, found := strings.Cut(strings.TrimSpace(header), " ")
+	if !found || (!strings.EqualFold(scheme, "MediaBrowser") && !strings.EqualFold(scheme, "Emby")) {
+		return ""
+	}
+	for _, param := range strings.Split(params, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if ok && strings.EqualFold(strings.TrimSpace(key), name) {
+			return strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return ""
+}
+
+// clientName 返回请求方的客户端名称，如 "Infuse"、"Emby Web"
+func clientName(r *http.Request) string {
+	if client := r.Header.Get("X-Emby-Client"); client != "" {
+		return client
+	}
+	for _, header := range []string{"X-Emby-Authorization", "Authorization"} {
+		if client := parseAuthorizationParam(r.Header.Get(header), "Client"); client != "" {
+			return client
+		}
+	}
+	return ""
+}
@@ -0,0 +1,152 @@
+package stream
+
+import (
+	"Go_Frontend/api"
+	"Go_Frontend/config"
+	"Go_Frontend/util"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestExtractClientToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		headers map[string]string
+		want    string
+	}{
+		{"api_key", "?api_key=q1", nil, "q1"},
+		{"X-Emby-Token query, any case", "?x-emby-token=q2", nil, "q2"},
+		{"empty query value", "?api_key=", map[string]string{"X-Emby-Token": "h1"}, "h1"},
+		{"X-Emby-Token header", "", map[string]string{"X-Emby-Token": "h1"}, "h1"},
+		{"X-MediaBrowser-Token header", "", map[string]string{"X-MediaBrowser-Token": "h2"}, "h2"},
+		{"X-Emby-Authorization", "", map[string]string{"X-Emby-Authorization": `MediaBrowser Client="Infuse", Token="a1"`}, "a1"},
+		{"Authorization", "", map[string]string{"Authorization": `Emby UserId="u", Token="a2"`}, "a2"},
+		{"query before headers", "?api_key=q1", map[string]string{"X-Emby-Token": "h1"}, "q1"},
+		{"token header before authorization", "", map[string]string{"X-Emby-Token": "h1", "Authorization": `MediaBrowser Token="a2"`}, "h1"},
+		{"bearer is not a MediaBrowser header", "", map[string]string{"Authorization": "Bearer b1"}, ""},
+		{"none", "", nil, ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/videos/1/stream"+test.query, nil)
+		for name, value := range test.headers {
+			r.Header.Set(name, value)
+		}
+		if got := extractClientToken(r); got != test.want {
+			t.Errorf("%s: token %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseAuthorizationToken(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{`MediaBrowser Client="Emby Web", Device="Chrome", Token="abc"`, "abc"},
+		{`Emby token="abc"`, "abc"},
+		{`mediabrowser Token=abc`, "abc"},
+		{`MediaBrowser  Client="Infuse" , Token = "abc" `, "abc"},
+		{`MediaBrowser Client="Infuse"`, ""},
+		{`Basic dXNlcjpwYXNz`, ""},
+		{`MediaBrowser`, ""},
+		{``, ""},
+	}
+	for _, test := range tests {
+		if got := parseAuthorizationToken(test.header); got != test.want {
+			t.Errorf("parseAuthorizationToken(%q) = %q, want %q", test.header, got, test.want)
+		}
+	}
+}
+
+func TestAuthenticateRequest(t *testing.T) {
+	var requests atomic.Int32
+	var down atomic.Bool
+	emby := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch {
+		case down.Load():
+			w.WriteHeader(http.StatusBadGateway)
+		case r.URL.Path != "/Users/Me":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Header.Get("X-Emby-Token") == "good":
+			w.Write([]byte(`{"Id": "u1", "Name": "alice"}`))
+		case r.Header.Get("X-Emby-Token") == "disabled":
+			w.Write([]byte(`{"Id": "u2", "Name": "bob", "Policy": {"IsDisabled": true}}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	t.Cleanup(emby.Close)
+
+	savedAuth, savedRetries := config.GetConfig().Auth, config.GetConfig().EmbyClient.Retries
+	savedAuthCache, savedPlexAccess, savedPolicies := authCache, plexAccessCache, policyCache
+	t.Cleanup(func() {
+		config.GetConfig().Auth, config.GetConfig().EmbyClient.Retries = savedAuth, savedRetries
+		authCache, plexAccessCache, policyCache = savedAuthCache, savedPlexAccess, savedPolicies
+	})
+	config.GetConfig().Auth = config.AuthConfig{Enabled: true, CacheTTL: 60}
+	config.GetConfig().EmbyClient.Retries = 0
+	InitializeAuth(config.GetConfig().Auth)
+	policyCache = util.NewTTLCache[api.UserPolicy](time.Hour)
+
+	server := &config.ServerConfig{Name: "auth", Type: config.ServerTypeEmby, URL: emby.URL}
+	authenticate := func(token string) (*api.User, int) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/videos/1/stream", nil)
+		if token != "" {
+			c.Request.Header.Set("X-Emby-Token", token)
+		}
+		user, ok := authenticateRequest(c, server)
+		if ok {
+			return user, http.StatusOK
+		}
+		return nil, w.Code
+	}
+
+	tests := []struct {
+		token    string
+		status   int
+		requests int32 // made to the media server
+	}{
+		{"", http.StatusUnauthorized, 0},
+		{"good", http.StatusOK, 1},
+		{"good", http.StatusOK, 0}, // cached
+		{"bad", http.StatusUnauthorized, 1},
+		{"bad", http.StatusUnauthorized, 1}, // rejected tokens are not cached
+		{"disabled", http.StatusUnauthorized, 1},
+	}
+	for _, test := range tests {
+		before := requests.Load()
+		user, status := authenticate(test.token)
+		if status != test.status {
+			t.Errorf("token %q: status %d, want %d", test.token, status, test.status)
+		}
+		if n := requests.Load() - before; n != test.requests {
+			t.Errorf("token %q: %d requests to the media server, want %d", test.token, n, test.requests)
+		}
+		if status == http.StatusOK && (user == nil || user.ID != "u1") {
+			t.Errorf("token %q: user %+v", test.token, user)
+		}
+	}
+
+	// A failing media server is not the client's fault
+	down.Store(true)
+	if _, status := authenticate("new"); status != http.StatusServiceUnavailable {
+		t.Errorf("media server down: status %d, want %d", status, http.StatusServiceUnavailable)
+	}
+	if _, status := authenticate("good"); status != http.StatusOK {
+		t.Errorf("media server down, cached token: status %d, want %d", status, http.StatusOK)
+	}
+
+	config.GetConfig().Auth.Enabled = false
+	if user, status := authenticate(""); status != http.StatusOK || user != nil {
+		t.Errorf("authentication disabled: status %d, user %+v", status, user)
+	}
+}
@@ -2,56 +2,528 @@
 package stream
 
 import (
-	"github.com/allegro/bigcache"
+	"Go_Frontend/api"
+	"Go_Frontend/config"
+	"Go_Frontend/library"
+	"Go_Frontend/logger"
+	"container/list"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/allegro/bigcache"
 )
 
-// Cache wraps the bigcache instance for easier use.
-type Cache struct {
-	cache *bigcache.BigCache
+// Cache stores the resolved path and metadata of media sources, keyed by "server:itemID:mediaSourceID".
+// Streaming URLs are not cached: they are signed per request, so every link gets its full lifetime.
+// Every entry expires after the TTL it was set with.
+type Cache interface {
+	// Get retrieves the value associated with the key.
+	// Returns the value and a boolean indicating whether the key was found.
+	Get(key string) (string, bool)
+	// Set adds a key-value pair that expires after ttl.
+	Set(key string, value string, ttl time.Duration) error
+	// Delete removes a key-value pair.
+	Delete(key string) error
+	// DeleteFunc removes every entry whose key satisfies fn and returns how many were removed.
+	DeleteFunc(fn func(key string) bool) int
+	// Reset removes every entry.
+	Reset() error
+	// Len returns the number of entries.
+	Len() int
+	// Range calls fn for every entry until fn returns false.
+	Range(fn func(key, value string) bool) error
 }
 
-// NewCache initializes a new Cache instance with the specified expiration time.
-func NewCache(expiration time.Duration) (*Cache, error) {
-	config := bigcache.Config{
-		Shards:             4096,           // Number of cache shards (divisions for concurrency)
-		LifeWindow:         expiration,     // Cache expiration duration
-		CleanWindow:        expiration / 2, // Frequency of clean-up tasks
-		MaxEntriesInWindow: 1000 * 10 * 60, // Max entries in the given time window
-		MaxEntrySize:       500,            // Max size of a single entry
-		Verbose:            false,          // Toggle additional logging
-		HardMaxCacheSize:   0,              // Set max cache size in MB (0 means unlimited)
+// Locker is implemented by caches shared between instances. A lock held while resolving an
+// item keeps other instances from resolving it again; they wait for the cached result instead.
+type Locker interface {
+	// TryLock acquires key for at most ttl. ok is false when another holder has it.
+	TryLock(key string, ttl time.Duration) (unlock func(), ok bool, err error)
+}
+
+const (
+	cacheTypeMemory = "memory"
+	cacheTypeRedis  = "redis"
+
+	defaultCacheTTL        = 24 * time.Hour
+	defaultCacheMaxEntries = 100_000
+	defaultNegativeTTL     = 30 * time.Second
+
+	// revalidateTimeout 后台重新解析过期路径的超时时间
+	revalidateTimeout = 30 * time.Second
+
+	// lockPollInterval 等待其他实例解析时检查缓存的间隔
+	lockPollInterval = 50 * time.Millisecond
+)
+
+var (
+	// cacheTTL 媒体源路径的缓存时间，路径变化由 Webhook 失效
+	cacheTTL = defaultCacheTTL
+	// negativeTTL 条目或媒体源不存在的结果的缓存时间，0 表示不缓存
+	negativeTTL = defaultNegativeTTL
+	// staleWhileRevalidate、staleIfError 路径过期后仍可使用的时间，见 config.CacheConfig
+	staleWhileRevalidate, staleIfError time.Duration
+	// locker 启用分布式锁时跨实例合并同一条目的解析，nil 表示只在进程内合并
+	locker      Locker
+	lockTimeout time.Duration
+)
+
+// InitializeCache creates the configured path cache.
+func InitializeCache(cfg config.CacheConfig) error {
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+
+	var instance Cache
+	locker = nil
+	snapshotCfg = config.CacheSnapshotConfig{}
+	switch cfg.Type {
+	case "", cacheTypeMemory:
+		if cfg.Lock {
+			return fmt.Errorf("Cache.lock requires a shared cache (type: %s)", cacheTypeRedis)
+		}
+		maxEntries := cfg.MaxEntries
+		if maxEntries <= 0 {
+			maxEntries = defaultCacheMaxEntries
+		}
+		// 条目过期后还要保留到 stale 窗口结束
+		memory, err := NewMemoryCache(maxEntries, ttl+max(cfg.StaleWhileRevalidate, cfg.StaleIfError, cfg.NegativeTTL))
+		if err != nil {
+			return err
+		}
+		if cfg.Snapshot.File != "" {
+			snapshotCfg = cfg.Snapshot
+			if err := loadCacheSnapshot(memory, configHash(config.GetConfig().Servers)); err != nil {
+				return err
+			}
+		}
+		instance = memory
+	case cacheTypeRedis:
+		if cfg.Snapshot.File != "" {
+			return errors.New("Cache.snapshot is only supported by the memory cache, redis persists entries itself")
+		}
+		redisCache, err := NewRedisCache(cfg.Redis)
+		if err != nil {
+			return err
+		}
+		instance = redisCache
+		if cfg.Lock {
+			locker = redisCache
+		}
+	default:
+		return fmt.Errorf("unknown Cache type %q", cfg.Type)
+	}
+
+	cache, cacheTTL = instance, ttl
+	negativeTTL, staleWhileRevalidate, staleIfError = max(cfg.NegativeTTL, 0), max(cfg.StaleWhileRevalidate, 0), max(cfg.StaleIfError, 0)
+	lockTimeout = cfg.LockTimeout
+	if lockTimeout <= 0 {
+		lockTimeout = 5 * time.Second
+	}
+	logger.Info("Media path cache: %s, ttl %s, negative ttl %s, stale-while-revalidate %s, stale-if-error %s, distributed lock %t",
+		cfg.Type, ttl, negativeTTL, staleWhileRevalidate, staleIfError, locker != nil)
+	return nil
+}
+
+// pathCacheKey 路径与客户端无关，缓存键只区分服务器、条目和媒体源
+func pathCacheKey(server *config.ServerConfig, itemID, mediaSourceID string) string {
+	return serverKey(server, itemID+":"+mediaSourceID)
+}
+
+// pathEntry 是路径缓存中的值。Source 为 nil 表示条目或媒体源不存在 (负缓存)
+type pathEntry struct {
+	Source     *library.Source `json:"source,omitempty"`
+	FreshUntil int64           `json:"freshUntil"` // Unix 毫秒；之后只在 stale 窗口内使用
+}
+
+func (e *pathEntry) fresh(now time.Time) bool {
+	return now.UnixMilli() < e.FreshUntil
+}
+
+// within 判断过期不超过 window
+func (e *pathEntry) within(now time.Time, window time.Duration) bool {
+	return now.UnixMilli() < e.FreshUntil+window.Milliseconds()
+}
+
+func (e *pathEntry) media(mediaSourceID string) *api.MediaSourceInfo {
+	return &api.MediaSourceInfo{
+		ID:           mediaSourceID,
+		Path:         e.Source.Path,
+		Container:    e.Source.Container,
+		Size:         e.Source.Size,
+		RunTimeTicks: e.Source.RunTimeTicks,
+	}
+}
+
+// loadPathEntry 读取路径缓存，包括已过期但仍在 stale 窗口内的条目
+func loadPathEntry(key string) (*pathEntry, bool) {
+	value, found := cache.Get(key)
+	if !found {
+		return nil, false
+	}
+	var entry pathEntry
+	if err := json.Unmarshal([]byte(value), &entry); err != nil || (entry.Source != nil && entry.Source.Path == "") {
+		logger.Warn("Dropping unreadable path cache entry %s: %v", key, err)
+		_ = cache.Delete(key)
+		return nil, false
+	}
+	return &entry, true
+}
+
+// storeMediaSource 缓存签名需要的路径和元数据，MediaStreams 等其他字段不缓存。
+// 条目在 cacheTTL 后过期，再保留到 stale 窗口结束
+func storeMediaSource(key string, media *api.MediaSourceInfo) {
+	storePathEntry(key, &pathEntry{
+		Source: &library.Source{
+			Path:         media.Path,
+			Container:    media.Container,
+			Size:         media.Size,
+			RunTimeTicks: media.RunTimeTicks,
+		},
+		FreshUntil: time.Now().Add(cacheTTL).UnixMilli(),
+	}, cacheTTL+max(staleWhileRevalidate, staleIfError))
+}
+
+// storeMissing 缓存条目或媒体源不存在的结果，客户端反复重试时不再请求媒体服务器
+func storeMissing(key string) {
+	if negativeTTL <= 0 {
+		return
 	}
+	storePathEntry(key, &pathEntry{FreshUntil: time.Now().Add(negativeTTL).UnixMilli()}, negativeTTL)
+}
 
+func storePathEntry(key string, entry *pathEntry, ttl time.Duration) {
+	value, err := json.Marshal(entry)
+	if err == nil {
+		err = cache.Set(key, string(value), ttl)
+	}
+	if err != nil {
+		logger.Warn("Failed to cache media path %s: %v", key, err)
+	}
+}
+
+// CacheStats counts how media source lookups were answered by the path cache since start.
+type CacheStats struct {
+	Hits         int64 `json:"hits"`         // fresh entries
+	Misses       int64 `json:"misses"`       // lookups resolved by the media server
+	StaleServed  int64 `json:"staleServed"`  // expired entries served while revalidating in the background
+	StaleOnError int64 `json:"staleOnError"` // expired entries served because the media server failed
+	NegativeHits int64 `json:"negativeHits"` // lookups answered by a cached "not found"
+}
+
+var cacheStats struct {
+	hits, misses, staleServed, staleOnError, negativeHits atomic.Int64
+}
+
+// GetCacheStats returns the path cache counters.
+func GetCacheStats() CacheStats {
+	return CacheStats{
+		Hits:         cacheStats.hits.Load(),
+		Misses:       cacheStats.misses.Load(),
+		StaleServed:  cacheStats.staleServed.Load(),
+		StaleOnError: cacheStats.staleOnError.Load(),
+		NegativeHits: cacheStats.negativeHits.Load(),
+	}
+}
+
+// lockResolve 启用分布式锁时，在解析 key 前获取锁。其他实例正在解析同一条目时等待它写入缓存，
+// 并返回缓存的条目 (可能是负缓存)；等待超时则自行解析。release 需在写入缓存后调用
+func lockResolve(ctx context.Context, key string) (cached *pathEntry, release func()) {
+	release = func() {}
+	if locker == nil {
+		return nil, release
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		unlock, ok, err := locker.TryLock(key, lockTimeout)
+		if err != nil {
+			logger.Warn("Failed to lock %s, resolving without it: %v", key, err)
+			return nil, release
+		}
+		// 上一个持有者可能刚写入缓存并释放锁，拿到锁后也要再查一次
+		if entry, found := loadPathEntry(key); found && entry.fresh(time.Now()) {
+			if ok {
+				unlock()
+			}
+			return entry, release
+		}
+		if ok {
+			return nil, unlock
+		}
+		if time.Now().After(deadline) {
+			logger.Warn("Timed out waiting for another instance to resolve %s", key)
+			return nil, release
+		}
+		select {
+		case <-ctx.Done():
+			return nil, release
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// MemoryCache is the in-process cache. Values live in bigcache; on top of it an index of the
+// keys in least-recently-used order evicts the least recently used entry once maxEntries is
+// reached, and serves DeleteFunc, Range and snapshots (the iterator of bigcache v1 returns
+// corrupted keys). Expired entries are dropped when read or evicted.
+//
+// Like bigcache itself, the index is split into shards by key hash, each with its own lock and
+// an equal part of maxEntries, so concurrent lookups of different keys rarely contend. Eviction
+// is least recently used per shard, which approximates a global LRU once every shard holds many entries.
+type MemoryCache struct {
+	cache      *bigcache.BigCache
+	shards     []*indexShard
+	maxEntries int
+	evictions  atomic.Int64 // entries dropped to make room, not counting expired ones
+}
+
+const (
+	// maxIndexShards bounds the number of index shards.
+	maxIndexShards = 64
+	// minShardEntries keeps small caches in few shards, where per-shard eviction would be too coarse.
+	minShardEntries = 256
+)
+
+// indexShard is the LRU index of the keys hashing to one shard.
+type indexShard struct {
+	mu         sync.Mutex
+	maxEntries int // 0 means unlimited
+	keys       map[string]*list.Element
+	lru        *list.List // *indexEntry, front is the most recently used
+}
+
+type indexEntry struct {
+	key      string
+	lastUsed int64 // Unix nanoseconds, orders the shards against each other in snapshots
+}
+
+// NewMemoryCache initializes a new MemoryCache holding at most maxEntries entries.
+// lifeWindow bounds the TTL of every entry: bigcache drops older entries on its own.
+func NewMemoryCache(maxEntries int, lifeWindow time.Duration) (*MemoryCache, error) {
+	config := bigcache.Config{
+		Shards:             1024,                  // Number of cache shards (divisions for concurrency)
+		LifeWindow:         lifeWindow,            // Longest TTL of an entry
+		CleanWindow:        time.Minute,           // Frequency of clean-up tasks
+		MaxEntriesInWindow: max(maxEntries, 1024), // Initial capacity, in entries
+		MaxEntrySize:       256,                   // Typical size of an entry, for the initial capacity
+		Verbose:            false,                 // Toggle additional logging
+		HardMaxCacheSize:   0,                     // Set max cache size in MB (0 means unlimited); maxEntries bounds the cache instead
+	}
 	cacheInstance, err := bigcache.NewBigCache(config)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Cache{cache: cacheInstance}, nil
+	count := 1
+	for count < maxIndexShards && (maxEntries <= 0 || maxEntries/(count*2) >= minShardEntries) {
+		count *= 2
+	}
+	shards := make([]*indexShard, count)
+	for i := range shards {
+		shards[i] = &indexShard{keys: make(map[string]*list.Element), lru: list.New()}
+		if maxEntries > 0 {
+			// Spread the remainder so that the shard limits add up to maxEntries
+			shards[i].maxEntries = maxEntries / count
+			if i < maxEntries%count {
+				shards[i].maxEntries++
+			}
+		}
+	}
+	return &MemoryCache{cache: cacheInstance, shards: shards, maxEntries: maxEntries}, nil
 }
 
-// Set adds a new key-value pair to the cache.
-func (c *Cache) Set(key string, value string) error {
-	return c.cache.Set(key, []byte(value))
+// shard returns the index shard of key (FNV-1a).
+func (c *MemoryCache) shard(key string) *indexShard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return c.shards[hash&uint32(len(c.shards)-1)]
+}
+
+// Set adds a new key-value pair to the cache, evicting the least recently used entry of the
+// key's shard when it is full. bigcache only knows one LifeWindow, so the entry's expiry is
+// stored in front of the value.
+func (c *MemoryCache) Set(key string, value string, ttl time.Duration) error {
+	entry := make([]byte, 8+len(value))
+	binary.BigEndian.PutUint64(entry, uint64(time.Now().Add(ttl).UnixNano()))
+	copy(entry[8:], value)
+
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := c.cache.Set(key, entry); err != nil {
+		return err
+	}
+	if element, found := s.keys[key]; found {
+		s.touch(element)
+		return nil
+	}
+	s.keys[key] = s.lru.PushFront(&indexEntry{key: key, lastUsed: time.Now().UnixNano()})
+	for s.maxEntries > 0 && s.lru.Len() > s.maxEntries {
+		c.remove(s, s.lru.Back())
+		c.evictions.Add(1)
+	}
+	return nil
 }
 
 // Get retrieves the value associated with the key from the cache.
-// Returns the value and a boolean indicating whether the key was found.
-func (c *Cache) Get(key string) (string, bool) {
-	value, err := c.cache.Get(key)
-	if err != nil {
+func (c *MemoryCache) Get(key string) (string, bool) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, found := s.keys[key]
+	if !found {
+		return "", false
+	}
+	value, ok := c.read(key)
+	if !ok {
+		c.remove(s, element)
 		return "", false
 	}
-	return string(value), true
+	s.touch(element)
+	return value, true
+}
+
+// read returns the unexpired value of key from bigcache.
+func (c *MemoryCache) read(key string) (string, bool) {
+	entry, err := c.cache.Get(key)
+	if err != nil || len(entry) < 8 || time.Now().UnixNano() >= int64(binary.BigEndian.Uint64(entry)) {
+		return "", false
+	}
+	return string(entry[8:]), true
 }
 
 // Delete removes a key-value pair from the cache.
-func (c *Cache) Delete(key string) error {
-	return c.cache.Delete(key)
+func (c *MemoryCache) Delete(key string) error {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, found := s.keys[key]; found {
+		c.remove(s, element)
+	}
+	return nil
+}
+
+// DeleteFunc removes every entry whose key satisfies fn and returns how many were removed.
+func (c *MemoryCache) DeleteFunc(fn func(key string) bool) int {
+	removed := 0
+	for _, s := range c.shards {
+		s.mu.Lock()
+		for key, element := range s.keys {
+			if fn(key) {
+				c.remove(s, element)
+				removed++
+			}
+		}
+		s.mu.Unlock()
+	}
+	return removed
+}
+
+// Reset removes every entry from the cache.
+func (c *MemoryCache) Reset() error {
+	for _, s := range c.shards {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.keys = make(map[string]*list.Element)
+		s.lru.Init()
+	}
+	return c.cache.Reset()
+}
+
+// Len returns the number of entries, including expired ones not yet dropped.
+func (c *MemoryCache) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		s.mu.Lock()
+		n += s.lru.Len()
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// Range calls fn for every unexpired entry until fn returns false, one shard at a time.
+// fn must not use the cache.
+func (c *MemoryCache) Range(fn func(key, value string) bool) error {
+	for _, s := range c.shards {
+		s.mu.Lock()
+		for element := s.lru.Front(); element != nil; element = element.Next() {
+			key := element.Value.(*indexEntry).key
+			if value, ok := c.read(key); ok && !fn(key, value) {
+				s.mu.Unlock()
+				return nil
+			}
+		}
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// Capacity returns the entry limit and how many entries were evicted to stay within it.
+func (c *MemoryCache) Capacity() (maxEntries int, evictions int64) {
+	return c.maxEntries, c.evictions.Load()
+}
+
+// Stats returns the counters of the underlying bigcache, including hash collisions. A colliding
+// key overwrites the other entry, which then misses and is dropped from the index.
+func (c *MemoryCache) Stats() bigcache.Stats {
+	return c.cache.Stats()
+}
+
+// entriesSnapshot returns the unexpired entries from the least to the most recently used,
+// so that restoring them in order keeps their recency.
+func (c *MemoryCache) entriesSnapshot() []snapshotEntry {
+	type usedEntry struct {
+		snapshotEntry
+		lastUsed int64
+	}
+	var used []usedEntry
+	now := time.Now()
+	for _, s := range c.shards {
+		s.mu.Lock()
+		for element := s.lru.Back(); element != nil; element = element.Prev() {
+			index := element.Value.(*indexEntry)
+			entry, err := c.cache.Get(index.key)
+			if err != nil || len(entry) < 8 {
+				continue
+			}
+			expireAt := time.Unix(0, int64(binary.BigEndian.Uint64(entry)))
+			if now.Before(expireAt) {
+				used = append(used, usedEntry{snapshotEntry{Key: index.key, Value: string(entry[8:]), ExpireAt: expireAt.UnixMilli()}, index.lastUsed})
+			}
+		}
+		s.mu.Unlock()
+	}
+
+	sort.SliceStable(used, func(i, j int) bool { return used[i].lastUsed < used[j].lastUsed })
+	entries := make([]snapshotEntry, len(used))
+	for i := range used {
+		entries[i] = used[i].snapshotEntry
+	}
+	return entries
+}
+
+// touch marks element as the most recently used entry of its shard. Callers hold s.mu.
+func (s *indexShard) touch(element *list.Element) {
+	element.Value.(*indexEntry).lastUsed = time.Now().UnixNano()
+	s.lru.MoveToFront(element)
 }
 
-// Cleanup clears all expired entries from the cache.
-func (c *Cache) Cleanup() {
-	// bigcache handles cleanup automatically based on the configured LifeWindow.
+// remove drops element from the index and its value from bigcache. Callers hold s.mu.
+func (c *MemoryCache) remove(s *indexShard, element *list.Element) {
+	key := s.lru.Remove(element).(*indexEntry).key
+	delete(s.keys, key)
+	_ = c.cache.Delete(key)
 }
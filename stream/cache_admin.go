@@ -0,0 +1,127 @@
+package stream
+
+import (
+	"Go_Frontend/api"
+	"Go_Frontend/config"
+	"Go_Frontend/library"
+	"Go_Frontend/logger"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/allegro/bigcache"
+)
+
+// CacheInfo describes the path cache for the admin API.
+type CacheInfo struct {
+	Type       string `json:"type"`
+	Entries    int    `json:"entries"`
+	MaxEntries int    `json:"maxEntries,omitempty"` // memory only
+	Evictions  int64  `json:"evictions"`            // memory only: entries dropped to stay within maxEntries
+	Collisions int64  `json:"collisions"`           // memory only: keys that overwrote another key with the same hash
+	CacheStats
+	BigCache *bigcache.Stats `json:"bigcache,omitempty"` // memory only: counters of the underlying bigcache
+}
+
+// CachedPath is a path cache entry as shown by the admin API.
+type CachedPath struct {
+	Key          string    `json:"key"`
+	Missing      bool      `json:"missing,omitempty"` // negative entry: the item or media source does not exist
+	Path         string    `json:"path,omitempty"`
+	Container    string    `json:"container,omitempty"`
+	Size         int64     `json:"size,omitempty"`
+	RunTimeTicks int64     `json:"runTimeTicks,omitempty"`
+	FreshUntil   time.Time `json:"freshUntil"`
+	Stale        bool      `json:"stale"` // expired, only served within the stale windows
+}
+
+// GetCacheInfo returns the size of the path cache and its lookup counters.
+func GetCacheInfo() CacheInfo {
+	info := CacheInfo{Type: cacheTypeRedis, Entries: cache.Len(), CacheStats: GetCacheStats()}
+	if memory, ok := cache.(*MemoryCache); ok {
+		info.Type = cacheTypeMemory
+		info.MaxEntries, info.Evictions = memory.Capacity()
+		stats := memory.Stats()
+		info.Collisions, info.BigCache = stats.Collisions, &stats
+	}
+	return info
+}
+
+// LookupCachedPath returns the cached entry of a media source, including negative and stale entries.
+func LookupCachedPath(server *config.ServerConfig, itemID, mediaSourceID string) (CachedPath, bool) {
+	key := pathCacheKey(server, itemID, mediaSourceID)
+	entry, found := loadPathEntry(key)
+	if !found {
+		return CachedPath{}, false
+	}
+	return newCachedPath(key, entry), true
+}
+
+func newCachedPath(key string, entry *pathEntry) CachedPath {
+	cached := CachedPath{
+		Key:        key,
+		Missing:    entry.Source == nil,
+		FreshUntil: time.UnixMilli(entry.FreshUntil),
+		Stale:      !entry.fresh(time.Now()),
+	}
+	if entry.Source != nil {
+		cached.Path = entry.Source.Path
+		cached.Container = entry.Source.Container
+		cached.Size = entry.Source.Size
+		cached.RunTimeTicks = entry.Source.RunTimeTicks
+	}
+	return cached
+}
+
+// DeleteCachedItem removes every cached media source of an item and returns how many were removed.
+// Unlike InvalidateItem it leaves the library index and access decisions alone.
+func DeleteCachedItem(server *config.ServerConfig, itemID string) int {
+	removed := deleteCachedItems(server, map[string]bool{api.NormalizeID(itemID): true})
+	logger.Info("Removed %d cached paths of item %s on server %s", removed, itemID, server.Name)
+	return removed
+}
+
+// DeleteCachedUnder removes the cached media sources of a server whose path is dir or lies below it.
+func DeleteCachedUnder(server *config.ServerConfig, dir string) (int, error) {
+	keys, err := cachedKeysUnder(server, dir)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, key := range keys {
+		if err := cache.Delete(key); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	logger.Info("Removed %d cached paths under %s on server %s", removed, dir, server.Name)
+	return removed, nil
+}
+
+// cachedKeysUnder returns the path cache keys of a server whose media path is dir or lies below it.
+func cachedKeysUnder(server *config.ServerConfig, dir string) ([]string, error) {
+	dir = strings.TrimRight(dir, `/\`)
+	prefix := serverKey(server, "")
+	var keys []string
+	err := cache.Range(func(key, value string) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return true
+		}
+		var entry pathEntry
+		if json.Unmarshal([]byte(value), &entry) == nil && entry.Source != nil && library.IsUnder(entry.Source.Path, dir) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys, err
+}
+
+// FlushCache removes every entry of the path cache; later requests resolve their paths again.
+func FlushCache() error {
+	if err := cache.Reset(); err != nil {
+		return err
+	}
+	logger.Info("Media path cache flushed")
+	return nil
+}
@@ -0,0 +1,385 @@
+package stream
+
+import (
+	"Go_Frontend/api"
+	"Go_Frontend/config"
+	"Go_Frontend/library"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestRedisCache(t *testing.T) (*RedisCache, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	redisCache, err := NewRedisCache(config.RedisConfig{Addr: server.Addr(), Prefix: "test:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return redisCache, server
+}
+
+func TestCacheImplementations(t *testing.T) {
+	memory := newTestMemoryCache(t, 100)
+	redisCache, _ := newTestRedisCache(t)
+
+	for name, c := range map[string]Cache{"memory": memory, "redis": redisCache} {
+		t.Run(name, func(t *testing.T) {
+			c.Set("family:1:a", "url-1a", time.Minute)
+			c.Set("family:1:b", "url-1b", time.Minute)
+			c.Set("family:2:a", "url-2a", time.Minute)
+
+			if value, found := c.Get("family:1:a"); !found || value != "url-1a" {
+				t.Errorf("Get(family:1:a) = %q, %v", value, found)
+			}
+			if n := c.Len(); n != 3 {
+				t.Errorf("Len = %d, want 3", n)
+			}
+			seen := make(map[string]string)
+			if err := c.Range(func(key, value string) bool {
+				seen[key] = value
+				return true
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if len(seen) != 3 || seen["family:2:a"] != "url-2a" {
+				t.Errorf("Range visited %v", seen)
+			}
+			removed := c.DeleteFunc(func(key string) bool { return strings.HasPrefix(key, "family:1:") })
+			if removed != 2 {
+				t.Errorf("DeleteFunc removed %d entries, want 2", removed)
+			}
+			if _, found := c.Get("family:1:b"); found {
+				t.Error("entry matched by DeleteFunc is still cached")
+			}
+			if err := c.Reset(); err != nil {
+				t.Fatal(err)
+			}
+			if _, found := c.Get("family:2:a"); found {
+				t.Error("entry survived Reset")
+			}
+		})
+	}
+}
+
+func TestCacheEntryTTL(t *testing.T) {
+	memory := newTestMemoryCache(t, 100)
+	memory.Set("short", "url", 20*time.Millisecond)
+	memory.Set("long", "url", time.Minute)
+	time.Sleep(30 * time.Millisecond)
+	if _, found := memory.Get("short"); found {
+		t.Error("memory entry outlived its TTL")
+	}
+	if _, found := memory.Get("long"); !found {
+		t.Error("memory entry expired before its TTL")
+	}
+
+	redisCache, server := newTestRedisCache(t)
+	redisCache.Set("short", "url", time.Second)
+	server.FastForward(2 * time.Second)
+	if _, found := redisCache.Get("short"); found {
+		t.Error("redis entry outlived its TTL")
+	}
+}
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	memory := newTestMemoryCache(t, 2)
+	memory.Set("a", "path-a", time.Minute)
+	memory.Set("b", "path-b", time.Minute)
+	memory.Get("a")
+	memory.Set("c", "path-c", time.Minute)
+
+	if _, found := memory.Get("b"); found {
+		t.Error("least recently used entry was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, found := memory.Get(key); !found {
+			t.Errorf("entry %s was evicted", key)
+		}
+	}
+	if memory.Len() != 2 {
+		t.Errorf("Len = %d, want 2", memory.Len())
+	}
+
+	savedCache := cache
+	cache = memory
+	t.Cleanup(func() { cache = savedCache })
+	info := GetCacheInfo()
+	if info.Type != cacheTypeMemory || info.MaxEntries != 2 || info.Evictions != 1 {
+		t.Errorf("cache info = %+v, want memory cache with 2 entries max and 1 eviction", info)
+	}
+	if info.BigCache == nil || info.BigCache.Hits == 0 || info.Collisions != info.BigCache.Collisions {
+		t.Errorf("cache info does not report the bigcache stats: %+v", info.BigCache)
+	}
+}
+
+func TestMemoryCacheShards(t *testing.T) {
+	// Small caches keep one exact LRU, large ones spread their limit over the shards
+	for _, test := range []struct{ maxEntries, shards int }{{2, 1}, {511, 1}, {1024, 4}, {100000, maxIndexShards}, {0, maxIndexShards}} {
+		memory := newTestMemoryCache(t, test.maxEntries)
+		total := 0
+		for _, s := range memory.shards {
+			total += s.maxEntries
+		}
+		if len(memory.shards) != test.shards || total != test.maxEntries {
+			t.Errorf("maxEntries %d: %d shards holding %d entries, want %d shards", test.maxEntries, len(memory.shards), total, test.shards)
+		}
+	}
+
+	memory := newTestMemoryCache(t, 1024)
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := fmt.Sprintf("family:%d:%d", worker, i)
+				memory.Set(key, "path", time.Minute)
+				memory.Get(key)
+			}
+		}()
+	}
+	wg.Wait()
+
+	_, evictions := memory.Capacity()
+	if n := memory.Len(); n > 1024 || int64(n)+evictions != 4000 {
+		t.Errorf("Len = %d with %d evictions after 4000 distinct keys, limit 1024", n, evictions)
+	}
+	// Recently used keys survive: 256 keys cannot fill any of the four shards of 256 entries
+	for i := 0; i < 256; i++ {
+		memory.Set(fmt.Sprintf("recent:%d", i), "path", time.Minute)
+	}
+	for i := 0; i < 256; i++ {
+		if _, found := memory.Get(fmt.Sprintf("recent:%d", i)); !found {
+			t.Fatalf("recently used key %d was evicted", i)
+		}
+	}
+
+	// Snapshots order the entries of all shards by recency
+	entries := memory.entriesSnapshot()
+	if len(entries) != memory.Len() {
+		t.Errorf("snapshot has %d entries, cache %d", len(entries), memory.Len())
+	}
+	recent := entries[len(entries)-256:]
+	for i := range recent {
+		if want := fmt.Sprintf("recent:%d", i); recent[i].Key != want {
+			t.Fatalf("snapshot entry %d from the end is %q, want %q", 256-i, recent[i].Key, want)
+		}
+	}
+}
+
+func TestMediaSourceRoundTrip(t *testing.T) {
+	savedCache := cache
+	cache = newTestMemoryCache(t, 10)
+	t.Cleanup(func() { cache = savedCache })
+
+	storeMediaSource("family:1:a", &api.MediaSourceInfo{ID: "a", Path: "/mnt/gd/movie.mkv", Container: "mkv", Size: 1024, RunTimeTicks: 600})
+	entry, found := loadPathEntry("family:1:a")
+	if !found || !entry.fresh(time.Now()) {
+		t.Fatal("stored media source was not found")
+	}
+	media := entry.media("a")
+	want := api.MediaSourceInfo{ID: "a", Path: "/mnt/gd/movie.mkv", Container: "mkv", Size: 1024, RunTimeTicks: 600}
+	if media.ID != want.ID || media.Path != want.Path || media.Container != want.Container || media.Size != want.Size || media.RunTimeTicks != want.RunTimeTicks {
+		t.Errorf("media = %+v, want %+v", *media, want)
+	}
+
+	cache.Set("family:1:b", "not json", time.Minute)
+	if _, found := loadPathEntry("family:1:b"); found {
+		t.Error("unreadable entry was returned")
+	}
+	if _, found := cache.Get("family:1:b"); found {
+		t.Error("unreadable entry was not dropped")
+	}
+}
+
+// TestFetchMediaSourceFromCache covers negative caching, stale-while-revalidate and stale-if-error
+// against a fake Emby whose answer is switched between steps.
+func TestFetchMediaSourceFromCache(t *testing.T) {
+	var status atomic.Int32
+	var requests atomic.Int32
+	status.Store(http.StatusNotFound)
+	emby := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if code := int(status.Load()); code != http.StatusOK {
+			w.WriteHeader(code)
+			return
+		}
+		w.Write([]byte(`{"MediaSources": [{"Id": "a", "Path": "/mnt/gd/new.mkv"}]}`))
+	}))
+	t.Cleanup(emby.Close)
+
+	savedCache, savedTTL, savedNegative, savedSWR, savedSIE := cache, cacheTTL, negativeTTL, staleWhileRevalidate, staleIfError
+	t.Cleanup(func() {
+		cache, cacheTTL, negativeTTL, staleWhileRevalidate, staleIfError = savedCache, savedTTL, savedNegative, savedSWR, savedSIE
+	})
+	cache, cacheTTL, negativeTTL = newTestMemoryCache(t, 10), time.Hour, time.Minute
+	savedRetries := config.GetConfig().EmbyClient.Retries
+	config.GetConfig().EmbyClient.Retries = 0
+	t.Cleanup(func() { config.GetConfig().EmbyClient.Retries = savedRetries })
+
+	server := &config.ServerConfig{Name: "test", Type: config.ServerTypeEmby, URL: emby.URL}
+	ctx := context.Background()
+
+	// A deleted item is looked up once, then answered from the negative cache
+	for range 3 {
+		if _, err := fetchMediaSource(ctx, server, "1", "a"); !errors.Is(err, api.ErrNotFound) {
+			t.Fatalf("fetchMediaSource error = %v, want ErrNotFound", err)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Emby was asked %d times for a missing item, want 1", n)
+	}
+
+	// An expired path is served while the media server is failing
+	staleIfError = time.Hour
+	expired := func() {
+		storePathEntry("test:2:a", &pathEntry{
+			Source:     &library.Source{Path: "/mnt/gd/old.mkv"},
+			FreshUntil: time.Now().Add(-time.Minute).UnixMilli(),
+		}, time.Hour)
+	}
+	expired()
+	status.Store(http.StatusInternalServerError)
+	media, err := fetchMediaSource(ctx, server, "2", "a")
+	if err != nil || media.Path != "/mnt/gd/old.mkv" {
+		t.Errorf("stale-if-error: fetchMediaSource = %+v, %v", media, err)
+	}
+
+	// Within stale-while-revalidate the old path is served at once and refreshed in the background
+	staleWhileRevalidate = time.Hour
+	status.Store(http.StatusOK)
+	expired()
+	before := GetCacheStats().StaleServed
+	media, err = fetchMediaSource(ctx, server, "2", "a")
+	if err != nil || media.Path != "/mnt/gd/old.mkv" {
+		t.Errorf("stale-while-revalidate: fetchMediaSource = %+v, %v", media, err)
+	}
+	if GetCacheStats().StaleServed != before+1 {
+		t.Error("stale path was not counted")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if entry, _ := loadPathEntry("test:2:a"); entry != nil && entry.fresh(time.Now()) && entry.Source.Path == "/mnt/gd/new.mkv" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stale path was not revalidated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDeleteCachedUnder(t *testing.T) {
+	savedCache := cache
+	cache = newTestMemoryCache(t, 10)
+	t.Cleanup(func() { cache = savedCache })
+
+	family := &config.ServerConfig{Name: "family"}
+	storeMediaSource("family:1:a", &api.MediaSourceInfo{Path: "/mnt/gd/Movies/A.mkv"})
+	storeMediaSource("family:2:a", &api.MediaSourceInfo{Path: "/mnt/gd2/Movies/B.mkv"})
+	storeMediaSource("friends:3:a", &api.MediaSourceInfo{Path: "/mnt/gd/Movies/C.mkv"})
+	storeMissing("family:4:a")
+
+	removed, err := DeleteCachedUnder(family, "/mnt/gd/")
+	if err != nil || removed != 1 {
+		t.Fatalf("DeleteCachedUnder = %d, %v, want 1", removed, err)
+	}
+	if _, found := LookupCachedPath(family, "1", "a"); found {
+		t.Error("path under the prefix is still cached")
+	}
+	if cached, found := LookupCachedPath(family, "2", "a"); !found || cached.Path != "/mnt/gd2/Movies/B.mkv" {
+		t.Errorf("sibling directory was removed: %+v", cached)
+	}
+	if _, found := LookupCachedPath(&config.ServerConfig{Name: "friends"}, "3", "a"); !found {
+		t.Error("path of another server was removed")
+	}
+	if cached, found := LookupCachedPath(family, "4", "a"); !found || !cached.Missing {
+		t.Errorf("negative entry = %+v, %v", cached, found)
+	}
+}
+
+func TestRedisLock(t *testing.T) {
+	redisCache, server := newTestRedisCache(t)
+
+	unlock, ok, err := redisCache.TryLock("family:1:a", time.Second)
+	if err != nil || !ok {
+		t.Fatalf("TryLock = %v, %v", ok, err)
+	}
+	if _, ok, _ := redisCache.TryLock("family:1:a", time.Second); ok {
+		t.Fatal("a held lock was acquired twice")
+	}
+
+	// An expired lock taken over by another holder must not be released by the first one
+	server.FastForward(2 * time.Second)
+	unlock2, ok, _ := redisCache.TryLock("family:1:a", time.Second)
+	if !ok {
+		t.Fatal("expired lock could not be acquired")
+	}
+	unlock()
+	if _, ok, _ := redisCache.TryLock("family:1:a", time.Second); ok {
+		t.Error("a stale holder released the lock of the next holder")
+	}
+	unlock2()
+	if _, ok, _ := redisCache.TryLock("family:1:a", time.Second); !ok {
+		t.Error("lock was not released")
+	}
+
+	// Locks are not cache entries
+	if removed := redisCache.DeleteFunc(func(string) bool { return true }); removed != 0 {
+		t.Errorf("DeleteFunc removed %d locks", removed)
+	}
+}
+
+func TestLockResolveWaitsForPeer(t *testing.T) {
+	redisCache, _ := newTestRedisCache(t)
+	savedCache, savedLocker, savedTimeout := cache, locker, lockTimeout
+	cache, locker, lockTimeout = redisCache, redisCache, time.Second
+	t.Cleanup(func() { cache, locker, lockTimeout = savedCache, savedLocker, savedTimeout })
+
+	// Another instance holds the lock and publishes the path shortly after
+	peerUnlock, ok, _ := redisCache.TryLock("family:1:a", time.Second)
+	if !ok {
+		t.Fatal("peer could not lock")
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		storeMediaSource("family:1:a", &api.MediaSourceInfo{ID: "a", Path: "/mnt/gd/movie.mkv"})
+		peerUnlock()
+	}()
+
+	entry, release := lockResolve(context.Background(), "family:1:a")
+	release()
+	if entry == nil || entry.Source == nil || entry.Source.Path != "/mnt/gd/movie.mkv" {
+		t.Errorf("lockResolve = %+v, want the path resolved by the peer", entry)
+	}
+
+	// Nobody holds the lock: the caller resolves the item itself while holding it
+	entry, release = lockResolve(context.Background(), "family:2:a")
+	if entry != nil {
+		t.Errorf("lockResolve = %+v for an uncached item", entry)
+	}
+	if _, ok, _ := redisCache.TryLock("family:2:a", time.Second); ok {
+		t.Error("lockResolve returned without holding the lock")
+	}
+	release()
+}
+
+// newTestMemoryCache returns a memory cache whose entries may live up to an hour.
+func newTestMemoryCache(t *testing.T, maxEntries int) *MemoryCache {
+	t.Helper()
+	memory, err := NewMemoryCache(maxEntries, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return memory
+}
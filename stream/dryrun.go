@@ -0,0 +1,118 @@
+package stream
+
+import (
+	"Go_Frontend/api"
+	"Go_Frontend/config"
+	"Go_Frontend/geoip"
+	"Go_Frontend/library"
+	"Go_Frontend/route"
+	"Go_Frontend/strm"
+	"context"
+	"fmt"
+	"time"
+)
+
+// RouteReport describes how a request would be routed and signed, without redirecting or caching.
+type RouteReport struct {
+	Server        string `json:"server"`
+	ItemID        string `json:"itemId,omitempty"`
+	MediaSourceID string `json:"mediaSourceId,omitempty"`
+	MediaPath     string `json:"mediaPath"`
+	PathSource    string `json:"pathSource,omitempty"` // where the path came from: request, index, cache or server
+	route.Explanation
+	Strm       *strm.Decision         `json:"strm,omitempty"`
+	BackendURL string                 `json:"backendUrl,omitempty"`
+	Client     string                 `json:"client,omitempty"`
+	SignedURL  string                 `json:"signedUrl,omitempty"`
+	Hints      map[string]interface{} `json:"hints,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// DryRun routes mediaPath, or the path server reports for itemID/mediaSourceID when mediaPath is empty,
+// and returns every step of the decision. location selects the backend mirror as it would for a client.
+func DryRun(ctx context.Context, server *config.ServerConfig, itemID, mediaSourceID, mediaPath string, location geoip.Location) RouteReport {
+	report := RouteReport{Server: server.Name, ItemID: itemID, MediaSourceID: mediaSourceID, MediaPath: mediaPath}
+	if location.IP != "" {
+		report.Client = location.String()
+	}
+
+	media := &api.MediaSourceInfo{ID: mediaSourceID, Path: mediaPath}
+	report.PathSource = "request"
+	if mediaPath == "" {
+		var err error
+		media, report.PathSource, err = peekMediaSource(ctx, server, itemID, mediaSourceID)
+		if err != nil {
+			report.Error = "media server lookup failed: " + err.Error()
+			return report
+		}
+		report.MediaPath = media.Path
+	}
+	report.Hints = signedHints(media)
+
+	if strm.IsRemote(media.Path) {
+		return dryRunRemote(report, server, location)
+	}
+
+	report.Explanation = route.GetRegistry(server.Name).Explain(media.Path)
+	if !report.Matched {
+		report.Error = "no matching backend configuration"
+		return report
+	}
+
+	report.BackendURL = geoip.ResolveURL(report.Backend, location)
+	signedURL, err := signStreamingURL(report.BackendURL, report.RelativePath, itemID, mediaSourceID, report.Hints)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	report.SignedURL = signedURL
+	return report
+}
+
+// peekMediaSource looks a media source up like fetchMediaSource, but leaves no trace: the path cache
+// is only read, nothing is stored on a miss, no lookup is counted and no lock is taken.
+func peekMediaSource(ctx context.Context, server *config.ServerConfig, itemID, mediaSourceID string) (*api.MediaSourceInfo, string, error) {
+	if media, ok := library.Lookup(server.Name, itemID, mediaSourceID); ok {
+		return media, "index", nil
+	}
+	if entry, found := loadPathEntry(pathCacheKey(server, itemID, mediaSourceID)); found && entry.fresh(time.Now()) {
+		if entry.Source == nil {
+			return nil, "cache", fmt.Errorf("item %s: %w (cached)", itemID, api.ErrMediaSourceNotFound)
+		}
+		return entry.media(mediaSourceID), "cache", nil
+	}
+	media, err := api.NewMediaServer(server).GetMediaSource(ctx, itemID, mediaSourceID)
+	return media, "server", err
+}
+
+// dryRunRemote reports how an STRM url would be rewritten onto a backend or redirected.
+func dryRunRemote(report RouteReport, server *config.ServerConfig, location geoip.Location) RouteReport {
+	expireAt := time.Now().Unix() + int64(config.GetConfig().PlayURLMaxAliveTime)
+	decision, err := strm.Resolve(report.MediaPath, expireAt)
+	report.Strm = &decision
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	if decision.Backend == "" {
+		report.SignedURL = decision.URL
+		return report
+	}
+
+	backend, err := route.GetRegistry(server.Name).Get(decision.Backend)
+	if err != nil || backend.Disabled {
+		report.Error = "backend " + decision.Backend + " is not available"
+		return report
+	}
+	report.Backend = backend
+	report.RelativePath = decision.RelativePath
+	report.Matched = true
+	report.BackendURL = geoip.ResolveURL(backend, location)
+	signedURL, err := signStreamingURL(report.BackendURL, report.RelativePath, report.ItemID, report.MediaSourceID, report.Hints)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	report.SignedURL = signedURL
+	return report
+}
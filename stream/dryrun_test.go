@@ -0,0 +1,92 @@
+package stream
+
+import (
+	"Go_Frontend/api"
+	"Go_Frontend/config"
+	"Go_Frontend/geoip"
+	"Go_Frontend/route"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDryRun(t *testing.T) {
+	var requests atomic.Int32
+	emby := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/Items/1/PlaybackInfo" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"MediaSources": [{"Id": "a", "Path": "/mnt/gd/Movies/Movie.mkv"}]}`))
+	}))
+	t.Cleanup(emby.Close)
+
+	if err := InitializeSignature("vPQC5LWCN2CW2opz"); err != nil {
+		t.Fatal(err)
+	}
+	server := config.ServerConfig{
+		Name:     "dryrun",
+		Type:     config.ServerTypeEmby,
+		URL:      emby.URL,
+		Backends: []config.BackendConfig{{Name: "gd", URL: "https://gd.example.com/stream", Path: "/mnt/gd"}},
+	}
+	if err := route.Load([]config.ServerConfig{server}, ""); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { route.Load(config.GetConfig().Servers, "") })
+
+	savedCache, savedTTL, savedNegative := cache, cacheTTL, negativeTTL
+	t.Cleanup(func() { cache, cacheTTL, negativeTTL = savedCache, savedTTL, savedNegative })
+	cache, cacheTTL, negativeTTL = newTestMemoryCache(t, 10), time.Hour, time.Minute
+	savedRetries := config.GetConfig().EmbyClient.Retries
+	config.GetConfig().EmbyClient.Retries = 0
+	t.Cleanup(func() { config.GetConfig().EmbyClient.Retries = savedRetries })
+	ctx := context.Background()
+
+	// A path given directly is routed without asking the media server
+	report := DryRun(ctx, &server, "", "", "/mnt/gd/Movies/Movie.mkv", geoip.Location{})
+	if report.Error != "" || report.Backend.Name != "gd" || report.RelativePath != "Movies/Movie.mkv" ||
+		!strings.HasPrefix(report.SignedURL, "https://gd.example.com/stream?") || report.PathSource != "request" {
+		t.Errorf("DryRun by path = %+v", report)
+	}
+	if report = DryRun(ctx, &server, "", "", "/srv/Movie.mkv", geoip.Location{}); report.Matched || report.Error == "" {
+		t.Errorf("unroutable path: %+v", report)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("DryRun by path made %d requests", n)
+	}
+
+	// Looking up an item leaves the path cache and its counters untouched
+	stats := GetCacheStats()
+	for range 2 {
+		report = DryRun(ctx, &server, "1", "a", "", geoip.Location{})
+		if report.Error != "" || report.MediaPath != "/mnt/gd/Movies/Movie.mkv" || report.PathSource != "server" || report.SignedURL == "" {
+			t.Errorf("DryRun by item = %+v", report)
+		}
+		if report = DryRun(ctx, &server, "2", "a", "", geoip.Location{}); !strings.HasPrefix(report.Error, "media server lookup failed: ") {
+			t.Errorf("missing item: %+v", report)
+		}
+	}
+	if n := requests.Load(); n != 4 {
+		t.Errorf("media server was asked %d times, want 4 (nothing cached)", n)
+	}
+	if n := cache.Len(); n != 0 {
+		t.Errorf("DryRun stored %d path cache entries", n)
+	}
+	if GetCacheStats() != stats {
+		t.Errorf("DryRun changed the cache stats: %+v, was %+v", GetCacheStats(), stats)
+	}
+
+	// A cached path is used without asking the media server
+	storeMediaSource(pathCacheKey(&server, "3", "a"), &api.MediaSourceInfo{ID: "a", Path: "/mnt/gd/Shows/S01E01.mkv"})
+	before := requests.Load()
+	report = DryRun(ctx, &server, "3", "a", "", geoip.Location{})
+	if report.PathSource != "cache" || report.MediaPath != "/mnt/gd/Shows/S01E01.mkv" || requests.Load() != before {
+		t.Errorf("DryRun of a cached item = %+v", report)
+	}
+}
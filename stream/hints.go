@@ -0,0 +1,95 @@
+package stream
+
+import (
+	"Go_Frontend/api"
+	"fmt"
+	"mime"
+)
+
+// 可以写入签名的媒体信息，后端据此设置 Content-Type / Content-Length，远程存储上不必再 stat 文件
+const (
+	hintSize      = "size"      // 文件大小，字节
+	hintContainer = "container" // 容器，如 mkv
+	hintMIME      = "mime"      // 由容器推断的 MIME 类型
+	hintDuration  = "duration"  // 时长，秒
+)
+
+// enabledHints 为配置的 Hints，只在启动时写入
+var enabledHints []string
+
+// containerMIME 补充 mime 包不认识或与播放器习惯不一致的容器
+var containerMIME = map[string]string{
+	"mkv":    "video/x-matroska",
+	"mk3d":   "video/x-matroska",
+	"mka":    "audio/x-matroska",
+	"mp4":    "video/mp4",
+	"m4v":    "video/mp4",
+	"mov":    "video/quicktime",
+	"webm":   "video/webm",
+	"avi":    "video/x-msvideo",
+	"ts":     "video/mp2t",
+	"m2ts":   "video/mp2t",
+	"mpegts": "video/mp2t",
+	"flv":    "video/x-flv",
+	"wmv":    "video/x-ms-wmv",
+	"mp3":    "audio/mpeg",
+	"flac":   "audio/flac",
+	"m4a":    "audio/mp4",
+	"aac":    "audio/aac",
+	"ogg":    "audio/ogg",
+	"opus":   "audio/opus",
+	"wav":    "audio/wav",
+}
+
+// InitializeHints checks and applies the media hints written into signatures.
+func InitializeHints(hints []string) error {
+	for _, hint := range hints {
+		switch hint {
+		case hintSize, hintContainer, hintMIME, hintDuration:
+		default:
+			return fmt.Errorf("unknown hint %q", hint)
+		}
+	}
+	enabledHints = hints
+	return nil
+}
+
+// signedHints 返回写入签名的媒体信息，未知的值 (如特殊媒体没有元数据) 不写入
+func signedHints(media *api.MediaSourceInfo) map[string]interface{} {
+	if len(enabledHints) == 0 || media == nil {
+		return nil
+	}
+	hints := make(map[string]interface{}, len(enabledHints))
+	container := media.PrimaryContainer()
+	for _, hint := range enabledHints {
+		switch hint {
+		case hintSize:
+			if media.Size > 0 {
+				hints[hintSize] = media.Size
+			}
+		case hintContainer:
+			if container != "" {
+				hints[hintContainer] = container
+			}
+		case hintMIME:
+			if mimeType := containerMIMEType(container); mimeType != "" {
+				hints[hintMIME] = mimeType
+			}
+		case hintDuration:
+			if duration := media.Duration(); duration > 0 {
+				hints[hintDuration] = duration.Seconds()
+			}
+		}
+	}
+	return hints
+}
+
+func containerMIMEType(container string) string {
+	if container == "" {
+		return ""
+	}
+	if mimeType, ok := containerMIME[container]; ok {
+		return mimeType
+	}
+	return mime.TypeByExtension("." + container)
+}
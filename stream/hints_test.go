@@ -0,0 +1,43 @@
+package stream
+
+import (
+	"Go_Frontend/api"
+	"testing"
+)
+
+func TestSignedHints(t *testing.T) {
+	if err := InitializeHints([]string{"size", "bogus"}); err == nil {
+		t.Error("InitializeHints accepted an unknown hint")
+	}
+	if err := InitializeHints([]string{"size", "container", "mime", "duration"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { enabledHints = nil })
+
+	media := &api.MediaSourceInfo{Container: "mkv,webm", Size: 8231459871, RunTimeTicks: 26404170000}
+	hints := signedHints(media)
+	if hints["size"] != int64(8231459871) || hints["container"] != "mkv" ||
+		hints["mime"] != "video/x-matroska" || hints["duration"] != 2640.417 {
+		t.Errorf("signedHints = %v", hints)
+	}
+
+	// Special medias have no metadata; nothing unknown is claimed
+	if hints := signedHints(&api.MediaSourceInfo{Path: "specialMedia/x"}); len(hints) != 0 {
+		t.Errorf("signedHints without metadata = %v", hints)
+	}
+}
+
+func TestEncryptWithClaims(t *testing.T) {
+	s := &Signature{key: []byte("vPQC5LWCN2CW2opz")}
+	signature, err := s.EncryptWithClaims("item", "source", 4102444800, map[string]interface{}{"size": int64(42), "itemId": "forged"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := s.Decrypt(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["itemId"] != "item" || data["mediaId"] != "source" || data["size"] != float64(42) {
+		t.Errorf("decrypted claims = %v", data)
+	}
+}
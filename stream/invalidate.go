@@ -0,0 +1,82 @@
+package stream
+
+import (
+	"Go_Frontend/api"
+	"Go_Frontend/config"
+	"Go_Frontend/library"
+	"Go_Frontend/logger"
+	"strings"
+)
+
+// Invalidation 记录一次失效操作清除的内容
+type Invalidation struct {
+	Items        []string `json:"items"`        // 失效的条目 ID (已规范化)
+	IndexEntries int      `json:"indexEntries"` // 从媒体库索引中删除的条目数
+	CacheEntries int      `json:"cacheEntries"` // 删除的路径缓存数
+}
+
+// InvalidateItem 清除条目的路径缓存和索引记录。itemPath 非空时 (文件夹、剧集等)，
+// 索引或路径缓存中媒体路径位于其下的条目一并清除
+func InvalidateItem(server *config.ServerConfig, itemID, itemPath string) Invalidation {
+	var result Invalidation
+	items := make(map[string]bool)
+	if itemID != "" {
+		items[api.NormalizeID(itemID)] = true
+		if library.Remove(server.Name, itemID) {
+			result.IndexEntries++
+		}
+	}
+	if itemPath != "" {
+		for _, id := range library.RemoveUnder(server.Name, itemPath) {
+			items[id] = true
+			result.IndexEntries++
+		}
+		// 未启用索引时 (或条目在索引同步后才被缓存)，从路径缓存中找出位于其下的条目
+		keys, err := cachedKeysUnder(server, itemPath)
+		if err != nil {
+			logger.Warn("Failed to scan the path cache under %s: %v", itemPath, err)
+		}
+		for _, key := range keys {
+			id, _, _ := strings.Cut(strings.TrimPrefix(key, serverKey(server, "")), ":")
+			items[api.NormalizeID(id)] = true
+		}
+	}
+	if len(items) == 0 {
+		return result
+	}
+
+	result.CacheEntries = deleteCachedItems(server, items)
+	prefix := serverKey(server, "")
+
+	// 条目的分级或所属媒体库可能已变化，丢弃 "server:userID:itemID" 形式的权限判定
+	itemAccessCache.DeleteFunc(func(key string, _ accessDecision) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return false
+		}
+		return items[key[strings.LastIndexByte(key, ':')+1:]]
+	})
+
+	mediaSourcesCache.DeleteFunc(func(key string, _ []api.MediaSourceInfo) bool {
+		rest, ok := strings.CutPrefix(key, prefix)
+		return ok && items[rest]
+	})
+
+	for id := range items {
+		result.Items = append(result.Items, id)
+	}
+	return result
+}
+
+// deleteCachedItems 删除路径缓存中属于 items (已规范化的条目 ID) 的所有媒体源
+func deleteCachedItems(server *config.ServerConfig, items map[string]bool) int {
+	// 缓存键形如 "server:itemID:mediaSourceID"
+	prefix := serverKey(server, "")
+	return cache.DeleteFunc(func(key string) bool {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			return false
+		}
+		itemID, _, _ := strings.Cut(rest, ":")
+		return items[api.NormalizeID(itemID)]
+	})
+}
@@ -0,0 +1,159 @@
+package stream
+
+import (
+	"Go_Frontend/api"
+	"Go_Frontend/config"
+	"Go_Frontend/util"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// seedInvalidationCaches fills the path, media source, access, auth and policy caches
+// with entries for two servers, two users and two items.
+func seedInvalidationCaches(t *testing.T) (family, friends *config.ServerConfig) {
+	t.Helper()
+	savedCache := cache
+	savedAuth, savedPolicies, savedAccess, savedSources := authCache, policyCache, itemAccessCache, mediaSourcesCache
+	t.Cleanup(func() {
+		cache = savedCache
+		authCache, policyCache, itemAccessCache, mediaSourcesCache = savedAuth, savedPolicies, savedAccess, savedSources
+	})
+	cache = newTestMemoryCache(t, 100)
+	authCache = util.NewTTLCache[*api.User](time.Hour)
+	policyCache = util.NewTTLCache[api.UserPolicy](time.Hour)
+	itemAccessCache = util.NewTTLCache[accessDecision](time.Hour)
+	mediaSourcesCache = util.NewTTLCache[[]api.MediaSourceInfo](time.Hour)
+
+	family, friends = &config.ServerConfig{Name: "family"}, &config.ServerConfig{Name: "friends"}
+	for _, server := range []*config.ServerConfig{family, friends} {
+		for _, itemID := range []string{"Item-1", "item2"} {
+			for _, mediaSourceID := range []string{"a", "b"} {
+				storeMediaSource(pathCacheKey(server, itemID, mediaSourceID), &api.MediaSourceInfo{Path: "/mnt/gd/" + itemID})
+			}
+			mediaSourcesCache.Set(serverKey(server, api.NormalizeID(itemID)), []api.MediaSourceInfo{{ID: "a"}})
+		}
+		for _, userID := range []string{"u1", "u2"} {
+			authCache.Set(serverKey(server, "token-"+userID), &api.User{ID: userID})
+			policyCache.Set(serverKey(server, userID), api.UserPolicy{})
+			for _, itemID := range []string{"item1", "item2"} {
+				itemAccessCache.Set(serverKey(server, userID+":"+itemID), accessDecision{allowed: true})
+			}
+		}
+	}
+	return family, friends
+}
+
+// cachedKeys returns which of keys are still in each cache.
+func cachedKeys(keys []string) map[string][]string {
+	found := make(map[string][]string)
+	for _, key := range keys {
+		if _, ok := cache.Get(key); ok {
+			found["path"] = append(found["path"], key)
+		}
+		if _, ok := mediaSourcesCache.Get(key); ok {
+			found["sources"] = append(found["sources"], key)
+		}
+		if _, ok := itemAccessCache.Get(key); ok {
+			found["access"] = append(found["access"], key)
+		}
+		if _, ok := authCache.Get(key); ok {
+			found["auth"] = append(found["auth"], key)
+		}
+		if _, ok := policyCache.Get(key); ok {
+			found["policy"] = append(found["policy"], key)
+		}
+	}
+	for _, list := range found {
+		sort.Strings(list)
+	}
+	return found
+}
+
+// allKeys lists every key seeded by seedInvalidationCaches.
+func allKeys() []string {
+	var keys []string
+	for _, server := range []string{"family", "friends"} {
+		for _, itemID := range []string{"Item-1", "item2"} {
+			keys = append(keys, server+":"+itemID+":a", server+":"+itemID+":b", server+":"+api.NormalizeID(itemID))
+		}
+		for _, userID := range []string{"u1", "u2"} {
+			keys = append(keys, server+":token-"+userID, server+":"+userID, server+":"+userID+":item1", server+":"+userID+":item2")
+		}
+	}
+	return keys
+}
+
+func TestInvalidateItem(t *testing.T) {
+	family, _ := seedInvalidationCaches(t)
+
+	// The ID is matched however the webhook spells it
+	result := InvalidateItem(family, "ITEM1", "")
+	if !reflect.DeepEqual(result.Items, []string{"item1"}) || result.CacheEntries != 2 || result.IndexEntries != 0 {
+		t.Errorf("InvalidateItem = %+v", result)
+	}
+
+	want := map[string][]string{
+		"path": {"family:item2:a", "family:item2:b",
+			"friends:Item-1:a", "friends:Item-1:b", "friends:item2:a", "friends:item2:b"},
+		"sources": {"family:item2", "friends:item1", "friends:item2"},
+		"access": {"family:u1:item2", "family:u2:item2",
+			"friends:u1:item1", "friends:u1:item2", "friends:u2:item1", "friends:u2:item2"},
+		"auth":   {"family:token-u1", "family:token-u2", "friends:token-u1", "friends:token-u2"},
+		"policy": {"family:u1", "family:u2", "friends:u1", "friends:u2"},
+	}
+	if got := cachedKeys(allKeys()); !reflect.DeepEqual(got, want) {
+		t.Errorf("after InvalidateItem:\n got %v\nwant %v", got, want)
+	}
+
+	if result := InvalidateItem(family, "", ""); result.CacheEntries != 0 || len(result.Items) != 0 {
+		t.Errorf("InvalidateItem without an item = %+v", result)
+	}
+}
+
+func TestInvalidateUser(t *testing.T) {
+	_, friends := seedInvalidationCaches(t)
+
+	// One session and two access decisions
+	if removed := InvalidateUser(friends, "u1"); removed != 3 {
+		t.Errorf("InvalidateUser removed %d entries, want 3", removed)
+	}
+
+	want := map[string][]string{
+		"path": {"family:Item-1:a", "family:Item-1:b", "family:item2:a", "family:item2:b",
+			"friends:Item-1:a", "friends:Item-1:b", "friends:item2:a", "friends:item2:b"},
+		"sources": {"family:item1", "family:item2", "friends:item1", "friends:item2"},
+		"access": {"family:u1:item1", "family:u1:item2", "family:u2:item1", "family:u2:item2",
+			"friends:u2:item1", "friends:u2:item2"},
+		"auth":   {"family:token-u1", "family:token-u2", "friends:token-u2"},
+		"policy": {"family:u1", "family:u2", "friends:u2"},
+	}
+	if got := cachedKeys(allKeys()); !reflect.DeepEqual(got, want) {
+		t.Errorf("after InvalidateUser:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestInvalidateItemUnderPath(t *testing.T) {
+	family, _ := seedInvalidationCaches(t)
+
+	// Without the library index the items under a folder are found in the path cache
+	result := InvalidateItem(family, "folder", "/mnt/gd/Item-1/")
+	sort.Strings(result.Items)
+	if !reflect.DeepEqual(result.Items, []string{"folder", "item1"}) || result.CacheEntries != 2 || result.IndexEntries != 0 {
+		t.Errorf("InvalidateItem = %+v", result)
+	}
+
+	want := map[string][]string{
+		"path": {"family:item2:a", "family:item2:b",
+			"friends:Item-1:a", "friends:Item-1:b", "friends:item2:a", "friends:item2:b"},
+		"sources": {"family:item2", "friends:item1", "friends:item2"},
+		"access": {"family:u1:item2", "family:u2:item2",
+			"friends:u1:item1", "friends:u1:item2", "friends:u2:item1", "friends:u2:item2"},
+		"auth":   {"family:token-u1", "family:token-u2", "friends:token-u1", "friends:token-u2"},
+		"policy": {"family:u1", "family:u2", "friends:u1", "friends:u2"},
+	}
+	if got := cachedKeys(allKeys()); !reflect.DeepEqual(got, want) {
+		t.Errorf("after InvalidateItem under a path:\n got %v\nwant %v", got, want)
+	}
+}
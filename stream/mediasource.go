@@ -0,0 +1,133 @@
+package stream
+
+import (
+	"Go_Frontend/api"
+	"Go_Frontend/config"
+	"Go_Frontend/logger"
+	"Go_Frontend/util"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 未指定 MediaSourceId 时的选择策略
+const (
+	sourcePolicyFirst      = "first"
+	sourcePolicyBitrate    = "bitrate"
+	sourcePolicyContainer  = "container"
+	sourcePolicyMaxBitrate = "maxBitrate"
+)
+
+// mediaSourcesCache 以 "server:itemID" 为键缓存条目的媒体源列表，脚本反复请求同一条目时不必每次查询
+var mediaSourcesCache = util.NewTTLCache[[]api.MediaSourceInfo](5 * time.Minute)
+
+// InitializeMediaSource checks the configured media source selection policy.
+// Policies are matched case-insensitively, like the other config values.
+func InitializeMediaSource(cfg config.MediaSourceConfig) error {
+	if _, ok := canonicalSourcePolicy(cfg.Policy); !ok {
+		return fmt.Errorf("unknown MediaSource policy %q", cfg.Policy)
+	}
+	return nil
+}
+
+// canonicalSourcePolicy 不区分大小写匹配策略名，返回对应的常量；空值为 first
+func canonicalSourcePolicy(policy string) (string, bool) {
+	policy = strings.TrimSpace(policy)
+	if policy == "" {
+		return sourcePolicyFirst, true
+	}
+	for _, known := range []string{sourcePolicyFirst, sourcePolicyBitrate, sourcePolicyContainer, sourcePolicyMaxBitrate} {
+		if strings.EqualFold(policy, known) {
+			return known, true
+		}
+	}
+	return "", false
+}
+
+// defaultMediaSource 为未带 MediaSourceId 的请求按配置的策略选择媒体源
+func defaultMediaSource(c *gin.Context, server *config.ServerConfig, itemID string) (string, error) {
+	key := serverKey(server, api.NormalizeID(itemID))
+	sources, found := mediaSourcesCache.Get(key)
+	if !found {
+		v, err := sharedCall(c.Request.Context(), "ms:"+key, func(ctx context.Context) (interface{}, error) {
+			return api.NewMediaServer(server).GetMediaSources(ctx, itemID)
+		})
+		if err != nil {
+			return "", err
+		}
+		sources = v.([]api.MediaSourceInfo)
+		mediaSourcesCache.Set(key, sources)
+	}
+
+	maxBitrate, _ := strconv.ParseInt(queryParam(c, "MaxStreamingBitrate"), 10, 64)
+	source, ok := selectMediaSource(sources, config.GetConfig().MediaSource.Policy, c.Param("type"), maxBitrate)
+	if !ok {
+		return "", errors.New("item has no media sources")
+	}
+	logger.Info("Selected media source %s (%s, %d bps) of item %s", source.ID, source.Container, source.Bitrate, itemID)
+	return source.ID, nil
+}
+
+// selectMediaSource 按策略选择媒体源，没有符合条件的媒体源时退回第一个。
+// container 为请求的扩展名，maxBitrate 为客户端的 MaxStreamingBitrate，0 表示未指定
+func selectMediaSource(sources []api.MediaSourceInfo, policy, container string, maxBitrate int64) (api.MediaSourceInfo, bool) {
+	if len(sources) == 0 {
+		return api.MediaSourceInfo{}, false
+	}
+
+	policy, _ = canonicalSourcePolicy(policy)
+	switch policy {
+	case sourcePolicyFirst:
+	case sourcePolicyBitrate:
+		return highestBitrate(sources, 0)
+	case sourcePolicyContainer:
+		for _, source := range sources {
+			if container != "" && containerMatches(source.Container, container) {
+				return source, true
+			}
+		}
+	case sourcePolicyMaxBitrate:
+		if source, ok := highestBitrate(sources, maxBitrate); ok {
+			return source, true
+		}
+		// 都超过上限时选码率最低的，转码压力最小
+		lowest := sources[0]
+		for _, source := range sources[1:] {
+			if source.Bitrate < lowest.Bitrate {
+				lowest = source
+			}
+		}
+		return lowest, true
+	}
+	return sources[0], true
+}
+
+// highestBitrate 返回码率最高的媒体源，limit 大于 0 时只考虑不超过 limit 的媒体源 (码率未知的也算在内)
+func highestBitrate(sources []api.MediaSourceInfo, limit int64) (api.MediaSourceInfo, bool) {
+	var best api.MediaSourceInfo
+	found := false
+	for _, source := range sources {
+		if limit > 0 && source.Bitrate > limit {
+			continue
+		}
+		if !found || source.Bitrate > best.Bitrate {
+			best, found = source, true
+		}
+	}
+	return best, found
+}
+
+// containerMatches 比较容器与扩展名，Emby 的 Container 可能是 "mkv,webm" 这样的列表
+func containerMatches(sourceContainer, extension string) bool {
+	for _, name := range strings.Split(sourceContainer, ",") {
+		if strings.EqualFold(strings.TrimSpace(name), extension) {
+			return true
+		}
+	}
+	return false
+}
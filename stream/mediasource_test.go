@@ -0,0 +1,59 @@
+package stream
+
+import (
+	"Go_Frontend/api"
+	"Go_Frontend/config"
+	"testing"
+)
+
+func TestSelectMediaSource(t *testing.T) {
+	sources := []api.MediaSourceInfo{
+		{ID: "1080p", Container: "mp4", Bitrate: 8_000_000},
+		{ID: "2160p", Container: "mkv,webm", Bitrate: 40_000_000},
+		{ID: "720p", Container: "mkv", Bitrate: 3_000_000},
+	}
+
+	tests := []struct {
+		policy     string
+		container  string
+		maxBitrate int64
+		want       string
+	}{
+		{"", "", 0, "1080p"},
+		{"first", "mkv", 0, "1080p"},
+		{"bitrate", "", 0, "2160p"},
+		{"container", "MKV", 0, "2160p"},
+		{"container", "webm", 0, "2160p"},
+		{"container", "avi", 0, "1080p"}, // no match falls back to the first
+		{"maxBitrate", "", 10_000_000, "1080p"},
+		{"maxBitrate", "", 0, "2160p"}, // no limit sent by the client
+		{"maxBitrate", "", 1_000_000, "720p"},
+		// Policies are matched however the config spells them
+		{"maxbitrate", "", 10_000_000, "1080p"},
+		{"Bitrate", "", 0, "2160p"},
+		{" CONTAINER ", "mkv", 0, "2160p"},
+	}
+	for _, tt := range tests {
+		got, ok := selectMediaSource(sources, tt.policy, tt.container, tt.maxBitrate)
+		if !ok || got.ID != tt.want {
+			t.Errorf("selectMediaSource(%q, %q, %d) = %s, want %s", tt.policy, tt.container, tt.maxBitrate, got.ID, tt.want)
+		}
+	}
+
+	if _, ok := selectMediaSource(nil, "first", "", 0); ok {
+		t.Error("selectMediaSource on an item without media sources should fail")
+	}
+}
+
+func TestInitializeMediaSource(t *testing.T) {
+	for _, policy := range []string{"", "first", "maxBitrate", "MAXBITRATE", "Container"} {
+		if err := InitializeMediaSource(config.MediaSourceConfig{Policy: policy}); err != nil {
+			t.Errorf("policy %q: %v", policy, err)
+		}
+	}
+	for _, policy := range []string{"max-bitrate", "fastest"} {
+		if err := InitializeMediaSource(config.MediaSourceConfig{Policy: policy}); err == nil {
+			t.Errorf("unknown policy %q was accepted", policy)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package stream
+
+import (
+	"Go_Frontend/api"
+	"Go_Frontend/config"
+	"Go_Frontend/geoip"
+	"Go_Frontend/logger"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-json"
+)
+
+// playbackDecision 某个用户/客户端的 PlaybackInfo 改写方式
+type playbackDecision struct {
+	rewrite          bool
+	stripTranscoding bool
+}
+
+// HandlePlaybackInfo 把 PlaybackInfo 请求代理到所选服务器，并把路径命中后端的媒体源改为已签名的直链，
+// 这样使用 DirectStreamUrl 的客户端也不经过媒体服务器播放
+func HandlePlaybackInfo(c *gin.Context) {
+	server := resolveServer(c)
+	user, ok := authenticateRequest(c, server)
+	if !ok {
+		return
+	}
+
+	itemID := c.Param("itemID")
+	location := geoip.Lookup(c.ClientIP())
+	client := clientName(c.Request)
+	decision := playbackPolicy(config.GetConfig().PlaybackInfo, user, client)
+
+	// 被地域策略拦截或处于特殊日期时不下发直链，播放请求仍由 HandleStreamRequest 处理
+	if !geoip.Allowed(location) || getMediaForSpecialDate(server, time.Now()).IsValid() {
+		decision.rewrite = false
+	}
+	// 直链绕过了 HandleStreamRequest，权限检查需要在这里完成
+	if decision.rewrite && !authorizeItem(c, server, user, itemID, location) {
+		return
+	}
+
+	target, err := url.Parse(server.FullURL())
+	if err != nil {
+		logger.Error("Invalid URL of server %s: %v", server.Name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid media server URL"})
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.SetXForwarded() // 媒体服务器据此判断是否为远程访问
+			// 由 Transport 协商并解压 gzip，改写时拿到的是明文 JSON
+			r.Out.Header.Del("Accept-Encoding")
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			dropUpstreamCORS(resp.Header)
+			if !decision.rewrite || resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+				return nil
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return err
+			}
+			rewritten, count, err := rewritePlaybackInfo(body, decision.stripTranscoding, func(media *api.MediaSourceInfo) (string, bool) {
+				streamingURL, signed, err := generateStreamingURL(server, media, itemID, media.ID, location)
+				if err != nil {
+					logger.Debug("Media source %s of item %s left unchanged: %v", media.ID, itemID, err)
+					return "", false
+				}
+				// 客户端随后可能直接请求 /stream，改写成功的路径写入缓存；未匹配后端的媒体源无法直链，不占用缓存
+				storeMediaSource(pathCacheKey(server, itemID, media.ID), media)
+				return streamingURL, signed
+			})
+			if err != nil {
+				// 无法解析时原样返回，不影响播放
+				logger.Warn("Failed to rewrite PlaybackInfo of item %s: %v", itemID, err)
+				rewritten = body
+			} else if count > 0 {
+				logger.Info("Rewrote %d media sources of item %s to direct links (server: %s, user: %s, client: %s)",
+					count, itemID, server.Name, userName(user), client)
+			}
+
+			resp.Body = io.NopCloser(bytes.NewReader(rewritten))
+			resp.ContentLength = int64(len(rewritten))
+			resp.Header.Set("Content-Length", strconv.Itoa(len(rewritten)))
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			logger.Error("Failed to proxy PlaybackInfo of item %s to server %s: %v", itemID, server.Name, err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(c.Writer, c.Request)
+}
+
+// dropUpstreamCORS 删除媒体服务器返回的 CORS 响应头，这些响应头由 CorsMiddleware 设置，避免重复
+func dropUpstreamCORS(header http.Header) {
+	for _, name := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Methods", "Access-Control-Allow-Headers"} {
+		header.Del(name)
+	}
+}
+
+// rewritePlaybackInfo 改写 PlaybackInfo 响应中的媒体源，未知字段原样保留。
+// sign 返回媒体源的签名直链，不能签名时返回 false，该媒体源保持不变
+func rewritePlaybackInfo(body []byte, stripTranscoding bool, sign func(media *api.MediaSourceInfo) (string, bool)) ([]byte, int, error) {
+	var info map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber() // Size、RunTimeTicks 等大整数保持原样
+	if err := decoder.Decode(&info); err != nil {
+		return nil, 0, err
+	}
+
+	sources, _ := info["MediaSources"].([]any)
+	count := 0
+	for _, s := range sources {
+		source, ok := s.(map[string]any)
+		if !ok {
+			continue
+		}
+		media := mediaSourceFromJSON(source)
+		if media.ID == "" || media.Path == "" {
+			continue
+		}
+		streamingURL, ok := sign(media)
+		if !ok {
+			continue
+		}
+
+		source["SupportsDirectPlay"] = true
+		source["SupportsDirectStream"] = true
+		source["DirectStreamUrl"] = streamingURL
+		if stripTranscoding {
+			source["SupportsTranscoding"] = false
+			delete(source, "TranscodingUrl")
+			delete(source, "TranscodingSubProtocol")
+			delete(source, "TranscodingContainer")
+		}
+		count++
+	}
+	if count == 0 {
+		return body, 0, nil
+	}
+
+	rewritten, err := json.Marshal(info)
+	return rewritten, count, err
+}
+
+// mediaSourceFromJSON 读取签名需要的字段，Size 等数值为 UseNumber 解析出的 json.Number
+func mediaSourceFromJSON(source map[string]any) *api.MediaSourceInfo {
+	media := &api.MediaSourceInfo{}
+	media.ID, _ = source["Id"].(string)
+	media.Path, _ = source["Path"].(string)
+	media.Container, _ = source["Container"].(string)
+	if size, ok := source["Size"].(json.Number); ok {
+		media.Size, _ = size.Int64()
+	}
+	if ticks, ok := source["RunTimeTicks"].(json.Number); ok {
+		media.RunTimeTicks, _ = ticks.Int64()
+	}
+	return media
+}
+
+// playbackPolicy 按顺序匹配规则，都不匹配时改写并使用全局的 StripTranscoding
+func playbackPolicy(cfg config.PlaybackInfoConfig, user *api.User, client string) playbackDecision {
+	for _, rule := range cfg.Rules {
+		if matchUser(rule.Users, user) && matchClient(rule.Clients, client) {
+			return playbackDecision{rewrite: !rule.Passthrough, stripTranscoding: rule.StripTranscoding}
+		}
+	}
+	return playbackDecision{rewrite: true, stripTranscoding: cfg.StripTranscoding}
+}
+
+// matchUser 按用户名 (不区分大小写) 或用户 ID 匹配，未启用认证时只匹配不限用户的规则
+func matchUser(users []string, user *api.User) bool {
+	if len(users) == 0 {
+		return true
+	}
+	if user == nil {
+		return false
+	}
+	for _, u := range users {
+		if strings.EqualFold(u, user.Name) || api.NormalizeID(u) == api.NormalizeID(user.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchClient 按客户端名称匹配，支持 * 通配，不区分大小写
+func matchClient(clients []string, client string) bool {
+	if len(clients) == 0 {
+		return true
+	}
+	client = strings.ToLower(client)
+	for _, pattern := range clients {
+		if matched, _ := path.Match(strings.ToLower(pattern), client); matched {
+			return true
+		}
+	}
+	return false
+}
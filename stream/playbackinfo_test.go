@@ -0,0 +1,158 @@
+package stream
+
+import (
+	"Go_Frontend/api"
+	"Go_Frontend/config"
+	"Go_Frontend/route"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-json"
+)
+
+const playbackInfoBody = `{
+	"MediaSources": [
+		{"Id": "a", "Path": "/mnt/gd/movie.mkv", "Size": 12345678901234567, "SupportsDirectPlay": false,
+		 "TranscodingUrl": "/videos/1/master.m3u8", "TranscodingSubProtocol": "hls", "SupportsTranscoding": true},
+		{"Id": "b", "Path": "/mnt/local/movie.mkv", "TranscodingUrl": "/videos/1/master.m3u8"}
+	],
+	"PlaySessionId": "session"
+}`
+
+func TestRewritePlaybackInfo(t *testing.T) {
+	sign := func(media *api.MediaSourceInfo) (string, bool) {
+		if media.Size != 12345678901234567 && media.ID == "a" {
+			t.Errorf("media source metadata not passed to sign: %+v", media)
+		}
+		if strings.HasPrefix(media.Path, "/mnt/gd/") {
+			return "https://stream.example.com/stream?path=movie.mkv&signature=x", true
+		}
+		return "", false
+	}
+
+	body, count, err := rewritePlaybackInfo([]byte(playbackInfoBody), true, sign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("rewrote %d media sources, want 1", count)
+	}
+
+	var info struct {
+		MediaSources  []map[string]any
+		PlaySessionId string
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(body)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.PlaySessionId != "session" {
+		t.Errorf("PlaySessionId = %q, unknown fields must be kept", info.PlaySessionId)
+	}
+
+	matched, other := info.MediaSources[0], info.MediaSources[1]
+	if matched["DirectStreamUrl"] != "https://stream.example.com/stream?path=movie.mkv&signature=x" ||
+		matched["SupportsDirectPlay"] != true || matched["SupportsDirectStream"] != true {
+		t.Errorf("matched source not rewritten: %v", matched)
+	}
+	if _, found := matched["TranscodingUrl"]; found || matched["SupportsTranscoding"] != false {
+		t.Errorf("transcoding not stripped: %v", matched)
+	}
+	if matched["Size"] != json.Number("12345678901234567") {
+		t.Errorf("Size = %v, large integers must survive the rewrite", matched["Size"])
+	}
+	if _, found := other["DirectStreamUrl"]; found || other["TranscodingUrl"] == nil {
+		t.Errorf("source without a backend was changed: %v", other)
+	}
+}
+
+func TestPlaybackPolicy(t *testing.T) {
+	cfg := config.PlaybackInfoConfig{
+		StripTranscoding: false,
+		Rules: []config.PlaybackInfoRuleConfig{
+			{Users: []string{"kid"}, Passthrough: true},
+			{Clients: []string{"infuse*"}, StripTranscoding: true},
+		},
+	}
+	kid := &api.User{ID: "1", Name: "Kid"}
+	adult := &api.User{ID: "2", Name: "adult"}
+
+	tests := []struct {
+		user   *api.User
+		client string
+		want   playbackDecision
+	}{
+		{kid, "Infuse-Direct", playbackDecision{rewrite: false}},
+		{adult, "Infuse-Direct", playbackDecision{rewrite: true, stripTranscoding: true}},
+		{adult, "Emby Web", playbackDecision{rewrite: true}},
+		{nil, "Emby Web", playbackDecision{rewrite: true}},
+	}
+	for _, tt := range tests {
+		if got := playbackPolicy(cfg, tt.user, tt.client); got != tt.want {
+			t.Errorf("playbackPolicy(%v, %q) = %+v, want %+v", tt.user, tt.client, got, tt.want)
+		}
+	}
+}
+
+func TestHandlePlaybackInfoCachesRewrittenSources(t *testing.T) {
+	emby := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, playbackInfoBody)
+	}))
+	t.Cleanup(emby.Close)
+
+	if err := InitializeSignature("vPQC5LWCN2CW2opz"); err != nil {
+		t.Fatal(err)
+	}
+	savedServers, savedAuth := config.GetConfig().Servers, config.GetConfig().Auth
+	savedCache := cache
+	t.Cleanup(func() {
+		config.GetConfig().Servers, config.GetConfig().Auth = savedServers, savedAuth
+		cache = savedCache
+		route.Load(savedServers, "")
+	})
+	config.GetConfig().Servers = []config.ServerConfig{{
+		Name:     "family",
+		Type:     config.ServerTypeEmby,
+		URL:      emby.URL,
+		Backends: []config.BackendConfig{{Name: "gd", URL: "https://gd.example.com/stream", Path: "/mnt/gd"}},
+	}}
+	config.GetConfig().Auth.Enabled = false
+	if err := route.Load(config.GetConfig().Servers, ""); err != nil {
+		t.Fatal(err)
+	}
+	memory := newTestMemoryCache(t, 10)
+	cache = memory
+
+	r := gin.New()
+	r.POST("/Items/:itemID/PlaybackInfo", HandlePlaybackInfo)
+	frontend := httptest.NewServer(r)
+	t.Cleanup(frontend.Close)
+
+	resp, err := http.Post(frontend.URL+"/Items/1/PlaybackInfo", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "https://gd.example.com/stream") {
+		t.Fatalf("PlaybackInfo = %d %s", resp.StatusCode, body)
+	}
+
+	// Only the rewritten source is cached; the one without a backend could never be served as a link
+	server := &config.GetConfig().Servers[0]
+	if _, found := LookupCachedPath(server, "1", "a"); !found {
+		t.Error("rewritten media source was not cached")
+	}
+	if _, found := LookupCachedPath(server, "1", "b"); found {
+		t.Error("media source without a backend was cached")
+	}
+	if n := memory.Len(); n != 1 {
+		t.Errorf("path cache holds %d entries, want 1", n)
+	}
+}
@@ -0,0 +1,278 @@
+package stream
+
+import (
+	"Go_Frontend/api"
+	"Go_Frontend/config"
+	"Go_Frontend/geoip"
+	"Go_Frontend/library"
+	"Go_Frontend/logger"
+	"Go_Frontend/util"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// plexPartItems 记录 part 所属的条目 ("server:partID" -> ratingKey)，Plex 的 part 地址中没有条目 ID
+var plexPartItems = util.NewTTLCache[string](time.Hour)
+
+// plexAccessCache 缓存客户端令牌可以访问的条目 ("server:token:ratingKey")，有效期与 authCache 相同
+var plexAccessCache = util.NewTTLCache[struct{}](time.Minute)
+
+// HandlePlexPart 处理 /library/parts/{partId}/{ts}/file.{ext} 直接播放请求。
+// 不知道所属条目的 part 交给 Plex 处理，因此需要开启 Index 或配置 PublicURL，否则媒体经由前端传输
+func HandlePlexPart(c *gin.Context) {
+	logger.Info("Handling Plex part request...")
+	logRequestDetails(c)
+
+	server := resolvePlexServer(c)
+	if server == nil {
+		logger.Warn("No Plex server for host %s", c.Request.Host)
+		c.JSON(http.StatusNotFound, gin.H{"error": "No Plex server for this host"})
+		return
+	}
+	partID := c.Param("partID")
+	ratingKey, ok := plexPartItem(server, partID)
+	if !ok {
+		logger.Info("Part %s is not indexed, passing to Plex server %s", partID, server.Name)
+		passToServer(c, server)
+		return
+	}
+
+	if !authorizePlexItem(c, server, plexToken(c.Request), ratingKey) {
+		return
+	}
+	servePlexPart(c, server, ratingKey, partID, nil)
+}
+
+// HandlePlexVideo 处理 /video/*rest：gin 无法注册含字面冒号的 /video/:/ 路由，
+// 这里把 /video/:/transcode/universal/start(.ext) 交给 HandlePlexTranscode，其它路径返回 404
+func HandlePlexVideo(c *gin.Context) {
+	if !isPlexTranscodeStart(c.Param("rest")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	HandlePlexTranscode(c)
+}
+
+// isPlexTranscodeStart 判断 /video 之后的路径是否为 /:/transcode/universal/start 或 start.{ext}
+func isPlexTranscodeStart(rest string) bool {
+	ext, ok := strings.CutPrefix(rest, "/:/transcode/universal/start")
+	if !ok {
+		return false
+	}
+	if ext == "" {
+		return true
+	}
+	ext, ok = strings.CutPrefix(ext, ".")
+	return ok && ext != "" && !strings.ContainsAny(ext, "/.")
+}
+
+// HandlePlexTranscode 处理 /video/:/transcode/universal/start 请求：directPlay=1 时按 path、mediaIndex、
+// partIndex 找到 part 并重定向到签名直链，需要转码的请求交给 Plex
+func HandlePlexTranscode(c *gin.Context) {
+	logger.Info("Handling Plex transcode request...")
+	logRequestDetails(c)
+
+	server := resolvePlexServer(c)
+	if server == nil {
+		logger.Warn("No Plex server for host %s", c.Request.Host)
+		c.JSON(http.StatusNotFound, gin.H{"error": "No Plex server for this host"})
+		return
+	}
+	ratingKey, ok := api.ParseMetadataKey(queryParam(c, "path"))
+	if !ok || queryParam(c, "directPlay") != "1" {
+		passToServer(c, server)
+		return
+	}
+
+	if !authorizePlexItem(c, server, plexToken(c.Request), ratingKey) {
+		return
+	}
+
+	metadata, err := fetchPlexMetadata(c.Request.Context(), server, ratingKey)
+	if err != nil {
+		logger.Error("Failed to fetch Plex metadata of item %s: %v", ratingKey, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch item metadata"})
+		return
+	}
+	mediaIndex, _ := strconv.Atoi(queryParam(c, "mediaIndex"))
+	partIndex, _ := strconv.Atoi(queryParam(c, "partIndex"))
+	media, ok := metadata.Part(mediaIndex, partIndex)
+	if !ok {
+		logger.Warn("Item %s has no media %d part %d, passing to Plex", ratingKey, mediaIndex, partIndex)
+		passToServer(c, server)
+		return
+	}
+	servePlexPart(c, server, ratingKey, media.ID, &media)
+}
+
+// servePlexPart 按与 Emby 相同的流程签名并重定向：地域策略、特殊日期、路径缓存、后端匹配。
+// media 为 nil 时从索引或 /library/metadata 获取
+func servePlexPart(c *gin.Context, server *config.ServerConfig, ratingKey, partID string, media *api.MediaSourceInfo) {
+	location := geoip.Lookup(c.ClientIP())
+
+	itemID, mediaSourceID, mediaPath := ratingKey, partID, ""
+	isSpecialDate := false
+	if !geoip.Allowed(location) {
+		itemID, mediaSourceID, mediaPath, isSpecialDate = fetchBlockedMedia(c, server, location)
+		if itemID == "" {
+			return
+		}
+	} else if special := getMediaForSpecialDate(server, time.Now()); special.IsValid() {
+		logger.Info("Special date detected.")
+		itemID, mediaSourceID, mediaPath, isSpecialDate = special.ItemId, special.MediaSourceID, special.MediaPath, true
+	}
+
+	if media != nil && !isSpecialDate {
+		storeMediaSource(pathCacheKey(server, itemID, mediaSourceID), media)
+	} else {
+		var err error
+		media, err = fetchMediaSourceIfNeeded(c.Request.Context(), server, itemID, mediaSourceID, mediaPath, isSpecialDate)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	streamingURL, _, err := generateStreamingURL(server, media, itemID, mediaSourceID, location)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Info("Redirecting to streaming URL: %s (server: %s, client: %s)", streamingURL, server.Name, location)
+	c.Header("Location", streamingURL)
+	c.Status(http.StatusFound)
+}
+
+// authorizePlexItem 使用客户端的 X-Plex-Token 查询条目元数据：令牌无效返回 401，
+// 条目所在的媒体库未共享给该用户返回 403。未启用认证时不检查
+func authorizePlexItem(c *gin.Context, server *config.ServerConfig, token, ratingKey string) bool {
+	if !config.GetConfig().Auth.Enabled {
+		return true
+	}
+	if token == "" {
+		logger.Warn("Rejected Plex request without access token from %s", c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing access token"})
+		return false
+	}
+
+	key := serverKey(server, token+":"+ratingKey)
+	if _, found := plexAccessCache.Get(key); found {
+		return true
+	}
+
+	_, err := sharedCall(c.Request.Context(), "plexauth:"+key, func(ctx context.Context) (interface{}, error) {
+		metadata, err := api.NewPlexAPI(server).GetMetadata(ctx, token, ratingKey)
+		if err == nil {
+			notePlexParts(server, metadata)
+		}
+		return metadata, err
+	})
+	switch {
+	case errors.Is(err, api.ErrUnauthorized):
+		logger.Warn("Rejected Plex request for item %s with an invalid or unshared token from %s", ratingKey, c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid access token"})
+		return false
+	case errors.Is(err, api.ErrNotFound):
+		logger.Warn("Denied Plex item %s: not visible with the client's token", ratingKey)
+		c.JSON(http.StatusForbidden, gin.H{"error": "item is not visible to this user"})
+		return false
+	case err != nil:
+		logger.Error("Failed to validate Plex access token: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to validate access token"})
+		return false
+	}
+
+	plexAccessCache.Set(key, struct{}{})
+	return true
+}
+
+// fetchPlexMetadata 使用服务器令牌查询条目元数据，合并并发请求
+func fetchPlexMetadata(ctx context.Context, server *config.ServerConfig, ratingKey string) (*api.PlexMetadata, error) {
+	v, err := sharedCall(ctx, "plexmeta:"+serverKey(server, ratingKey), func(ctx context.Context) (interface{}, error) {
+		metadata, err := api.NewPlexAPI(server).GetMetadata(ctx, server.APIKey, ratingKey)
+		if err == nil {
+			notePlexParts(server, metadata)
+		}
+		return metadata, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*api.PlexMetadata), nil
+}
+
+// plexPartItem 查找 part 所属的条目：先查最近见过的元数据，再扫描媒体库索引
+func plexPartItem(server *config.ServerConfig, partID string) (string, bool) {
+	key := serverKey(server, partID)
+	if ratingKey, found := plexPartItems.Get(key); found {
+		return ratingKey, true
+	}
+	ratingKey, found := library.FindItem(server.Name, partID)
+	if found {
+		plexPartItems.Set(key, ratingKey)
+	}
+	return ratingKey, found
+}
+
+// notePlexParts 记录元数据中各 part 所属的条目，之后的 part 请求无需索引即可签名
+func notePlexParts(server *config.ServerConfig, metadata *api.PlexMetadata) {
+	for _, source := range metadata.MediaSources() {
+		plexPartItems.Set(serverKey(server, source.ID), metadata.RatingKey)
+	}
+}
+
+// plexToken 返回客户端的 X-Plex-Token，Plex 客户端通常放在查询参数中
+func plexToken(r *http.Request) string {
+	if token := r.URL.Query().Get("X-Plex-Token"); token != "" {
+		return token
+	}
+	return r.Header.Get("X-Plex-Token")
+}
+
+// passToServer 把无法签名的请求交给媒体服务器：配置了 PublicURL 时重定向，客户端直接从 Plex 读取媒体；
+// 否则由前端代理
+func passToServer(c *gin.Context, server *config.ServerConfig) {
+	if server.PublicURL == "" {
+		proxyToServer(c, server)
+		return
+	}
+	target := strings.TrimRight(server.PublicURL, "/") + c.Request.URL.RequestURI()
+	logger.Info("Redirecting %s to Plex server %s", c.Request.URL.Path, server.Name)
+	c.Header("Location", target)
+	c.Status(http.StatusFound)
+}
+
+// proxyToServer 把无法签名的请求 (需要转码、未知的 part) 原样代理给媒体服务器
+func proxyToServer(c *gin.Context, server *config.ServerConfig) {
+	target, err := url.Parse(server.FullURL())
+	if err != nil {
+		logger.Error("Invalid URL of server %s: %v", server.Name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid media server URL"})
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.SetXForwarded()
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			dropUpstreamCORS(resp.Header)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			logger.Error("Failed to proxy %s to server %s: %v", r.URL.Path, server.Name, err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,231 @@
+package stream
+
+import (
+	"Go_Frontend/config"
+	"Go_Frontend/logger"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisTimeout bounds every cache operation; a slow cache must not stall playback.
+const redisTimeout = time.Second
+
+// unlockScript deletes a lock only while it still holds the owner's token, so a holder whose
+// lock expired cannot release the lock of the next holder.
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// RedisCache keeps the cache on a Redis-protocol server shared by every instance.
+// Entries live under "<prefix>path:" and locks under "<prefix>lock:".
+type RedisCache struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisCache connects to the configured server and checks that it is reachable.
+func NewRedisCache(cfg config.RedisConfig) (*RedisCache, error) {
+	if cfg.Addr == "" {
+		return nil, errors.New("Cache.redis.addr is required")
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connect to redis %s: %w", cfg.Addr, err)
+	}
+	return &RedisCache{client: client, prefix: cfg.Prefix}, nil
+}
+
+func (c *RedisCache) entryKey(key string) string {
+	return c.prefix + "path:" + key
+}
+
+// Get retrieves the value associated with the key. Errors other than a miss are logged
+// and treated as a miss, so playback falls back to resolving the item.
+func (c *RedisCache) Get(key string) (string, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	value, err := c.client.Get(ctx, c.entryKey(key)).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			logger.Warn("Redis cache get %s failed: %v", key, err)
+		}
+		return "", false
+	}
+	return value, true
+}
+
+// Set adds a key-value pair that expires after ttl.
+func (c *RedisCache) Set(key string, value string, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return c.client.Set(ctx, c.entryKey(key), value, ttl).Err()
+}
+
+// Delete removes a key-value pair.
+func (c *RedisCache) Delete(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return c.client.Del(ctx, c.entryKey(key)).Err()
+}
+
+// DeleteFunc removes every entry whose key satisfies fn and returns how many were removed.
+// It scans the keyspace of this cache, including entries written by other instances.
+func (c *RedisCache) DeleteFunc(fn func(key string) bool) int {
+	removed, err := c.deleteMatching(fn)
+	if err != nil {
+		logger.Error("Redis cache delete failed after %d entries: %v", removed, err)
+	}
+	return removed
+}
+
+// Reset removes every entry; locks are left to expire.
+func (c *RedisCache) Reset() error {
+	_, err := c.deleteMatching(func(string) bool { return true })
+	return err
+}
+
+// Len counts the entries of this cache with SCAN; errors are logged and the partial count returned.
+func (c *RedisCache) Len() int {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	count := 0
+	iter := c.client.Scan(ctx, 0, escapeGlob(c.entryKey(""))+"*", 500).Iterator()
+	for iter.Next(ctx) {
+		count++
+	}
+	if err := iter.Err(); err != nil {
+		logger.Error("Redis cache count failed after %d entries: %v", count, err)
+	}
+	return count
+}
+
+// Range calls fn for every entry until fn returns false, reading values in batches with MGET.
+func (c *RedisCache) Range(fn func(key, value string) bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	prefix := c.entryKey("")
+	iter := c.client.Scan(ctx, 0, escapeGlob(prefix)+"*", 500).Iterator()
+	var batch []string
+	// visit returns false once fn has asked to stop
+	visit := func() (bool, error) {
+		if len(batch) == 0 {
+			return true, nil
+		}
+		values, err := c.client.MGet(ctx, batch...).Result()
+		if err != nil {
+			return false, err
+		}
+		for i, value := range values {
+			// Entries that expired since the scan come back as nil
+			if s, ok := value.(string); ok && !fn(strings.TrimPrefix(batch[i], prefix), s) {
+				return false, nil
+			}
+		}
+		batch = batch[:0]
+		return true, nil
+	}
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) >= 500 {
+			if more, err := visit(); !more {
+				return err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	_, err := visit()
+	return err
+}
+
+func (c *RedisCache) deleteMatching(fn func(key string) bool) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	prefix := c.entryKey("")
+	removed := 0
+	iter := c.client.Scan(ctx, 0, escapeGlob(prefix)+"*", 500).Iterator()
+	var batch []string
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		n, err := c.client.Del(ctx, batch...).Result()
+		removed += int(n)
+		batch = batch[:0]
+		return err
+	}
+	for iter.Next(ctx) {
+		if fn(strings.TrimPrefix(iter.Val(), prefix)) {
+			batch = append(batch, iter.Val())
+		}
+		if len(batch) >= 500 {
+			if err := flush(); err != nil {
+				return removed, err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return removed, err
+	}
+	return removed, flush()
+}
+
+// TryLock acquires key for at most ttl with SET NX. unlock only releases the lock while it is
+// still ours.
+func (c *RedisCache) TryLock(key string, ttl time.Duration) (func(), bool, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, false, err
+	}
+	value := hex.EncodeToString(token)
+	lockKey := c.prefix + "lock:" + key
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	ok, err := c.client.SetNX(ctx, lockKey, value, ttl).Result()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	unlock := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+		defer cancel()
+		if err := unlockScript.Run(ctx, c.client, []string{lockKey}, value).Err(); err != nil {
+			logger.Warn("Failed to release lock %s, it expires in %s: %v", key, ttl, err)
+		}
+	}
+	return unlock, true, nil
+}
+
+// escapeGlob escapes the pattern characters of SCAN MATCH in a literal prefix.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
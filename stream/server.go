@@ -0,0 +1,65 @@
+package stream
+
+import (
+	"Go_Frontend/config"
+	"Go_Frontend/util"
+	"github.com/gin-gonic/gin"
+	"strings"
+)
+
+// resolveServer 按 X-Forwarded-Host、Host、TLS SNI 的顺序选择媒体服务器，都不匹配时使用默认服务器。
+// nginx 反代时 Host 通常被改写为 127.0.0.1，需要通过 X-Forwarded-Host 传递原始主机名；
+// 该请求头只在直接连接的对端是受信代理 (Server.trustedProxies) 时采用
+func resolveServer(c *gin.Context) *config.ServerConfig {
+	if server, ok := matchRequestHost(c); ok {
+		return server
+	}
+	return config.DefaultServer()
+}
+
+// resolvePlexServer 与 resolveServer 相同，但只选择 Plex 服务器，避免把 Plex 请求和 X-Plex-Token
+// 发给 Emby/Jellyfin。主机名匹配到其他类型的服务器时返回 nil；都不匹配时使用默认服务器，
+// 默认服务器不是 Plex 时使用第一个 Plex 服务器
+func resolvePlexServer(c *gin.Context) *config.ServerConfig {
+	if server, ok := matchRequestHost(c); ok {
+		if server.Type == config.ServerTypePlex {
+			return server
+		}
+		return nil
+	}
+	if server := config.DefaultServer(); server != nil && server.Type == config.ServerTypePlex {
+		return server
+	}
+	servers := config.GetConfig().Servers
+	for i := range servers {
+		if servers[i].Type == config.ServerTypePlex {
+			return &servers[i]
+		}
+	}
+	return nil
+}
+
+// matchRequestHost 返回请求的主机名匹配的服务器
+func matchRequestHost(c *gin.Context) (*config.ServerConfig, bool) {
+	var candidates []string
+	if util.MatchIP(config.GetConfig().TrustedProxies, c.RemoteIP()) {
+		forwarded, _, _ := strings.Cut(c.GetHeader("X-Forwarded-Host"), ",")
+		candidates = append(candidates, forwarded)
+	}
+	candidates = append(candidates, c.Request.Host)
+	if c.Request.TLS != nil {
+		candidates = append(candidates, c.Request.TLS.ServerName)
+	}
+
+	for _, host := range candidates {
+		if server, ok := config.MatchServer(host); ok {
+			return server, true
+		}
+	}
+	return nil, false
+}
+
+// serverKey 为缓存键和 singleflight 键加上服务器名称，不同服务器的条目 ID 和令牌互不相干
+func serverKey(server *config.ServerConfig, key string) string {
+	return server.Name + ":" + key
+}
@@ -0,0 +1,57 @@
+package stream
+
+import (
+	"Go_Frontend/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestResolveServer(t *testing.T) {
+	savedServers, savedProxies := config.GetConfig().Servers, config.GetConfig().TrustedProxies
+	t.Cleanup(func() { config.GetConfig().Servers, config.GetConfig().TrustedProxies = savedServers, savedProxies })
+	config.GetConfig().Servers = []config.ServerConfig{
+		{Name: "family"},
+		{Name: "friends", Hosts: []string{"friends.example.com"}},
+		{Name: "plex", Type: config.ServerTypePlex, Hosts: []string{"plex.example.com"}},
+	}
+	config.GetConfig().TrustedProxies = []string{"127.0.0.1", "10.0.0.0/8"}
+
+	tests := []struct {
+		name      string
+		peer      string
+		host      string
+		forwarded string
+		want      string
+		wantPlex  string
+	}{
+		{"host", "203.0.113.7:5000", "friends.example.com", "", "friends", ""},
+		{"unknown host", "203.0.113.7:5000", "other.example.com", "", "family", "plex"},
+		{"forwarded by a trusted proxy", "127.0.0.1:5000", "127.0.0.1:60001", "friends.example.com", "friends", ""},
+		{"forwarded by a trusted network", "10.1.2.3:5000", "127.0.0.1:60001", "plex.example.com, proxy.example.com", "plex", "plex"},
+		// A client cannot pick another server by sending the header itself
+		{"forwarded by an untrusted peer", "203.0.113.7:5000", "other.example.com", "friends.example.com", "family", "plex"},
+		{"untrusted peer, host still used", "203.0.113.7:5000", "plex.example.com", "friends.example.com", "plex", "plex"},
+	}
+	for _, test := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/videos/1/stream", nil)
+		c.Request.RemoteAddr = test.peer
+		c.Request.Host = test.host
+		if test.forwarded != "" {
+			c.Request.Header.Set("X-Forwarded-Host", test.forwarded)
+		}
+		if got := resolveServer(c); got == nil || got.Name != test.want {
+			t.Errorf("%s: resolveServer = %v, want %s", test.name, got, test.want)
+		}
+		got := ""
+		if server := resolvePlexServer(c); server != nil {
+			got = server.Name
+		}
+		if got != test.wantPlex {
+			t.Errorf("%s: resolvePlexServer = %q, want %q", test.name, got, test.wantPlex)
+		}
+	}
+}
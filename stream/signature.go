@@ -46,12 +46,20 @@ func GetSignatureInstance() (*Signature, error) {
 // Encrypt deterministically generates a signature for the given itemId, mediaId and expireAt using HMAC-SHA256.
 // Returns a base64-encoded ciphertext string.
 func (s *Signature) Encrypt(itemId, mediaId string, expireAt int64) (string, error) {
+	return s.EncryptWithClaims(itemId, mediaId, expireAt, nil)
+}
+
+// EncryptWithClaims is Encrypt with additional claims in the signed data, such as media hints for
+// the backend. Claims cannot override itemId, mediaId or expireAt.
+func (s *Signature) EncryptWithClaims(itemId, mediaId string, expireAt int64, claims map[string]interface{}) (string, error) {
 	// Create a map with the input data
-	data := map[string]interface{}{
-		"itemId":   itemId,
-		"mediaId":  mediaId,
-		"expireAt": expireAt,
+	data := make(map[string]interface{}, len(claims)+3)
+	for key, value := range claims {
+		data[key] = value
 	}
+	data["itemId"] = itemId
+	data["mediaId"] = mediaId
+	data["expireAt"] = expireAt
 
 	// Serialize the data to JSON
 	jsonData, err := json.Marshal(data)
@@ -0,0 +1,179 @@
+package stream
+
+import (
+	"Go_Frontend/config"
+	"Go_Frontend/logger"
+	"Go_Frontend/route"
+	"Go_Frontend/util"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// snapshotVersion is bumped whenever the layout of the snapshot or of the cached values changes.
+const snapshotVersion = 1
+
+// snapshotHeader is the first line of a snapshot file; every following line is a snapshotEntry.
+type snapshotHeader struct {
+	Version    int       `json:"version"`
+	ConfigHash string    `json:"configHash"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type snapshotEntry struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	ExpireAt int64  `json:"expireAt"` // Unix 毫秒
+}
+
+var (
+	snapshotCfg config.CacheSnapshotConfig
+	// snapshotMu 避免定时写入和退出时的写入同时进行
+	snapshotMu sync.Mutex
+)
+
+// snapshotCache 返回支持快照的缓存；Redis 自身持久化，不写快照
+func snapshotCache() (*MemoryCache, bool) {
+	memory, ok := cache.(*MemoryCache)
+	return memory, ok && snapshotCfg.File != ""
+}
+
+// configHash 对服务器和后端规则取摘要。规则变化后旧快照中的条目可能指向别的服务器，启动时丢弃。
+// 后端取实际生效的路由表，即 YAML 叠加管理接口写入状态文件的运行时修改
+func configHash(servers []config.ServerConfig) string {
+	type serverRules struct {
+		Name     string
+		Type     string
+		URL      string
+		Backends []config.BackendConfig
+	}
+	rules := make([]serverRules, 0, len(servers))
+	for i := range servers {
+		backends := servers[i].Backends
+		if registry := route.GetRegistry(servers[i].Name); registry != nil {
+			backends = registry.List()
+		}
+		rules = append(rules, serverRules{servers[i].Name, servers[i].Type, servers[i].FullURL(), backends})
+	}
+	data, _ := json.Marshal(rules)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// loadCacheSnapshot 把快照中未过期的条目写回内存缓存
+func loadCacheSnapshot(memory *MemoryCache, hash string) error {
+	file, err := os.Open(snapshotCfg.File)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read cache snapshot: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	if !scanner.Scan() {
+		return nil
+	}
+	var header snapshotHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Version != snapshotVersion {
+		logger.Warn("Ignoring cache snapshot %s with an unknown format", snapshotCfg.File)
+		return nil
+	}
+	if header.ConfigHash != hash {
+		logger.Warn("Ignoring cache snapshot %s written under different server or backend rules", snapshotCfg.File)
+		return nil
+	}
+
+	now := time.Now().UnixMilli()
+	loaded := 0
+	for scanner.Scan() {
+		var entry snapshotEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// 写入中断时最后一行可能不完整，之前的条目仍然可用
+			logger.Warn("Stopped reading cache snapshot %s at a corrupt entry: %v", snapshotCfg.File, err)
+			break
+		}
+		if entry.ExpireAt <= now {
+			continue
+		}
+		memory.Set(entry.Key, entry.Value, time.Duration(entry.ExpireAt-now)*time.Millisecond)
+		loaded++
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Warn("Stopped reading cache snapshot %s: %v", snapshotCfg.File, err)
+	}
+	logger.Info("Loaded %d media paths from cache snapshot %s (written %s)", loaded, snapshotCfg.File, header.CreatedAt.Format(time.RFC3339))
+	return nil
+}
+
+// SaveCacheSnapshot writes the in-memory path cache to the configured snapshot file.
+// It does nothing when snapshots are disabled or the cache is shared through Redis.
+func SaveCacheSnapshot() error {
+	memory, ok := snapshotCache()
+	if !ok {
+		return nil
+	}
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+
+	entries := memory.entriesSnapshot()
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	if err := encoder.Encode(snapshotHeader{
+		Version:    snapshotVersion,
+		ConfigHash: configHash(config.GetConfig().Servers),
+		CreatedAt:  time.Now(),
+	}); err != nil {
+		return err
+	}
+	for i := range entries {
+		if err := encoder.Encode(&entries[i]); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(snapshotCfg.File), 0o755); err != nil {
+		return fmt.Errorf("write cache snapshot: %w", err)
+	}
+	if err := util.WriteFileAtomic(snapshotCfg.File, buf.Bytes()); err != nil {
+		return fmt.Errorf("write cache snapshot: %w", err)
+	}
+	logger.Debug("Wrote %d media paths to cache snapshot %s", len(entries), snapshotCfg.File)
+	return nil
+}
+
+// StartCacheSnapshots writes a snapshot every Interval until ctx is done. It returns immediately.
+func StartCacheSnapshots(ctx context.Context) {
+	if _, ok := snapshotCache(); !ok {
+		return
+	}
+	interval := snapshotCfg.Interval
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := SaveCacheSnapshot(); err != nil {
+					logger.Error("Failed to write cache snapshot: %v", err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,108 @@
+package stream
+
+import (
+	"Go_Frontend/config"
+	"Go_Frontend/route"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheSnapshot(t *testing.T) {
+	savedCache, savedCfg := cache, snapshotCfg
+	t.Cleanup(func() { cache, snapshotCfg = savedCache, savedCfg })
+
+	file := filepath.Join(t.TempDir(), "cache", "paths.jsonl")
+	snapshotCfg = config.CacheSnapshotConfig{File: file}
+	memory := newTestMemoryCache(t, 10)
+	cache = memory
+	memory.Set("family:1:a", "path-1a", time.Hour)
+	memory.Set("family:2:a", "path-2a", 20*time.Millisecond)
+	memory.Set("family:3:a", "path-3a", time.Hour)
+	if err := SaveCacheSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	hash := configHash(config.GetConfig().Servers)
+	restored := newTestMemoryCache(t, 10)
+	if err := loadCacheSnapshot(restored, hash); err != nil {
+		t.Fatal(err)
+	}
+	if value, found := restored.Get("family:1:a"); !found || value != "path-1a" {
+		t.Errorf("Get(family:1:a) = %q, %v after restore", value, found)
+	}
+	if _, found := restored.Get("family:2:a"); found {
+		t.Error("entry expired since the snapshot was restored")
+	}
+
+	// Recency survives the restore: with room for one more entry the oldest is evicted first
+	small := newTestMemoryCache(t, 2)
+	memory.Delete("family:2:a")
+	memory.Get("family:1:a")
+	if err := SaveCacheSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadCacheSnapshot(small, hash); err != nil {
+		t.Fatal(err)
+	}
+	small.Set("family:4:a", "path-4a", time.Hour)
+	if _, found := small.Get("family:3:a"); found {
+		t.Error("least recently used entry survived the restore")
+	}
+
+	// Snapshots written under other backend rules are discarded
+	other := newTestMemoryCache(t, 10)
+	if err := loadCacheSnapshot(other, "other"); err != nil {
+		t.Fatal(err)
+	}
+	if other.Len() != 0 {
+		t.Errorf("restored %d entries from a snapshot with another config hash", other.Len())
+	}
+
+	// A truncated last line keeps the entries before it
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, data[:len(data)-5], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	truncated := newTestMemoryCache(t, 10)
+	if err := loadCacheSnapshot(truncated, hash); err != nil {
+		t.Fatal(err)
+	}
+	if truncated.Len() != 1 {
+		t.Errorf("restored %d entries from a truncated snapshot, want 1", truncated.Len())
+	}
+}
+
+func TestConfigHashIncludesRuntimeBackends(t *testing.T) {
+	servers := []config.ServerConfig{{
+		Name:     "family",
+		Backends: []config.BackendConfig{{Name: "gd", URL: "https://gd.example.com/stream", Path: "/mnt/gd"}},
+	}}
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	if err := route.Load(servers, stateFile); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { route.Load(config.GetConfig().Servers, "") })
+
+	yaml := configHash(servers)
+	if err := route.GetRegistry("family").SetDisabled("gd", true); err != nil {
+		t.Fatal(err)
+	}
+	changed := configHash(servers)
+	if changed == yaml {
+		t.Error("disabling a backend at runtime did not change the config hash")
+	}
+
+	// After a restart the state file overlay is applied again and the hash matches the snapshot
+	if err := route.Load(servers, stateFile); err != nil {
+		t.Fatal(err)
+	}
+	if got := configHash(servers); got != changed {
+		t.Error("config hash differs after reloading the state file")
+	}
+}
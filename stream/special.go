@@ -0,0 +1,93 @@
+package stream
+
+import (
+	"Go_Frontend/config"
+	"Go_Frontend/schedule"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// scheduledMedia 带有已编译时间规则的特殊媒体
+type scheduledMedia struct {
+	media    config.SpecialMediaConfig
+	schedule schedule.Matcher
+}
+
+var (
+	// specialSchedules 每个服务器按优先级排好序的特殊媒体，启动时编译后只读
+	specialSchedules = make(map[string][]scheduledMedia)
+	// specialLocation 时间规则所在的时区
+	specialLocation = time.Local
+)
+
+// defaultSchedules 内置 key 未配置 Schedule 时使用的规则
+var defaultSchedules = map[string]schedule.Matcher{
+	// Remember the Mukden Incident (September 18 Incident). Code has no country, but developers do.
+	// Remember history, never forget the national humiliation, and hope for world peace.
+	"September18": mustCompile(config.ScheduleRuleConfig{Yearly: "09-18", Hours: "09:00-10:00"}),
+	"October1":    mustCompile(config.ScheduleRuleConfig{Yearly: "10-01", Hours: "09:00-10:00"}),
+	// Remember the victims of the Nanjing Massacre. Code has no country, but developers do.
+	// Remember history, never forget the national humiliation, and hope for world peace.
+	"December13":        mustCompile(config.ScheduleRuleConfig{Yearly: "12-13", Hours: "09:00-10:00"}),
+	"ChineseNewYearEve": mustCompile(config.ScheduleRuleConfig{Festival: "NewYearEve", Hours: "19:00-01:00"}),
+}
+
+func mustCompile(rules ...config.ScheduleRuleConfig) schedule.Schedule {
+	compiled, err := schedule.Compile(rules)
+	if err != nil {
+		panic(err)
+	}
+	return compiled
+}
+
+// InitializeSpecialMedia compiles the schedules of every server's special media, to be evaluated
+// in timezone (the local timezone when empty). Media with neither a schedule nor a built-in key
+// are only played by key (MediaMissing, GeoIP blocks).
+func InitializeSpecialMedia(servers []config.ServerConfig, timezone string) error {
+	location := time.Local
+	if timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(timezone); err != nil {
+			return fmt.Errorf("timezone: %w", err)
+		}
+	}
+	schedules := make(map[string][]scheduledMedia, len(servers))
+	for _, server := range servers {
+		var scheduled []scheduledMedia
+		for _, media := range server.SpecialMedias {
+			matcher, err := compileSpecialMedia(media)
+			if err != nil {
+				return fmt.Errorf("server %s special media %q: %w", server.Name, media.Key, err)
+			}
+			if matcher != nil {
+				scheduled = append(scheduled, scheduledMedia{media: media, schedule: matcher})
+			}
+		}
+		// 稳定排序，优先级相同时保持配置顺序
+		sort.SliceStable(scheduled, func(i, j int) bool {
+			return scheduled[i].media.Priority > scheduled[j].media.Priority
+		})
+		schedules[server.Name] = scheduled
+	}
+	specialSchedules, specialLocation = schedules, location
+	return nil
+}
+
+func compileSpecialMedia(media config.SpecialMediaConfig) (schedule.Matcher, error) {
+	if len(media.Schedule) == 0 {
+		return defaultSchedules[media.Key], nil
+	}
+	return schedule.Compile(media.Schedule)
+}
+
+// getMediaForSpecialDate 返回 t 时刻应播放的特殊媒体，没有则返回空配置
+func getMediaForSpecialDate(server *config.ServerConfig, t time.Time) config.SpecialMediaConfig {
+	t = t.In(specialLocation)
+	for _, scheduled := range specialSchedules[server.Name] {
+		if scheduled.schedule.Match(t) {
+			return scheduled.media
+		}
+	}
+	return config.SpecialMediaConfig{}
+}
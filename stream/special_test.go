@@ -0,0 +1,59 @@
+package stream
+
+import (
+	"Go_Frontend/config"
+	"testing"
+	"time"
+)
+
+func TestGetMediaForSpecialDate(t *testing.T) {
+	savedSchedules, savedLocation := specialSchedules, specialLocation
+	t.Cleanup(func() { specialSchedules, specialLocation = savedSchedules, savedLocation })
+
+	special := func(key string, priority int, rules ...config.ScheduleRuleConfig) config.SpecialMediaConfig {
+		return config.SpecialMediaConfig{Key: key, Name: key, MediaPath: "specialMedia/" + key,
+			ItemId: key + "-item", MediaSourceID: key + "-source", Schedule: rules, Priority: priority}
+	}
+	server := config.ServerConfig{Name: "special", SpecialMedias: []config.SpecialMediaConfig{
+		special("MediaMissing", 0),
+		special("Weekend", 0, config.ScheduleRuleConfig{Weekdays: []string{"sat", "sun"}}),
+		special("Promo", 0, config.ScheduleRuleConfig{Dates: "2026-09-19..2026-09-20"}),
+		special("September18", 10),
+		special("Morning", 5, config.ScheduleRuleConfig{Hours: "09:00-12:00"}),
+	}}
+	if err := InitializeSpecialMedia([]config.ServerConfig{server}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		at   string
+		want string
+	}{
+		{"2026-09-18 09:30", "September18"}, // built-in rule, highest priority
+		{"2026-09-18 10:30", "Morning"},
+		{"2026-09-19 08:00", "Weekend"}, // same priority: config order
+		{"2026-09-21 08:00", ""},
+	}
+	for _, test := range tests {
+		now, _ := time.ParseInLocation("2006-01-02 15:04", test.at, time.Local)
+		if got := getMediaForSpecialDate(&server, now).Key; got != test.want {
+			t.Errorf("special media at %s = %q, want %q", test.at, got, test.want)
+		}
+	}
+
+	// Rules are evaluated in the configured timezone
+	if err := InitializeSpecialMedia([]config.ServerConfig{server}, "Asia/Shanghai"); err != nil {
+		t.Fatal(err)
+	}
+	if got := getMediaForSpecialDate(&server, time.Date(2026, 9, 18, 1, 30, 0, 0, time.UTC)).Key; got != "September18" {
+		t.Errorf("special media at 01:30 UTC (09:30 in Shanghai) = %q, want September18", got)
+	}
+	if err := InitializeSpecialMedia([]config.ServerConfig{server}, "Mars/Olympus"); err == nil {
+		t.Error("unknown timezone was accepted")
+	}
+
+	server.SpecialMedias = append(server.SpecialMedias, special("Broken", 0, config.ScheduleRuleConfig{Cron: "bad"}))
+	if err := InitializeSpecialMedia([]config.ServerConfig{server}, ""); err == nil {
+		t.Error("invalid schedule was accepted")
+	}
+}
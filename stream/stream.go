@@ -3,8 +3,13 @@ package stream
 import (
 	"Go_Frontend/api"
 	"Go_Frontend/config"
+	"Go_Frontend/geoip"
+	"Go_Frontend/library"
 	"Go_Frontend/logger"
-	"Go_Frontend/util"
+	"Go_Frontend/route"
+	"Go_Frontend/strm"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/sync/singleflight" // 需 go get
@@ -15,122 +20,266 @@ import (
 	"time"
 )
 
-var cache *Cache
-var globalTimeChecker util.TimeChecker
+var cache Cache
 var sfGroup singleflight.Group // 请求合并组
 
 func init() {
 	var err error
-	cache, err = NewCache(30 * time.Minute)
+	cache, err = NewMemoryCache(defaultCacheMaxEntries, defaultCacheTTL)
 	if err != nil {
 		logger.Error("Failed to initialize cache: %v", err)
 		os.Exit(1)
 	}
-	globalTimeChecker = util.TimeChecker{}
-	logger.Info("TimeChecker initialized successfully")
 }
 
 func HandleStreamRequest(c *gin.Context) {
 	logger.Info("Handling stream request...")
 	logRequestDetails(c)
 
-	itemID, mediaSourceID, mediaPath, isSpecialDate := fetchParameters(c)
-	if itemID == "" || mediaSourceID == "" {
+	server := resolveServer(c)
+	logger.Debug("Selected media server: %s", server.Name)
+
+	user, ok := authenticateRequest(c, server)
+	if !ok {
 		return
 	}
 
-	if _, found := handleCache(c, itemID, mediaSourceID); found {
+	location := geoip.Lookup(c.ClientIP())
+
+	var itemID, mediaSourceID, mediaPath string
+	var isSpecialDate bool
+	if geoip.Allowed(location) {
+		itemID, mediaSourceID, mediaPath, isSpecialDate = fetchParameters(c, server, user, location)
+	} else {
+		itemID, mediaSourceID, mediaPath, isSpecialDate = fetchBlockedMedia(c, server, location)
+	}
+	if itemID == "" || mediaSourceID == "" {
 		return
 	}
 
-	var err error
-	mediaPath, err = fetchMediaPathIfNeeded(itemID, mediaSourceID, mediaPath, isSpecialDate)
+	media, err := fetchMediaSourceIfNeeded(c.Request.Context(), server, itemID, mediaSourceID, mediaPath, isSpecialDate)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	streamingURL, err := generateAndCacheURL(itemID, mediaSourceID, mediaPath)
+	// 每个请求单独签名，链接总有完整的有效期
+	streamingURL, _, err := generateStreamingURL(server, media, itemID, mediaSourceID, location)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	logger.Info("Redirecting to streaming URL: %s", streamingURL)
+	logger.Info("Redirecting to streaming URL: %s (server: %s, user: %s, client: %s)", streamingURL, server.Name, userName(user), location)
 	c.Header("Location", streamingURL)
 	c.Status(http.StatusFound)
 }
 
-func fetchParameters(c *gin.Context) (string, string, string, bool) {
+// fetchParameters 确定要播放的条目和媒体源。特殊媒体是配置中的占位条目，不做用户权限检查；
+// 其他条目先检查权限，再为缺少 MediaSourceId 的请求查询媒体源，拒绝的请求不会访问媒体服务器
+func fetchParameters(c *gin.Context, server *config.ServerConfig, user *api.User, location geoip.Location) (string, string, string, bool) {
 	currentTime := time.Now()
-	specialConfig := getMediaForSpecialDate(currentTime)
+	specialConfig := getMediaForSpecialDate(server, currentTime)
 	if specialConfig.IsValid() {
 		logger.Info("Special date detected.")
 		return specialConfig.ItemId, specialConfig.MediaSourceID, specialConfig.MediaPath, true
 	}
 
 	itemID := c.Param("itemID")
-	mediaSourceID := c.Query("MediaSourceId")
-	if itemID == "" || mediaSourceID == "" {
-		logger.Warn("Missing itemID or MediaSourceId")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing itemID or MediaSourceId"})
+	if itemID == "" {
+		logger.Warn("Missing itemID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing itemID"})
 		return "", "", "", false
 	}
+
+	if !authorizeItem(c, server, user, itemID, location) {
+		return "", "", "", false
+	}
+
+	// 部分第三方客户端和脚本不带 MediaSourceId，按配置的策略从条目的媒体源中选择
+	mediaSourceID := queryParam(c, "MediaSourceId")
+	if mediaSourceID == "" {
+		var err error
+		mediaSourceID, err = defaultMediaSource(c, server, itemID)
+		if err != nil {
+			logger.Error("Failed to select a media source of item %s: %v", itemID, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to select a media source"})
+			return "", "", "", false
+		}
+	}
 	return itemID, mediaSourceID, "", false
 }
 
-// 优化：fetchMediaPath 增加 Singleflight 防击穿
-func fetchMediaPath(itemID, mediaSourceID string) (string, error) {
-	key := fmt.Sprintf("mp:%s:%s", itemID, mediaSourceID)
+// queryParam 不区分大小写读取查询参数，Jellyfin 客户端会发送 mediaSourceId
+func queryParam(c *gin.Context, name string) string {
+	if value := c.Query(name); value != "" {
+		return value
+	}
+	for key, values := range c.Request.URL.Query() {
+		if strings.EqualFold(key, name) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// fetchBlockedMedia 处理被地域策略拦截的请求：配置了替代媒体则播放替代媒体，否则返回 403
+func fetchBlockedMedia(c *gin.Context, server *config.ServerConfig, location geoip.Location) (string, string, string, bool) {
+	logger.Warn("Request blocked by GeoIP policy (client: %s)", location)
 
+	geoCfg := config.GetConfig().GeoIP
+	if strings.EqualFold(geoCfg.BlockAction, "media") {
+		media := getMediaForKey(server, geoCfg.BlockMediaKey)
+		if media.IsValid() {
+			return media.ItemId, media.MediaSourceID, media.MediaPath, true
+		}
+		logger.Error("GeoIP block media %s is not configured, falling back to 403", geoCfg.BlockMediaKey)
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{"error": "Not available in your region"})
+	return "", "", "", false
+}
+
+// 优化：fetchMediaSource 增加 Singleflight 防击穿
+// 启用媒体库索引时先查索引，再查路径缓存，都未命中才请求 PlaybackInfo
+func fetchMediaSource(ctx context.Context, server *config.ServerConfig, itemID, mediaSourceID string) (*api.MediaSourceInfo, error) {
+	if media, ok := library.Lookup(server.Name, itemID, mediaSourceID); ok {
+		logger.Debug("Found media path in library index: %s", media.Path)
+		return media, nil
+	}
+
+	key := pathCacheKey(server, itemID, mediaSourceID)
+	var stale *api.MediaSourceInfo
+	if entry, found := loadPathEntry(key); found {
+		now := time.Now()
+		switch {
+		case entry.Source == nil:
+			cacheStats.negativeHits.Add(1)
+			return nil, fmt.Errorf("item %s: %w (cached)", itemID, api.ErrMediaSourceNotFound)
+		case entry.fresh(now):
+			logger.Debug("Path cache hit for key: %s", key)
+			cacheStats.hits.Add(1)
+			return entry.media(mediaSourceID), nil
+		case entry.within(now, staleWhileRevalidate):
+			logger.Debug("Serving stale media path of %s while revalidating", key)
+			cacheStats.staleServed.Add(1)
+			revalidate(server, itemID, mediaSourceID, key)
+			return entry.media(mediaSourceID), nil
+		case entry.within(now, staleIfError):
+			stale = entry.media(mediaSourceID)
+		}
+	}
+	cacheStats.misses.Add(1)
+
+	// 多实例部署时同一条目只由一个实例解析，其他实例等待它写入共享缓存
+	entry, release := lockResolve(ctx, key)
+	defer release()
+	if entry != nil {
+		logger.Debug("Using media path resolved by another instance: %s", key)
+		if entry.Source == nil {
+			return nil, fmt.Errorf("item %s: %w (cached)", itemID, api.ErrMediaSourceNotFound)
+		}
+		return entry.media(mediaSourceID), nil
+	}
+
+	media, err := resolveMediaSource(ctx, server, itemID, mediaSourceID, key)
+	// 媒体服务器不可用时使用过期的路径；条目已删除 (ErrNotFound) 则不使用
+	if err != nil && stale != nil && !errors.Is(err, api.ErrNotFound) && ctx.Err() == nil {
+		logger.Warn("Serving stale media path of %s: %v", key, err)
+		cacheStats.staleOnError.Add(1)
+		return stale, nil
+	}
+	return media, err
+}
+
+// resolveMediaSource 向媒体服务器解析媒体源并写入路径缓存，条目或媒体源不存在时写入负缓存
+func resolveMediaSource(ctx context.Context, server *config.ServerConfig, itemID, mediaSourceID, key string) (*api.MediaSourceInfo, error) {
 	// 合并并发请求，同一时刻只有一个请求会真正打到 Emby
-	v, err, _ := sfGroup.Do(key, func() (interface{}, error) {
-		embyAPI := api.NewEmbyAPI()
-		return embyAPI.GetMediaPath(itemID, mediaSourceID)
+	v, err := sharedCall(ctx, "mp:"+key, func(ctx context.Context) (interface{}, error) {
+		media, err := api.NewMediaServer(server).GetMediaSource(ctx, itemID, mediaSourceID)
+		switch {
+		case err == nil:
+			storeMediaSource(key, media)
+		case errors.Is(err, api.ErrNotFound):
+			storeMissing(key)
+		}
+		return media, err
 	})
 
 	if err != nil {
 		logger.Error("Failed to fetch media path (merged): %v", err)
-		return "", err
+		return nil, err
 	}
 	// 不再在此处做路径截取，保留完整原始路径供 generateStreamingURL 匹配
-	return v.(string), nil
+	return v.(*api.MediaSourceInfo), nil
 }
 
-// 优化：多后端匹配 + 快速拼接
-func generateStreamingURL(mediaPath, itemID, mediaSourceID string) (string, error) {
-	cfg := config.GetConfig()
-	
-	var selectedBackend config.BackendConfig
-	var finalPath string
-	matched := false
-
-	// config.go 中已保证 Backends 按 Path 长度降序排列
-	for _, backend := range cfg.Backends {
-		if strings.HasPrefix(mediaPath, backend.Path) {
-			selectedBackend = backend
-			// 截取路径
-			finalPath = mediaPath[len(backend.Path):]
-			finalPath = strings.TrimPrefix(finalPath, "/")
-			matched = true
-			logger.Info("Matched backend: %s", backend.Name)
-			break
+// revalidate 在后台重新解析过期的路径，期间的请求继续使用旧路径。sharedCall 保证同一条目同时只解析一次
+func revalidate(server *config.ServerConfig, itemID, mediaSourceID, key string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), revalidateTimeout)
+		defer cancel()
+		if _, err := resolveMediaSource(ctx, server, itemID, mediaSourceID, key); err != nil {
+			logger.Warn("Failed to revalidate media path %s: %v", key, err)
 		}
+	}()
+}
+
+// 优化：多后端匹配 + 快速拼接
+// signed 为 false 表示直接重定向到 STRM 远程地址，该地址不带本服务的签名
+func generateStreamingURL(server *config.ServerConfig, media *api.MediaSourceInfo, itemID, mediaSourceID string, location geoip.Location) (streamingURL string, signed bool, err error) {
+	if strm.IsRemote(media.Path) {
+		return generateRemoteURL(server, media, itemID, mediaSourceID, location)
 	}
 
+	// 路径段前缀树匹配：/mnt/gd 不会误匹配 /mnt/gd2/...
+	selectedBackend, finalPath, matched := route.GetRegistry(server.Name).Match(media.Path)
 	if !matched {
-		logger.Error("No matching backend found for: %s", mediaPath)
-		return "", fmt.Errorf("no matching backend configuration")
+		logger.Error("No matching backend found for: %s", media.Path)
+		return "", false, fmt.Errorf("no matching backend configuration")
+	}
+	logger.Info("Matched backend: %s", selectedBackend.Name)
+
+	// 地域镜像：按客户端国家/ASN 选择最近的节点
+	streamingURL, err = signStreamingURL(geoip.ResolveURL(selectedBackend, location), finalPath, itemID, mediaSourceID, signedHints(media))
+	return streamingURL, err == nil, err
+}
+
+// generateRemoteURL 处理 STRM 条目：按规则改写到后端并签名，或直接重定向到 (必要时已签名的) 远程地址
+func generateRemoteURL(server *config.ServerConfig, media *api.MediaSourceInfo, itemID, mediaSourceID string, location geoip.Location) (string, bool, error) {
+	expireAt := time.Now().Unix() + int64(config.GetConfig().PlayURLMaxAliveTime)
+	decision, err := strm.Resolve(media.Path, expireAt)
+	if err != nil {
+		logger.Warn("Remote media %s not served: %v", media.Path, err)
+		return "", false, err
+	}
+	if decision.Backend == "" {
+		logger.Info("Redirecting STRM item %s to its remote url", itemID)
+		return decision.URL, false, nil
 	}
 
+	backend, err := route.GetRegistry(server.Name).Get(decision.Backend)
+	if err != nil || backend.Disabled {
+		logger.Error("STRM rule %d points at unavailable backend %s", decision.Rule, decision.Backend)
+		return "", false, fmt.Errorf("backend %s is not available", decision.Backend)
+	}
+	logger.Info("Rewrote STRM url onto backend: %s", backend.Name)
+	streamingURL, err := signStreamingURL(geoip.ResolveURL(backend, location), decision.RelativePath, itemID, mediaSourceID, signedHints(media))
+	return streamingURL, err == nil, err
+}
+
+// signStreamingURL 生成签名并拼接后端播放地址，hints 为写入签名的媒体信息
+func signStreamingURL(backendURL, finalPath, itemID, mediaSourceID string, hints map[string]interface{}) (string, error) {
+	cfg := config.GetConfig()
+
 	signatureInstance, _ := GetSignatureInstance()
 	expireAt := time.Now().Unix() + int64(cfg.PlayURLMaxAliveTime)
-	signature, err := signatureInstance.Encrypt(itemID, mediaSourceID, expireAt)
+	signature, err := signatureInstance.EncryptWithClaims(itemID, mediaSourceID, expireAt, hints)
 	if err != nil {
 		return "", err
 	}
 
-	backendBaseURL := strings.TrimSuffix(selectedBackend.URL, "/")
+	backendBaseURL := strings.TrimSuffix(backendURL, "/")
 	
 	// 性能优化：Builder 拼接
 	var b strings.Builder
@@ -144,87 +293,63 @@ func generateStreamingURL(mediaPath, itemID, mediaSourceID string) (string, erro
 	return b.String(), nil
 }
 
-// ... 下面函数保持不变：getMediaForSpecialDate, getMediaForMissingMedia, handleCache, validateSignature, generateAndCacheURL, fetchMediaPathIfNeeded
-// (为节省篇幅省略，请使用原有逻辑，只需注意 fetchMediaPathIfNeeded 内部调用的是我们修改过的 fetchMediaPath)
-
-func getMediaForSpecialDate(t time.Time) config.SpecialMediaConfig {
-	// ... 保持原样 ...
-	// 需注意引用 config.GetConfig().SpecialMedias
-	specialMedias := config.GetConfig().SpecialMedias
-	// ... 循环逻辑保持原样 ...
-	for _, media := range specialMedias {
-		switch media.Key {
-		case "ChineseNewYearEve":
-			if globalTimeChecker.IsChineseNewYearEve(t) { return media }
-		case "October1":
-			if globalTimeChecker.IsOctober1Morning(t) { return media }
-		case "December13":
-			if globalTimeChecker.IsDecember13Morning(t) { return media }
-		case "September18":
-			if globalTimeChecker.IsSeptember18Morning(t) { return media }
-		}
-	}
-	return config.SpecialMediaConfig{}
+func getMediaForMissingMedia(server *config.ServerConfig) config.SpecialMediaConfig {
+	return getMediaForKey(server, "MediaMissing")
 }
 
-func getMediaForMissingMedia() config.SpecialMediaConfig {
-	specialMedias := config.GetConfig().SpecialMedias
+func getMediaForKey(server *config.ServerConfig, key string) config.SpecialMediaConfig {
+	specialMedias := server.SpecialMedias
 	for _, media := range specialMedias {
-		if media.Key == "MediaMissing" { return media }
+		if media.Key == key { return media }
 	}
 	return config.SpecialMediaConfig{}
 }
 
-func handleCache(c *gin.Context, itemID, mediaSourceID string) (string, bool) {
-	cacheKey := fmt.Sprintf("%s:%s", itemID, mediaSourceID)
-	if cachedURL, found := cache.Get(cacheKey); found {
-		logger.Info("Cache hit for key: %s", cacheKey)
-		if validateSignature(cachedURL) {
-			logger.Debug("Valid signature cache hit")
-			c.Header("Location", cachedURL)
-			c.Status(http.StatusFound)
-			return cachedURL, true
+// fetchMediaSourceIfNeeded 特殊媒体只有配置中的路径，没有元数据
+func fetchMediaSourceIfNeeded(ctx context.Context, server *config.ServerConfig, itemID, mediaSourceID, mediaPath string, isSpecialDate bool) (*api.MediaSourceInfo, error) {
+	if isSpecialDate {
+		return &api.MediaSourceInfo{ID: mediaSourceID, Path: mediaPath}, nil
+	}
+	media, err := fetchMediaSource(ctx, server, itemID, mediaSourceID)
+	if err != nil {
+		// 客户端已断开，不再回退到默认媒体
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		missing := getMediaForMissingMedia(server)
+		if missing.ItemId != "" {
+			return &api.MediaSourceInfo{ID: missing.MediaSourceID, Path: missing.MediaPath}, nil // 使用默认媒体
 		}
+		return nil, err
 	}
-	return "", false
+	return media, nil
 }
 
-func fetchMediaPathIfNeeded(itemID, mediaSourceID, mediaPath string, isSpecialDate bool) (string, error) {
-	if !isSpecialDate {
-		var err error
-		mediaPath, err = fetchMediaPath(itemID, mediaSourceID)
-		if err != nil {
-			missing := getMediaForMissingMedia()
-			if missing.ItemId != "" {
-				return missing.MediaPath, nil // 使用默认媒体
+// sharedCall 通过 singleflight 合并相同 key 的请求，并让每个调用方只等待到自己的 ctx 结束。
+// 共享调用使用发起者的 ctx；若发起者断开导致调用被取消，仍在等待的调用方会以自己的 ctx 重新发起。
+func sharedCall(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	for attempt := 0; ; attempt++ {
+		ch := sfGroup.DoChan(key, func() (interface{}, error) {
+			return fn(ctx)
+		})
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case res := <-ch:
+			if errors.Is(res.Err, context.Canceled) && ctx.Err() == nil && attempt < 3 {
+				continue
 			}
-			return "", err
+			return res.Val, res.Err
 		}
 	}
-	return mediaPath, nil
 }
 
-func generateAndCacheURL(itemID, mediaSourceID, mediaPath string) (string, error) {
-	streamingURL, err := generateStreamingURL(mediaPath, itemID, mediaSourceID)
-	if err != nil { return "", err }
-	
-	cacheKey := fmt.Sprintf("%s:%s", itemID, mediaSourceID)
-	_ = cache.Set(cacheKey, streamingURL)
-	return streamingURL, nil
-}
-
-func validateSignature(cachedURL string) bool {
-	// ... 保持原样 ...
-	signatureStart := "signature="
-	index := strings.Index(cachedURL, signatureStart)
-	if index == -1 { return false }
-	signature := cachedURL[index+len(signatureStart):]
-	inst, _ := GetSignatureInstance()
-	decoded, err := inst.Decrypt(signature)
-	if err != nil { return false }
-	expireAt, ok := decoded["expireAt"].(float64)
-	if !ok || int64(expireAt) <= time.Now().Unix() { return false }
-	return true
+// userName 用于日志，未启用认证时 user 为 nil
+func userName(user *api.User) string {
+	if user == nil {
+		return "-"
+	}
+	return user.Name
 }
 
 func logRequestDetails(c *gin.Context) {
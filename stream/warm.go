@@ -0,0 +1,219 @@
+package stream
+
+import (
+	"Go_Frontend/api"
+	"Go_Frontend/config"
+	"Go_Frontend/geoip"
+	"Go_Frontend/library"
+	"Go_Frontend/logger"
+	"Go_Frontend/util"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	warmCfg config.WarmConfig
+
+	// activeUsers 记录通过认证的用户最近一次请求的时间，键为 "server:userID"
+	activeUsers   = make(map[string]activeUser)
+	activeUsersMu sync.Mutex
+
+	// prefetched 已预取的媒体源，路径缓存时间内不重复预取
+	prefetched     = util.NewTTLCache[struct{}](defaultCacheTTL)
+	prefetchClient = &http.Client{Timeout: time.Minute}
+)
+
+type activeUser struct {
+	server   string
+	userID   string
+	lastSeen time.Time
+}
+
+// InitializeWarm applies the cache warming configuration. Active users are only known from
+// authenticated requests, so warming requires Auth.
+func InitializeWarm(cfg config.WarmConfig) error {
+	if cfg.Enabled && !config.GetConfig().Auth.Enabled {
+		return errors.New("Warm requires Auth: active users are taken from authenticated requests")
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Minute
+	}
+	if cfg.ActiveWindow <= 0 {
+		cfg.ActiveWindow = 24 * time.Hour
+	}
+	if cfg.Limit <= 0 {
+		cfg.Limit = 10
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 2
+	}
+	if cfg.RatePerSecond <= 0 {
+		cfg.RatePerSecond = 5
+	}
+	warmCfg = cfg
+	prefetched = util.NewTTLCache[struct{}](cacheTTL)
+	return nil
+}
+
+// noteActiveUser 记录播放过的用户，供预热选择
+func noteActiveUser(server *config.ServerConfig, user *api.User) {
+	if !warmCfg.Enabled {
+		return
+	}
+	activeUsersMu.Lock()
+	defer activeUsersMu.Unlock()
+	activeUsers[serverKey(server, user.ID)] = activeUser{server: server.Name, userID: user.ID, lastSeen: time.Now()}
+}
+
+// recentUsers 返回 since 之后出现过的用户，并清除更早的记录
+func recentUsers(since time.Time) []activeUser {
+	activeUsersMu.Lock()
+	defer activeUsersMu.Unlock()
+	users := make([]activeUser, 0, len(activeUsers))
+	for key, user := range activeUsers {
+		if user.lastSeen.Before(since) {
+			delete(activeUsers, key)
+			continue
+		}
+		users = append(users, user)
+	}
+	return users
+}
+
+// StartWarmer warms the path cache every Interval until ctx is done. It returns immediately.
+func StartWarmer(ctx context.Context) {
+	if !warmCfg.Enabled {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(warmCfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				warmOnce(ctx)
+			}
+		}
+	}()
+}
+
+// rateLimiter 以固定间隔放行请求，不累积突发
+type rateLimiter struct {
+	ticker *time.Ticker
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	return &rateLimiter{ticker: time.NewTicker(time.Duration(float64(time.Second) / perSecond))}
+}
+
+func (l *rateLimiter) wait(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-l.ticker.C:
+		return true
+	}
+}
+
+// warmOnce 为每个活跃用户查询继续观看和下一集列表，把尚未缓存的媒体源路径写入缓存。
+// 列表已带有媒体源路径，不需要再请求 PlaybackInfo
+func warmOnce(ctx context.Context) {
+	users := recentUsers(time.Now().Add(-warmCfg.ActiveWindow))
+	if len(users) == 0 {
+		return
+	}
+	limiter := newRateLimiter(warmCfg.RatePerSecond)
+	defer limiter.ticker.Stop()
+
+	var warmed atomic.Int64
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, warmCfg.Concurrency)
+	for _, user := range users {
+		server := config.GetServer(user.server)
+		if server == nil || server.Type == config.ServerTypePlex {
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			warmed.Add(int64(warmUser(ctx, server, user.userID, limiter)))
+		}()
+	}
+	wg.Wait()
+	logger.Info("Cache warming: %d media paths resolved ahead for %d active users", warmed.Load(), len(users))
+}
+
+func warmUser(ctx context.Context, server *config.ServerConfig, userID string, limiter *rateLimiter) int {
+	// 继续观看和下一集各一次请求
+	if !limiter.wait(ctx) || !limiter.wait(ctx) {
+		return 0
+	}
+	items, err := api.NewMediaServer(server).ListUpcoming(ctx, userID, warmCfg.Limit)
+	if err != nil {
+		logger.Warn("Cache warming for user %s on server %s failed: %v", userID, server.Name, err)
+	}
+
+	warmed := 0
+	now := time.Now()
+	for _, item := range items {
+		for i := range item.MediaSources {
+			media := &item.MediaSources[i]
+			if media.Path == "" {
+				continue
+			}
+			if _, indexed := library.Lookup(server.Name, item.ID, media.ID); !indexed {
+				key := pathCacheKey(server, item.ID, media.ID)
+				if entry, found := loadPathEntry(key); !found || entry.Source == nil || !entry.fresh(now) {
+					storeMediaSource(key, media)
+					warmed++
+				}
+			}
+			prefetch(ctx, server, item.ID, media, limiter)
+		}
+	}
+	return warmed
+}
+
+// prefetch 按签名链接请求后端文件开头的 PrefetchBytes 字节，让后端提前拉取到自己的缓存
+func prefetch(ctx context.Context, server *config.ServerConfig, itemID string, media *api.MediaSourceInfo, limiter *rateLimiter) {
+	if warmCfg.PrefetchBytes <= 0 {
+		return
+	}
+	key := pathCacheKey(server, itemID, media.ID)
+	if _, done := prefetched.Get(key); done {
+		return
+	}
+	// 远程 STRM 地址不属于任何后端，不预取
+	streamingURL, signed, err := generateStreamingURL(server, media, itemID, media.ID, geoip.Location{})
+	if err != nil || !signed || !limiter.wait(ctx) {
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamingURL, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", warmCfg.PrefetchBytes-1))
+	resp, err := prefetchClient.Do(req)
+	if err != nil {
+		logger.Warn("Prefetch of item %s failed: %v", itemID, err)
+		return
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, warmCfg.PrefetchBytes))
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		logger.Warn("Prefetch of item %s returned %s", itemID, resp.Status)
+		return
+	}
+	prefetched.Set(key, struct{}{})
+	logger.Debug("Prefetched the first %d bytes of item %s", warmCfg.PrefetchBytes, itemID)
+}
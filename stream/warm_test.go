@@ -0,0 +1,101 @@
+package stream
+
+import (
+	"Go_Frontend/api"
+	"Go_Frontend/config"
+	"Go_Frontend/route"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWarmUser(t *testing.T) {
+	emby := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/Users/u1/Items/Resume":
+			w.Write([]byte(`{"Items": [{"Id": "1", "MediaSources": [{"Id": "a", "Path": "/mnt/gd/Show/S01E01.mkv"}]}]}`))
+		case "/Shows/NextUp":
+			if r.URL.Query().Get("UserId") != "u1" {
+				t.Errorf("NextUp queried for user %q", r.URL.Query().Get("UserId"))
+			}
+			w.Write([]byte(`{"Items": [{"Id": "2", "MediaSources": [{"Id": "b", "Path": "/mnt/gd/Show/S01E02.mkv"}]}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(emby.Close)
+
+	var ranges atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=0-1023" {
+			ranges.Add(1)
+		}
+		w.WriteHeader(http.StatusPartialContent)
+	}))
+	t.Cleanup(backend.Close)
+
+	if err := InitializeSignature("vPQC5LWCN2CW2opz"); err != nil {
+		t.Fatal(err)
+	}
+	server := config.ServerConfig{
+		Name:     "warm",
+		Type:     config.ServerTypeEmby,
+		URL:      emby.URL,
+		Backends: []config.BackendConfig{{Name: "gd", URL: backend.URL, Path: "/mnt/gd"}},
+	}
+	if err := route.Load([]config.ServerConfig{server}, ""); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { route.Load(config.GetConfig().Servers, "") })
+
+	savedCache, savedCfg, savedPrefetched := cache, warmCfg, prefetched
+	t.Cleanup(func() { cache, warmCfg, prefetched = savedCache, savedCfg, savedPrefetched })
+	cache = newTestMemoryCache(t, 10)
+	warmCfg = config.WarmConfig{Enabled: true, Limit: 10, PrefetchBytes: 1024}
+	limiter := newRateLimiter(1000)
+	defer limiter.ticker.Stop()
+
+	if warmed := warmUser(context.Background(), &server, "u1", limiter); warmed != 2 {
+		t.Errorf("warmed %d media paths, want 2", warmed)
+	}
+	if cached, found := LookupCachedPath(&server, "2", "b"); !found || cached.Path != "/mnt/gd/Show/S01E02.mkv" {
+		t.Errorf("next-up episode not cached: %+v", cached)
+	}
+	if n := ranges.Load(); n != 2 {
+		t.Errorf("backend received %d prefetch requests, want 2", n)
+	}
+
+	// Already cached and prefetched media sources are left alone on the next round
+	if warmed := warmUser(context.Background(), &server, "u1", limiter); warmed != 0 {
+		t.Errorf("warmed %d cached media paths again", warmed)
+	}
+	if n := ranges.Load(); n != 2 {
+		t.Errorf("backend received %d prefetch requests after the second round, want 2", n)
+	}
+}
+
+func TestRecentUsers(t *testing.T) {
+	savedCfg := warmCfg
+	warmCfg.Enabled = true
+	t.Cleanup(func() { warmCfg = savedCfg })
+
+	server := &config.ServerConfig{Name: "recent"}
+	noteActiveUser(server, &api.User{ID: "old"})
+	activeUsersMu.Lock()
+	old := activeUsers["recent:old"]
+	old.lastSeen = time.Now().Add(-2 * time.Hour)
+	activeUsers["recent:old"] = old
+	activeUsersMu.Unlock()
+	noteActiveUser(server, &api.User{ID: "new"})
+
+	users := recentUsers(time.Now().Add(-time.Hour))
+	if len(users) != 1 || users[0].userID != "new" {
+		t.Errorf("recentUsers = %+v, want only the recent user", users)
+	}
+	if _, found := activeUsers["recent:old"]; found {
+		t.Error("inactive user was not forgotten")
+	}
+}
@@ -0,0 +1,56 @@
+package strm
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Signer adds the signature a remote server expects to a redirect target.
+type Signer interface {
+	// Sign signs u in place; the signature should stay valid until expireAt (Unix seconds).
+	Sign(u *url.URL, expireAt int64) error
+}
+
+// signers maps the Signer names accepted in StrmRuleConfig to their constructors.
+var signers = map[string]func(secret string) (Signer, error){
+	"alist": newAlistSigner,
+}
+
+// alistSigner produces the "sign" query parameter of AList download links:
+// base64url(HMAC-SHA256(token, path + ":" + expire)) + ":" + expire,
+// where path is the file path without the /d or /p route prefix.
+type alistSigner struct {
+	secret []byte
+}
+
+func newAlistSigner(secret string) (Signer, error) {
+	if secret == "" {
+		return nil, errors.New("alist signer needs the AList token as secret")
+	}
+	return &alistSigner{secret: []byte(secret)}, nil
+}
+
+func (s *alistSigner) Sign(u *url.URL, expireAt int64) error {
+	filePath := u.Path
+	for _, route := range []string{"/d/", "/p/"} {
+		if rest, ok := strings.CutPrefix(filePath, route); ok {
+			filePath = "/" + rest
+			break
+		}
+	}
+
+	expire := strconv.FormatInt(expireAt, 10)
+	mac := hmac.New(sha256.New, s.secret)
+	io.WriteString(mac, filePath+":"+expire)
+
+	query := u.Query()
+	query.Set("sign", base64.URLEncoding.EncodeToString(mac.Sum(nil))+":"+expire)
+	u.RawQuery = query.Encode()
+	return nil
+}
@@ -0,0 +1,140 @@
+// Package strm handles media sources whose path is a remote http(s) URL, as produced by
+// Emby libraries built from .strm files. Such a URL is either rewritten onto one of the
+// configured backends or returned as a redirect target, signed when the remote needs it.
+package strm
+
+import (
+	"Go_Frontend/config"
+	"Go_Frontend/util"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Actions for remote URLs that match no rule.
+const (
+	ActionRedirect = "redirect"
+	ActionReject   = "reject"
+)
+
+// ErrRejected is returned when remote URLs are not allowed for the matched rule or by default.
+var ErrRejected = errors.New("remote media is not allowed")
+
+// Decision is the outcome of resolving a remote URL.
+type Decision struct {
+	// Backend and RelativePath are set when the URL was rewritten onto a backend.
+	Backend      string `json:"backend,omitempty"`
+	RelativePath string `json:"relativePath,omitempty"`
+	// URL is the redirect target otherwise, already signed when the rule has a signer.
+	URL string `json:"url,omitempty"`
+	// Rule is the index of the matching rule, or -1 when the default action applied.
+	Rule int `json:"rule"`
+}
+
+type rule struct {
+	config.StrmRuleConfig
+	prefix string
+	signer Signer
+}
+
+var (
+	defaultAction = ActionRedirect
+	rules         []rule
+)
+
+// Initialize validates and installs the STRM rules.
+func Initialize(cfg config.StrmConfig) error {
+	action := strings.ToLower(cfg.Action)
+	switch action {
+	case "":
+		action = ActionRedirect
+	case ActionRedirect, ActionReject:
+	default:
+		return fmt.Errorf("unknown Strm action %q", cfg.Action)
+	}
+
+	compiled := make([]rule, 0, len(cfg.Rules))
+	for i, ruleCfg := range cfg.Rules {
+		if len(ruleCfg.Hosts) == 0 {
+			return fmt.Errorf("Strm rule %d: hosts are required", i)
+		}
+		r := rule{StrmRuleConfig: ruleCfg, prefix: strings.TrimRight(ruleCfg.PathPrefix, "/")}
+		if ruleCfg.Signer != "" {
+			if ruleCfg.Backend != "" {
+				return fmt.Errorf("Strm rule %d: a signer only applies to redirects, not to backend %s", i, ruleCfg.Backend)
+			}
+			newSigner, ok := signers[strings.ToLower(ruleCfg.Signer)]
+			if !ok {
+				return fmt.Errorf("Strm rule %d: unknown signer %q", i, ruleCfg.Signer)
+			}
+			signer, err := newSigner(ruleCfg.Secret)
+			if err != nil {
+				return fmt.Errorf("Strm rule %d: %w", i, err)
+			}
+			r.signer = signer
+		}
+		compiled = append(compiled, r)
+	}
+
+	defaultAction = action
+	rules = compiled
+	return nil
+}
+
+// IsRemote reports whether a media path is an http(s) URL rather than a file path.
+func IsRemote(mediaPath string) bool {
+	lower := strings.ToLower(mediaPath)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// Resolve applies the first rule matching remoteURL. expireAt (Unix seconds) bounds
+// the validity of signatures added to redirect targets.
+func Resolve(remoteURL string, expireAt int64) (Decision, error) {
+	u, err := url.Parse(remoteURL)
+	if err != nil {
+		return Decision{}, fmt.Errorf("invalid remote url: %w", err)
+	}
+
+	for i, r := range rules {
+		rest, ok := r.match(u)
+		if !ok {
+			continue
+		}
+		if r.Backend != "" {
+			return Decision{Backend: r.Backend, RelativePath: strings.TrimLeft(rest, "/"), Rule: i}, nil
+		}
+		if r.signer != nil {
+			if err := r.signer.Sign(u, expireAt); err != nil {
+				return Decision{}, err
+			}
+		}
+		return Decision{URL: u.String(), Rule: i}, nil
+	}
+
+	if defaultAction == ActionReject {
+		return Decision{Rule: -1}, ErrRejected
+	}
+	return Decision{URL: remoteURL, Rule: -1}, nil
+}
+
+// match reports whether u is on one of the rule's hosts and below its path prefix,
+// and returns the path below the prefix. The prefix only matches whole segments.
+func (r rule) match(u *url.URL) (string, bool) {
+	hostMatched := false
+	for _, pattern := range r.Hosts {
+		if util.MatchHost(pattern, u.Host) {
+			hostMatched = true
+			break
+		}
+	}
+	if !hostMatched {
+		return "", false
+	}
+
+	rest, ok := strings.CutPrefix(u.Path, r.prefix)
+	if !ok || (rest != "" && rest[0] != '/') {
+		return "", false
+	}
+	return rest, true
+}
@@ -0,0 +1,78 @@
+package strm
+
+import (
+	"Go_Frontend/config"
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	err := Initialize(config.StrmConfig{
+		Action: "reject",
+		Rules: []config.StrmRuleConfig{
+			{Hosts: []string{"alist.example.com"}, PathPrefix: "/d/gd", Backend: "GoogleDrive"},
+			{Hosts: []string{"*.cdn.example.com"}},
+			{Hosts: []string{"alist.example.com"}, Signer: "alist", Secret: "tok"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		url      string
+		want     Decision
+		rejected bool
+	}{
+		{url: "https://alist.example.com/d/gd/Movies/a%20b.mkv", want: Decision{Backend: "GoogleDrive", RelativePath: "Movies/a b.mkv", Rule: 0}},
+		{url: "https://a.cdn.example.com/x.mkv?t=1", want: Decision{URL: "https://a.cdn.example.com/x.mkv?t=1", Rule: 1}},
+		// "/d/gd2" is not below "/d/gd", so the signing rule applies
+		{url: "https://alist.example.com/d/gd2/a.mkv", want: Decision{URL: "https://alist.example.com/d/gd2/a.mkv?sign=", Rule: 2}},
+		{url: "https://elsewhere.example.com/a.mkv", rejected: true},
+	}
+	for _, tc := range cases {
+		got, err := Resolve(tc.url, 1700000000)
+		if tc.rejected {
+			if !errors.Is(err, ErrRejected) {
+				t.Errorf("Resolve(%q) error = %v, want ErrRejected", tc.url, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Resolve(%q): %v", tc.url, err)
+			continue
+		}
+		if tc.want.Rule == 2 {
+			// Only check the rule here; the signature itself is covered by TestAlistSigner
+			got.URL = got.URL[:len(tc.want.URL)]
+		}
+		if got != tc.want {
+			t.Errorf("Resolve(%q) = %+v, want %+v", tc.url, got, tc.want)
+		}
+	}
+}
+
+func TestAlistSigner(t *testing.T) {
+	signer, err := newAlistSigner("tok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("https://alist.example.com/d/gd/Movies/a%20b.mkv")
+	if err := signer.Sign(u, 1700000000); err != nil {
+		t.Fatal(err)
+	}
+	want := "Z1y5SuSKqh-lYrw6YgUgK62_8LLb-0ayInZpl4Udv5c=:1700000000"
+	if got := u.Query().Get("sign"); got != want {
+		t.Errorf("sign = %q, want %q", got, want)
+	}
+}
+
+func TestInitializeRejectsSignerOnBackendRule(t *testing.T) {
+	err := Initialize(config.StrmConfig{Rules: []config.StrmRuleConfig{
+		{Hosts: []string{"alist.example.com"}, Backend: "GoogleDrive", Signer: "alist", Secret: "tok"},
+	}})
+	if err == nil {
+		t.Error("Initialize accepted a signer on a backend rule")
+	}
+}
@@ -0,0 +1,52 @@
+package util
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// MatchHost reports whether host matches pattern. A pattern is either an exact host name
+// or "*.example.com", which matches subdomains at any depth but not example.com itself.
+// Both sides are normalized with NormalizeHost, so host may carry a port.
+func MatchHost(pattern, host string) bool {
+	pattern = NormalizeHost(pattern)
+	host = NormalizeHost(host)
+	if host == "" {
+		return false
+	}
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return strings.HasPrefix(suffix, ".") && len(host) > len(suffix) && strings.HasSuffix(host, suffix)
+	}
+	return pattern == host
+}
+
+// NormalizeHost strips the port, IPv6 brackets and a trailing dot, and lowercases the result.
+func NormalizeHost(host string) string {
+	host = strings.TrimSpace(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// MatchIP reports whether ip is one of the addresses or lies in one of the CIDR ranges
+// in patterns, the format accepted by gin's SetTrustedProxies. Invalid entries never match.
+func MatchIP(patterns []string, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, pattern := range patterns {
+		if strings.Contains(pattern, "/") {
+			if prefix, err := netip.ParsePrefix(pattern); err == nil && prefix.Contains(addr) {
+				return true
+			}
+		} else if other, err := netip.ParseAddr(pattern); err == nil && other.Unmap() == addr {
+			return true
+		}
+	}
+	return false
+}
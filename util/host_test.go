@@ -0,0 +1,48 @@
+package util
+
+import "testing"
+
+func TestMatchHost(t *testing.T) {
+	cases := []struct {
+		pattern, host string
+		want          bool
+	}{
+		{"family.example.com", "family.example.com", true},
+		{"family.example.com", "Family.Example.com", true},
+		{"family.example.com", "family.example.com:8443", true},
+		{"family.example.com", "friends.example.com", false},
+		{"*.example.com", "tv.friends.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "badexample.com", false},
+		{"*example.com", "badexample.com", false},
+		{"[::1]", "[::1]:8096", true},
+	}
+	for _, tc := range cases {
+		if got := MatchHost(tc.pattern, tc.host); got != tc.want {
+			t.Errorf("MatchHost(%q, %q) = %v, want %v", tc.pattern, tc.host, got, tc.want)
+		}
+	}
+}
+
+func TestMatchIP(t *testing.T) {
+	patterns := []string{"127.0.0.1", "::1", "10.0.0.0/8", "fd00::/8", "not-an-address"}
+	cases := []struct {
+		ip   string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"fd12::1", true},
+		{"127.0.0.2", false},
+		{"203.0.113.7", false},
+		{"", false},
+		{"not-an-address", false},
+	}
+	for _, tc := range cases {
+		if got := MatchIP(patterns, tc.ip); got != tc.want {
+			t.Errorf("MatchIP(%q) = %v, want %v", tc.ip, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultTTLCacheMaxEntries bounds a TTLCache created with NewTTLCache.
+const defaultTTLCacheMaxEntries = 100000
+
+// TTLCache is a small concurrency-safe map whose entries expire after a fixed TTL.
+// It is meant for short-lived lookups such as authenticated tokens, not for bulk data.
+type TTLCache[V any] struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]ttlEntry[V]
+	// order lists keys in the order they were set. Every entry lives for the same TTL, so this is
+	// also the order in which they expire. References to entries that have since been set again
+	// or deleted are skipped.
+	order []ttlRef
+}
+
+type ttlEntry[V any] struct {
+	value    V
+	expireAt time.Time
+}
+
+type ttlRef struct {
+	key      string
+	expireAt time.Time
+}
+
+// NewTTLCache creates a TTLCache with the given entry lifetime.
+func NewTTLCache[V any](ttl time.Duration) *TTLCache[V] {
+	return NewTTLCacheWithLimit[V](ttl, defaultTTLCacheMaxEntries)
+}
+
+// NewTTLCacheWithLimit creates a TTLCache that holds at most maxEntries entries, dropping the
+// oldest ones first.
+func NewTTLCacheWithLimit[V any](ttl time.Duration, maxEntries int) *TTLCache[V] {
+	return &TTLCache[V]{ttl: ttl, maxEntries: max(maxEntries, 1), entries: make(map[string]ttlEntry[V])}
+}
+
+// Get returns the value for key if it exists and has not expired.
+func (c *TTLCache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expireAt) {
+		delete(c.entries, key)
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// Set stores value under key. Each call sweeps the entries that expired since the previous one,
+// so the cost of sweeping is spread over the calls that added them.
+func (c *TTLCache[V]) Set(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	expireAt := now.Add(c.ttl)
+	c.entries[key] = ttlEntry[V]{value: value, expireAt: expireAt}
+	c.order = append(c.order, ttlRef{key: key, expireAt: expireAt})
+	c.sweep(now)
+}
+
+// sweep drops expired entries, and the oldest entries while the cache is over its limit, from
+// the front of order. Callers hold mu.
+func (c *TTLCache[V]) sweep(now time.Time) {
+	for len(c.order) > 0 {
+		ref := c.order[0]
+		entry, ok := c.entries[ref.key]
+		current := ok && entry.expireAt.Equal(ref.expireAt)
+		if current && !now.After(ref.expireAt) && len(c.entries) <= c.maxEntries {
+			break
+		}
+		if current {
+			delete(c.entries, ref.key)
+		}
+		c.order = c.order[1:]
+	}
+
+	// Keys that are set repeatedly or deleted leave stale references behind; rebuild once they
+	// outnumber the live entries
+	if len(c.order) > 2*len(c.entries)+64 {
+		order := make([]ttlRef, 0, len(c.entries))
+		for _, ref := range c.order {
+			if entry, ok := c.entries[ref.key]; ok && entry.expireAt.Equal(ref.expireAt) {
+				order = append(order, ref)
+			}
+		}
+		c.order = order
+	}
+}
+
+// Len returns the number of entries, including expired ones that have not been swept yet.
+func (c *TTLCache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Delete removes key.
+func (c *TTLCache[V]) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// DeleteFunc removes every entry for which fn returns true.
+func (c *TTLCache[V]) DeleteFunc(fn func(key string, value V) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for k, entry := range c.entries {
+		if fn(k, entry.value) {
+			delete(c.entries, k)
+			removed++
+		}
+	}
+	return removed
+}
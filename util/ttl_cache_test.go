@@ -0,0 +1,67 @@
+package util
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTTLCacheExpiry(t *testing.T) {
+	c := NewTTLCache[int](20 * time.Millisecond)
+	c.Set("a", 1)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get(a) = %v, %v", v, ok)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Error("expired entry was returned")
+	}
+
+	// Expired entries are swept by later calls to Set
+	for i := range 100 {
+		c.Set(fmt.Sprint(i), i)
+	}
+	time.Sleep(30 * time.Millisecond)
+	c.Set("b", 2)
+	if n := c.Len(); n != 1 {
+		t.Errorf("Len = %d after the old entries expired, want 1", n)
+	}
+}
+
+func TestTTLCacheLimit(t *testing.T) {
+	c := NewTTLCacheWithLimit[int](time.Hour, 3)
+	for i := range 5 {
+		c.Set(fmt.Sprint(i), i)
+	}
+	if n := c.Len(); n != 3 {
+		t.Fatalf("Len = %d, want 3", n)
+	}
+	for _, key := range []string{"0", "1"} {
+		if _, ok := c.Get(key); ok {
+			t.Errorf("oldest entry %s was kept", key)
+		}
+	}
+
+	// Setting a key again makes it the newest; deleted keys leave no trace behind
+	c.Set("2", 20)
+	c.Delete("3")
+	c.Set("5", 5)
+	c.Set("6", 6)
+	if _, ok := c.Get("4"); ok {
+		t.Error("entry 4 was kept over the refreshed entry 2")
+	}
+	for key, want := range map[string]int{"2": 20, "5": 5, "6": 6} {
+		if v, ok := c.Get(key); !ok || v != want {
+			t.Errorf("Get(%s) = %v, %v, want %d", key, v, ok, want)
+		}
+	}
+
+	// Repeatedly setting the same keys does not grow the bookkeeping without bound
+	for i := range 10000 {
+		c.Set("hot", i)
+	}
+	if n := len(c.order); n > 2*c.Len()+64 {
+		t.Errorf("order holds %d references for %d entries", n, c.Len())
+	}
+}
@@ -0,0 +1,166 @@
+// Package webhook receives Emby and Jellyfin notifications and invalidates the cached
+// links, library index entries and user decisions they make stale.
+package webhook
+
+import (
+	"Go_Frontend/config"
+	"Go_Frontend/logger"
+	"Go_Frontend/stream"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPayloadSize bounds the request body; notification payloads are a few kilobytes.
+const maxPayloadSize = 1 << 20
+
+// payload covers Emby webhooks, the Emby notification plugins and the Jellyfin webhook plugin.
+type payload struct {
+	// Emby
+	Event string `json:"Event"`
+	Item  *struct {
+		ID   string `json:"Id"`
+		Name string `json:"Name"`
+		Path string `json:"Path"`
+		Type string `json:"Type"`
+	} `json:"Item"`
+	User *struct {
+		ID   string `json:"Id"`
+		Name string `json:"Name"`
+	} `json:"User"`
+
+	// Jellyfin
+	NotificationType string `json:"NotificationType"`
+	ItemID           string `json:"ItemId"`
+	Name             string `json:"Name"`
+	UserID           string `json:"UserId"`
+}
+
+// Invalidation hooks, replaced in tests.
+var (
+	invalidateItem = stream.InvalidateItem
+	invalidateUser = stream.InvalidateUser
+)
+
+// Events that change an item's path or existence, lowercased.
+var itemEvents = map[string]bool{
+	"library.new":     true,
+	"library.deleted": true,
+	"library.updated": true,
+	"item.updated":    true,
+	"itemadded":       true,
+	"itemdeleted":     true,
+	"itemupdated":     true,
+}
+
+// Events that change what a user may play, lowercased.
+var userEvents = map[string]bool{
+	"user.policyupdated":   true,
+	"user.deleted":         true,
+	"user.passwordchanged": true,
+	"userupdated":          true,
+	"userdeleted":          true,
+	"userpasswordchanged":  true,
+	"userlockedout":        true,
+}
+
+// Handle receives a notification. The optional server query parameter names the
+// media server that sent it; the default server is assumed otherwise.
+func Handle(c *gin.Context) {
+	if !validSecret(c) {
+		logger.Warn("Rejected webhook with invalid secret from %s", c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid webhook secret"})
+		return
+	}
+
+	server := config.DefaultServer()
+	if name := c.Query("server"); name != "" {
+		server = config.GetServer(name)
+	}
+	if server == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+		return
+	}
+
+	p, err := readPayload(c)
+	if err != nil {
+		logger.Warn("Rejected malformed webhook: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Malformed webhook payload"})
+		return
+	}
+
+	event := p.Event
+	if event == "" {
+		event = p.NotificationType
+	}
+	switch key := strings.ToLower(event); {
+	case itemEvents[key]:
+		handleItemEvent(c, server, event, p)
+	case userEvents[key]:
+		handleUserEvent(c, server, event, p)
+	default:
+		// Acknowledge anyway, so the server does not retry events we do not care about
+		logger.Debug("Ignored webhook event %q from server %s", event, server.Name)
+		c.JSON(http.StatusOK, gin.H{"event": event, "ignored": true})
+	}
+}
+
+func handleItemEvent(c *gin.Context, server *config.ServerConfig, event string, p payload) {
+	itemID, itemName, itemPath := p.ItemID, p.Name, ""
+	if p.Item != nil {
+		itemID, itemName, itemPath = p.Item.ID, p.Item.Name, p.Item.Path
+	}
+	if itemID == "" && itemPath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook payload has no item"})
+		return
+	}
+
+	result := invalidateItem(server, itemID, itemPath)
+	logger.Info("Webhook %s for item %s (%s) on server %s: invalidated %d items, %d index entries, %d cached paths",
+		event, itemID, itemName, server.Name, len(result.Items), result.IndexEntries, result.CacheEntries)
+	c.JSON(http.StatusOK, gin.H{"event": event, "invalidated": result})
+}
+
+func handleUserEvent(c *gin.Context, server *config.ServerConfig, event string, p payload) {
+	userID, userName := p.UserID, ""
+	if p.User != nil {
+		userID, userName = p.User.ID, p.User.Name
+	}
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook payload has no user"})
+		return
+	}
+
+	removed := invalidateUser(server, userID)
+	logger.Info("Webhook %s for user %s (%s) on server %s: dropped %d cached sessions and decisions",
+		event, userID, userName, server.Name, removed)
+	c.JSON(http.StatusOK, gin.H{"event": event, "invalidated": removed})
+}
+
+// readPayload accepts a JSON body, or a form with the JSON in its "data" field as sent
+// by Emby's older webhook notifier.
+func readPayload(c *gin.Context) (payload, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxPayloadSize)
+
+	var p payload
+	contentType := c.ContentType()
+	if contentType == gin.MIMEMultipartPOSTForm || contentType == gin.MIMEPOSTForm {
+		err := json.Unmarshal([]byte(c.PostForm("data")), &p)
+		return p, err
+	}
+	err := json.NewDecoder(c.Request.Body).Decode(&p)
+	return p, err
+}
+
+// validSecret checks the shared secret from the secret query parameter or the X-Webhook-Secret header.
+func validSecret(c *gin.Context) bool {
+	secret := config.GetConfig().Webhook.Secret
+	provided := c.GetHeader("X-Webhook-Secret")
+	if provided == "" {
+		provided = c.Query("secret")
+	}
+	return secret != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(secret)) == 1
+}
@@ -0,0 +1,249 @@
+package webhook
+
+import (
+	"Go_Frontend/config"
+	"Go_Frontend/library"
+	"Go_Frontend/route"
+	"Go_Frontend/stream"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// invalidation records one call of the invalidation hooks.
+type invalidation struct {
+	server, item, path, user string
+}
+
+func newTestEngine(t *testing.T) (*gin.Engine, *[]invalidation) {
+	t.Helper()
+	savedServers, savedWebhook := config.GetConfig().Servers, config.GetConfig().Webhook
+	savedItem, savedUser := invalidateItem, invalidateUser
+	t.Cleanup(func() {
+		config.GetConfig().Servers, config.GetConfig().Webhook = savedServers, savedWebhook
+		invalidateItem, invalidateUser = savedItem, savedUser
+	})
+	config.GetConfig().Servers = []config.ServerConfig{
+		{Name: "family"},
+		{Name: "friends", Type: config.ServerTypeJellyfin, Hosts: []string{"friends.example.com"}},
+	}
+	config.GetConfig().Webhook.Secret = "s3cret"
+
+	var calls []invalidation
+	invalidateItem = func(server *config.ServerConfig, itemID, itemPath string) stream.Invalidation {
+		calls = append(calls, invalidation{server: server.Name, item: itemID, path: itemPath})
+		return stream.Invalidation{Items: []string{itemID}}
+	}
+	invalidateUser = func(server *config.ServerConfig, userID string) int {
+		calls = append(calls, invalidation{server: server.Name, user: userID})
+		return 1
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/webhook", Handle)
+	return r, &calls
+}
+
+func post(r *gin.Engine, target, contentType, body string, header http.Header) int {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestSecret(t *testing.T) {
+	r, calls := newTestEngine(t)
+	body := `{"Event": "library.new", "Item": {"Id": "1"}}`
+
+	tests := []struct {
+		name   string
+		target string
+		header http.Header
+		want   int
+	}{
+		{"missing", "/webhook", nil, http.StatusUnauthorized},
+		{"wrong query", "/webhook?secret=guess", nil, http.StatusUnauthorized},
+		{"wrong header", "/webhook", http.Header{"X-Webhook-Secret": {"guess"}}, http.StatusUnauthorized},
+		{"header wins over query", "/webhook?secret=s3cret", http.Header{"X-Webhook-Secret": {"guess"}}, http.StatusUnauthorized},
+		{"query", "/webhook?secret=s3cret", nil, http.StatusOK},
+		{"header", "/webhook", http.Header{"X-Webhook-Secret": {"s3cret"}}, http.StatusOK},
+	}
+	for _, test := range tests {
+		*calls = nil
+		if got := post(r, test.target, "application/json", body, test.header); got != test.want {
+			t.Errorf("%s: status %d, want %d", test.name, got, test.want)
+		}
+		if test.want != http.StatusOK && len(*calls) != 0 {
+			t.Errorf("%s: rejected webhook invalidated %v", test.name, *calls)
+		}
+	}
+
+	// Without a configured secret every webhook is rejected
+	config.GetConfig().Webhook.Secret = ""
+	if got := post(r, "/webhook?secret=", "application/json", body, nil); got != http.StatusUnauthorized {
+		t.Errorf("no secret configured: status %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	r, calls := newTestEngine(t)
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		status int
+		want   []invalidation
+	}{
+		{"emby new item", "", `{"Event": "library.new", "Item": {"Id": "1", "Path": "/mnt/gd/Show"}}`, http.StatusOK,
+			[]invalidation{{server: "family", item: "1", path: "/mnt/gd/Show"}}},
+		{"emby deleted item", "", `{"Event": "library.deleted", "Item": {"Id": "2"}}`, http.StatusOK,
+			[]invalidation{{server: "family", item: "2"}}},
+		{"emby updated item", "", `{"Event": "item.updated", "Item": {"Id": "3"}}`, http.StatusOK,
+			[]invalidation{{server: "family", item: "3"}}},
+		{"emby policy", "", `{"Event": "user.policyupdated", "User": {"Id": "u1"}}`, http.StatusOK,
+			[]invalidation{{server: "family", user: "u1"}}},
+		{"emby password", "", `{"Event": "user.passwordchanged", "User": {"Id": "u2"}}`, http.StatusOK,
+			[]invalidation{{server: "family", user: "u2"}}},
+		{"emby deleted user", "", `{"Event": "user.deleted", "User": {"Id": "u3"}}`, http.StatusOK,
+			[]invalidation{{server: "family", user: "u3"}}},
+		{"jellyfin item added", "&server=friends", `{"NotificationType": "ItemAdded", "ItemId": "4"}`, http.StatusOK,
+			[]invalidation{{server: "friends", item: "4"}}},
+		{"jellyfin item deleted", "&server=friends", `{"NotificationType": "ItemDeleted", "ItemId": "5"}`, http.StatusOK,
+			[]invalidation{{server: "friends", item: "5"}}},
+		{"jellyfin user locked out", "&server=friends", `{"NotificationType": "UserLockedOut", "UserId": "u4"}`, http.StatusOK,
+			[]invalidation{{server: "friends", user: "u4"}}},
+		{"jellyfin user updated", "&server=friends", `{"NotificationType": "UserUpdated", "UserId": "u5"}`, http.StatusOK,
+			[]invalidation{{server: "friends", user: "u5"}}},
+		{"ignored event", "", `{"Event": "playback.start", "Item": {"Id": "1"}}`, http.StatusOK, nil},
+		{"item event without item", "", `{"Event": "library.new"}`, http.StatusBadRequest, nil},
+		{"user event without user", "", `{"Event": "user.deleted"}`, http.StatusBadRequest, nil},
+		{"unknown server", "&server=nope", `{"Event": "library.new", "Item": {"Id": "1"}}`, http.StatusNotFound, nil},
+		{"malformed", "", `{"Event": `, http.StatusBadRequest, nil},
+	}
+	for _, test := range tests {
+		*calls = nil
+		if got := post(r, "/webhook?secret=s3cret"+test.target, "application/json", test.body, nil); got != test.status {
+			t.Errorf("%s: status %d, want %d", test.name, got, test.status)
+		}
+		if !equalCalls(*calls, test.want) {
+			t.Errorf("%s: invalidated %v, want %v", test.name, *calls, test.want)
+		}
+	}
+}
+
+func TestFormPayload(t *testing.T) {
+	r, calls := newTestEngine(t)
+	data := `{"Event": "library.deleted", "Item": {"Id": "7"}}`
+
+	if got := post(r, "/webhook?secret=s3cret", "application/x-www-form-urlencoded",
+		url.Values{"data": {data}}.Encode(), nil); got != http.StatusOK {
+		t.Errorf("form-encoded: status %d", got)
+	}
+
+	var body strings.Builder
+	form := multipart.NewWriter(&body)
+	form.WriteField("data", data)
+	form.Close()
+	if got := post(r, "/webhook?secret=s3cret", form.FormDataContentType(), body.String(), nil); got != http.StatusOK {
+		t.Errorf("multipart: status %d", got)
+	}
+
+	want := []invalidation{{server: "family", item: "7"}, {server: "family", item: "7"}}
+	if !equalCalls(*calls, want) {
+		t.Errorf("invalidated %v, want %v", *calls, want)
+	}
+
+	if got := post(r, "/webhook?secret=s3cret", "application/x-www-form-urlencoded", "data=not+json", nil); got != http.StatusBadRequest {
+		t.Errorf("malformed form: status %d, want %d", got, http.StatusBadRequest)
+	}
+}
+
+func equalCalls(got, want []invalidation) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFolderEventWithoutIndex(t *testing.T) {
+	emby := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/Items/1/PlaybackInfo":
+			w.Write([]byte(`{"MediaSources": [{"Id": "a", "Path": "/mnt/gd/Show/S01E01.mkv"}]}`))
+		case "/Items/2/PlaybackInfo":
+			w.Write([]byte(`{"MediaSources": [{"Id": "a", "Path": "/mnt/gd/Movie.mkv"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(emby.Close)
+
+	r, _ := newTestEngine(t)
+	invalidateItem, invalidateUser = stream.InvalidateItem, stream.InvalidateUser
+	server := &config.GetConfig().Servers[0]
+	server.Type, server.URL = config.ServerTypeEmby, emby.URL
+	server.Backends = []config.BackendConfig{{Name: "gd", URL: "https://gd.example.com/stream", Path: "/mnt/gd"}}
+
+	savedCache, savedIndex := config.GetConfig().Cache, config.GetConfig().Index
+	t.Cleanup(func() {
+		config.GetConfig().Cache, config.GetConfig().Index = savedCache, savedIndex
+		stream.InitializeCache(savedCache)
+		library.Initialize(savedIndex, config.GetConfig().Servers)
+		route.Load(config.GetConfig().Servers, "")
+	})
+	config.GetConfig().Index.Enabled = false
+	if err := library.Initialize(config.GetConfig().Index, config.GetConfig().Servers); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.InitializeCache(config.CacheConfig{TTL: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.InitializeSignature("vPQC5LWCN2CW2opz"); err != nil {
+		t.Fatal(err)
+	}
+	if err := route.Load(config.GetConfig().Servers, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Playing both items caches their paths
+	r.GET("/videos/:itemID/stream", stream.HandleStreamRequest)
+	for _, itemID := range []string{"1", "2"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/videos/"+itemID+"/stream?MediaSourceId=a", nil))
+		if w.Code != http.StatusFound {
+			t.Fatalf("playing item %s: status %d", itemID, w.Code)
+		}
+		if _, found := stream.LookupCachedPath(server, itemID, "a"); !found {
+			t.Fatalf("path of item %s was not cached", itemID)
+		}
+	}
+
+	// A series webhook carries the folder, not the episodes, and still evicts them
+	body := `{"Event": "library.deleted", "Item": {"Id": "99", "Path": "/mnt/gd/Show"}}`
+	if got := post(r, "/webhook?secret=s3cret", "application/json", body, nil); got != http.StatusOK {
+		t.Fatalf("webhook status %d", got)
+	}
+	if _, found := stream.LookupCachedPath(server, "1", "a"); found {
+		t.Error("episode under the deleted folder is still cached")
+	}
+	if _, found := stream.LookupCachedPath(server, "2", "a"); !found {
+		t.Error("item outside the deleted folder was evicted")
+	}
+}